@@ -21,6 +21,7 @@
 package emitter
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -54,13 +55,22 @@ func initEmitters() {
 	}
 	viper.AddConfigPath(config.JrSystemDir)
 
+	var err error
+	if emitterapi.Emitters, err = readEmitters(); err != nil {
+		log.Error().Err(err).Msg("Failed to read emitter configuration")
+	}
+}
+
+// readEmitters reads the configuration of the emitters from the jrconfig file
+func readEmitters() (map[string][]emitterapi.Config, error) {
 	if err := viper.ReadInConfig(); err != nil {
-		log.Error().Err(err).Msg("JR configuration not found")
+		return nil, fmt.Errorf("JR configuration not found: %w", err)
 	}
-	err := viper.UnmarshalKey("Emitters", &emitterapi.Emitters)
+	emitters, err := emitterapi.DecodeConfigs(viper.Get("Emitters"))
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal emitter configuration")
+		return nil, fmt.Errorf("failed to unmarshal emitter configuration: %w", err)
 	}
+	return emitters, nil
 }
 
 func init() {
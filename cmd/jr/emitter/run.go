@@ -23,13 +23,18 @@ package emitter
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/jrnd-io/jrv2/pkg/config"
 	"github.com/jrnd-io/jrv2/pkg/emitter"
 	"github.com/jrnd-io/jrv2/pkg/loop"
 	"github.com/jrnd-io/jrv2/pkg/plugin/local/console"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
@@ -42,6 +47,10 @@ var RunCmd = &cobra.Command{
 }
 
 func run(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("seed") {
+		seed, _ := cmd.Flags().GetInt64("seed")
+		random.SetRandom(seed)
+	}
 	dryrun, _ := cmd.Flags().GetBool("dryrun")
 	pluginName, err := cmd.Flags().GetString("output")
 	if err != nil {
@@ -51,6 +60,63 @@ func run(cmd *cobra.Command, args []string) {
 
 	configParams, _ := cmd.Flags().GetStringToString("param")
 
+	throughputString, _ := cmd.Flags().GetString("throughput")
+	throughput, err := emitter.ParseThroughput(throughputString)
+	if err != nil {
+		log.Error().Err(err).Str("throughput", throughputString).Msg("error parsing throughput")
+		return
+	}
+	recordRate, _ := cmd.Flags().GetFloat64("recordRate")
+	batchSize, _ := cmd.Flags().GetInt("batchSize")
+	linger, _ := cmd.Flags().GetDuration("linger")
+
+	options := []loop.Option{
+		loop.WithThroughput(throughput),
+		loop.WithRecordRate(recordRate),
+		loop.WithBatching(batchSize, linger),
+	}
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	speed, _ := cmd.Flags().GetFloat64("speed")
+	clock, err := state.ParseClock(from, to, speed)
+	if err != nil {
+		log.Error().Err(err).Msg("error parsing clock")
+		return
+	}
+	if clock != nil {
+		options = append(options, loop.WithClock(clock))
+	}
+	if statsInterval, _ := cmd.Flags().GetDuration("stats"); statsInterval > 0 {
+		options = append(options, loop.WithStats(statsInterval))
+	}
+	if summary, _ := cmd.Flags().GetBool("summary"); summary {
+		options = append(options, loop.WithSummary())
+	}
+	if report, _ := cmd.Flags().GetString("report"); report != "" {
+		options = append(options, loop.WithReport(report))
+	}
+	if topKeys, _ := cmd.Flags().GetInt("keyReport"); topKeys > 0 {
+		options = append(options, loop.WithKeyReport(topKeys))
+	}
+	if metrics, _ := cmd.Flags().GetString("metrics"); metrics != "" {
+		options = append(options, loop.WithMetrics(metrics))
+	}
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		options = append(options, loop.WithWatch(readEmitters, viper.ConfigFileUsed()))
+	}
+	resume, _ := cmd.Flags().GetString("resume")
+	if resume != "" {
+		options = append(options, loop.WithResume(resume))
+	}
+	checkpoint, _ := cmd.Flags().GetString("checkpoint")
+	if checkpoint == "" {
+		checkpoint = resume
+	}
+	if checkpoint != "" {
+		interval, _ := cmd.Flags().GetDuration("checkpointInterval")
+		options = append(options, loop.WithCheckpoint(checkpoint, interval))
+	}
+
 	var logLevel hclog.Level
 	verbosity, err := cmd.PersistentFlags().GetCount("output-log-level")
 	if err != nil {
@@ -82,7 +148,8 @@ func run(cmd *cobra.Command, args []string) {
 		pluginName,
 		emitters,
 		configParams,
-		logLevel)
+		logLevel,
+		options...)
 
 }
 
@@ -90,14 +157,16 @@ func RunEmitters(ctx context.Context,
 	pluginName string,
 	emitters *orderedmap.OrderedMap[string, []emitter.Config],
 	configParams map[string]string,
-	pluginLogLevel hclog.Level) {
+	pluginLogLevel hclog.Level,
+	options ...loop.Option) {
 
 	log.Debug().Msg("Running main loop")
 	if err := loop.DoLoop(ctx,
 		emitters,
 		configParams,
 		pluginName,
-		pluginLogLevel); err != nil {
+		pluginLogLevel,
+		options...); err != nil {
 		fmt.Printf("%v\n", err)
 	}
 
@@ -107,5 +176,23 @@ func init() {
 	RunCmd.Flags().BoolP("dryrun", "d", false, "dryrun: output of the emitters to stdout")
 	RunCmd.Flags().StringP("output", "o", "", "name of output producer")
 	RunCmd.Flags().CountP("output-log-level", "l", "name of output producer")
+	RunCmd.Flags().String("throughput", "", "maximum throughput of all the emitters together, i.e. 10MB/s")
+	RunCmd.Flags().Float64("recordRate", 0, "maximum number of objects per second of all the emitters together")
+	RunCmd.Flags().String("from", "", "start of a simulated clock, i.e. 2026-09-01: the times in the templates and the ticks follow it")
+	RunCmd.Flags().String("to", "", "end of the simulated clock, i.e. 2026-10-01: with --speed 0 the time until the end is backfilled as fast as possible")
+	RunCmd.Flags().Float64("speed", 0, "how many times the simulated clock flows faster than the real time, 0 to jump from tick to tick")
+	RunCmd.Flags().Int64("seed", -1, "seed of the random values, overriding JR_SEED: every emitter has its own stream derived from the seed and its name")
+	RunCmd.Flags().Int("batchSize", 0, "maximum number of objects sent with a single call to the remote plugins supporting batches")
+	RunCmd.Flags().Duration("linger", 0, "maximum time to wait for a batch to be full, i.e. 5ms")
+	RunCmd.Flags().Duration("stats", 0, "write the statistics of the run to stderr at the given interval, i.e. 5s")
+	RunCmd.Flags().Bool("summary", false, "write a summary table of the run to stderr at the end")
+	RunCmd.Flags().String("report", "", "write the summary of the run as JSON to the given file at the end")
+	RunCmd.Flags().Int("keyReport", 0, "add the given number of most frequent keys to the summary and the report, to check their skew")
+	RunCmd.Flags().Bool("watch", false, "reload the templates and the configuration of the emitters when their files change, swapping them in at the next tick")
+	RunCmd.Flags().String("checkpoint", "", "writes the state of the templates to the given file at every --checkpointInterval and at the end, to resume the run later")
+	RunCmd.Flags().Duration("checkpointInterval", time.Minute, "interval of the checkpoints, 0 to write it only at the end")
+	RunCmd.Flags().String("resume", "", "resumes the run from the given checkpoint, continuing its counters, lists and random values: the checkpoint is written to the same file if --checkpoint is not set")
+	RunCmd.Flags().String("metrics", "", "expose the metrics of the run in OpenMetrics format on /metrics at the given address")
+	RunCmd.Flags().Lookup("metrics").NoOptDefVal = fmt.Sprintf(":%d", config.DefaultHTTPPort)
 	RunCmd.Flags().StringToStringP("param", "p", make(map[string]string), "configuration parameters in the form <emittername>.<param name>=<value>")
 }
@@ -57,6 +57,7 @@ func show(cmd *cobra.Command, args []string) {
 			for _, e := range v {
 				greenf("Name: %s\n", whitef("%s", e.Name))                //nolint
 				greenf("Locale: %s\n", whitef("%s", e.Locale))            //nolint
+				greenf("Type: %s\n", whitef(e.Tick.Type))                 //nolint
 				greenf("Num: %s\n", whitef("%d", e.Tick.Num))             //nolint
 				greenf("Frequency: %s\n", whitef("%d", e.Tick.Frequency)) //nolint
 				greenf("Duration: %s\n", whitef("%d", e.Tick.Duration))   //nolint
@@ -66,6 +67,7 @@ func show(cmd *cobra.Command, args []string) {
 				greenf("Key Template: %s\n", whitef(e.KeyTemplate))       //nolint
 				greenf("Value Template: %s\n", whitef(e.ValueTemplate))   //nolint
 				greenf("Output Template: %s\n", whitef(e.OutputTemplate)) //nolint
+				greenf("Depends On: %s\n", whitef("%v", e.DependsOn))     //nolint
 			}
 		}
 	}
@@ -39,7 +39,7 @@ var envCmd = &cobra.Command{
 		randomGen := "Global default (not reproducible, thread safe)"
 		if random.JrSeed != -1 {
 			seed = fmt.Sprintf("%x", random.CreateByteSeed(uint64(random.JrSeed)))
-			randomGen = "Local ChaCha8 (reproducible, not thread safe)"
+			randomGen = "Local ChaCha8 (reproducible, thread safe)"
 		}
 		fmt.Printf("JR System Dir: %s\n", config.JrSystemDir)
 		fmt.Printf("JR User Dir  : %s\n", config.JrUserDir)
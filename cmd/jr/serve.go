@@ -0,0 +1,123 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jrnd-io/jrv2/pkg/config"
+	emitterapi "github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API to start, stop and retune the configured emitters",
+	Long: `Serve a REST API to start, stop and retune the configured emitters. Example:
+jr serve --address :7482
+curl -X POST localhost:7482/emitters/shoe/start
+curl -X PATCH localhost:7482/emitters/shoe/shoe -d '{"num": 10, "frequency": "500ms"}'
+curl localhost:7482/emitters/shoe
+curl -X POST localhost:7482/emitters/shoe/stop
+`,
+	Args: cobra.NoArgs,
+	RunE: serve,
+}
+
+func serve(cmd *cobra.Command, _ []string) error {
+	if cmd.Flags().Changed("seed") {
+		seed, _ := cmd.Flags().GetInt64("seed")
+		random.SetRandom(seed)
+	}
+	address, _ := cmd.Flags().GetString("address")
+	output, _ := cmd.Flags().GetString("output")
+	configParams, _ := cmd.Flags().GetStringToString("param")
+	start, _ := cmd.Flags().GetStringSlice("start")
+
+	throughputString, _ := cmd.Flags().GetString("throughput")
+	throughput, err := emitterapi.ParseThroughput(throughputString)
+	if err != nil {
+		return err
+	}
+	recordRate, _ := cmd.Flags().GetFloat64("recordRate")
+	batchSize, _ := cmd.Flags().GetInt("batchSize")
+	linger, _ := cmd.Flags().GetDuration("linger")
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	controller := loop.NewController(ctx,
+		emitterapi.Emitters,
+		configParams,
+		output,
+		hclog.Off,
+		loop.WithThroughput(throughput),
+		loop.WithRecordRate(recordRate),
+		loop.WithBatching(batchSize, linger))
+	defer controller.Close()
+
+	for _, group := range start {
+		if err := controller.Start(group, ""); err != nil {
+			return err
+		}
+	}
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           controller.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("error in shutting down server")
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "JR serving the emitters API on %s\n", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func init() {
+	serveCmd.Flags().String("address", fmt.Sprintf(":%d", config.DefaultHTTPPort), "address of the REST API")
+	serveCmd.Flags().StringP("output", "o", "", "name of output producer, overriding the output of the emitters")
+	serveCmd.Flags().StringToStringP("param", "p", make(map[string]string), "configuration parameters in the form <emittername>.<param name>=<value>")
+	serveCmd.Flags().StringSlice("start", nil, "groups of emitters to start immediately")
+	serveCmd.Flags().String("throughput", "", "maximum throughput of all the emitters together, i.e. 10MB/s")
+	serveCmd.Flags().Float64("recordRate", 0, "maximum number of objects per second of all the emitters together")
+	serveCmd.Flags().Int64("seed", -1, "seed of the random values, overriding JR_SEED: every emitter has its own stream derived from the seed and its name")
+	serveCmd.Flags().Int("batchSize", 0, "maximum number of objects sent with a single call to the remote plugins supporting batches")
+	serveCmd.Flags().Duration("linger", 0, "maximum time to wait for a batch to be full, i.e. 5ms")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -21,14 +21,17 @@
 package template
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/jrnd-io/jrv2/pkg/config"
 	"github.com/jrnd-io/jrv2/pkg/emitter"
 	"github.com/jrnd-io/jrv2/pkg/loop"
-	"github.com/jrnd-io/jrv2/pkg/tpl"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	orderedmap "github.com/wk8/go-ordered-map/v2"
-	"time"
 )
 
 var RunCmd = &cobra.Command{
@@ -45,6 +48,10 @@ jr template run --embedded "{{name}}"
 }
 
 func run(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed("seed") {
+		seed, _ := cmd.Flags().GetInt64("seed")
+		random.SetRandom(seed)
+	}
 	keyTemplate, _ := cmd.Flags().GetString("key")
 	headerTemplate, _ := cmd.Flags().GetString("header")
 
@@ -60,7 +67,19 @@ func run(cmd *cobra.Command, args []string) error {
 	duration, _ := cmd.Flags().GetDuration("duration")
 	immediateStart, _ := cmd.Flags().GetBool("immediate")
 	throughputString, _ := cmd.Flags().GetString("throughput")
+	recordRate, _ := cmd.Flags().GetFloat64("recordRate")
 	preload, _ := cmd.Flags().GetInt("preload")
+	onError, _ := cmd.Flags().GetString("onError")
+	deadLetter, _ := cmd.Flags().GetString("deadLetter")
+	maxErrors, _ := cmd.Flags().GetInt("maxErrors")
+	workers, _ := cmd.Flags().GetInt("workers")
+	ordered, _ := cmd.Flags().GetBool("ordered")
+	reorder, _ := cmd.Flags().GetFloat64("reorder")
+	reorderWindow, _ := cmd.Flags().GetInt("reorderWindow")
+	late, _ := cmd.Flags().GetFloat64("late")
+	lateness, _ := cmd.Flags().GetDuration("lateness")
+	duplicate, _ := cmd.Flags().GetFloat64("duplicate")
+	nearDuplicate, _ := cmd.Flags().GetFloat64("nearDuplicate")
 
 	log.Debug().Str("keyTemplate", keyTemplate).
 		Str("headerTemplate", headerTemplate).
@@ -74,7 +93,17 @@ func run(cmd *cobra.Command, args []string) error {
 		Dur("frequency", frequency).
 		Bool("immediate", immediateStart).
 		Str("throughput", throughputString).
+		Float64("recordRate", recordRate).
 		Int("preload", preload).
+		Str("onError", onError).
+		Str("deadLetter", deadLetter).
+		Int("maxErrors", maxErrors).
+		Int("workers", workers).
+		Bool("ordered", ordered).
+		Float64("reorder", reorder).
+		Float64("late", late).
+		Float64("duplicate", duplicate).
+		Float64("nearDuplicate", nearDuplicate).
 		Msg("executing run template")
 
 	// csv, _ := cmd.Flags().GetString("csv")
@@ -85,14 +114,19 @@ func run(cmd *cobra.Command, args []string) error {
 		outputTemplate = config.DefaultOutputKcatTemplate
 	}
 
-	var err error
-	valueTemplate := args[0]
-	frequency, err = evaluateFrequencyFor(valueTemplate, throughputString, num, embedded)
+	throughput, err := emitter.ParseThroughput(throughputString)
 	if err != nil {
-		log.Error().Err(err).Str("valueTemplate", valueTemplate).Msg("cannot evaluate frequency")
+		log.Error().Err(err).Str("throughput", throughputString).Msg("error parsing throughput")
 		return err
 	}
 
+	// without a frequency the template is run once, unless a backfill needs the ticks until its end
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	if frequency <= 0 && to != "" {
+		frequency = config.DefaultFrequency
+	}
+
 	emitterConfig := emitter.Config{
 		Name: "cli",
 		Tick: emitter.Ticker{
@@ -100,6 +134,8 @@ func run(cmd *cobra.Command, args []string) error {
 			Frequency:      frequency,
 			Num:            num,
 			ImmediateStart: immediateStart,
+			Throughput:     throughput,
+			RecordRate:     recordRate,
 		},
 		Preload:        preload,
 		KeyTemplate:    keyTemplate,
@@ -110,50 +146,85 @@ func run(cmd *cobra.Command, args []string) error {
 		Output:         output,
 		Locale:         locale,
 		Oneline:        oneline,
+		OnError: emitter.ErrorPolicy{
+			Action:     onError,
+			DeadLetter: deadLetter,
+			MaxErrors:  maxErrors,
+		},
+		Workers: workers,
+		Ordered: ordered,
 	}
-
-	emitters := orderedmap.New[string, []emitter.Config](1)
-	emitters.Set(emitter.DefaultEmitterName, []emitter.Config{emitterConfig})
-	if err := loop.DoLoop(cmd.Context(), emitters, nil, output, -1); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func evaluateFrequencyFor(valueTemplate string, throughputString string, num int, embedded bool) (time.Duration, error) {
-	var err error
-	if !embedded {
-		valueTemplate, err = tpl.GetRawTemplate(valueTemplate)
-		log.Debug().Bool("embedded", embedded).Str("valueTemplate", valueTemplate).Msg("raw template")
-		if err != nil {
-			log.Error().Err(err).Str("valueTemplate", valueTemplate).Msg("error in getting raw template")
-			return config.DefaultFrequency, err
+	if reorder > 0 || late > 0 || duplicate > 0 || nearDuplicate > 0 {
+		emitterConfig.Disorder = &emitter.Disorder{
+			Reorder:       reorder,
+			Window:        reorderWindow,
+			Late:          late,
+			Lateness:      emitter.Delay{Mean: lateness},
+			Duplicate:     duplicate,
+			NearDuplicate: nearDuplicate,
 		}
 	}
 
-	result, err := tpl.ExecuteTemplate(valueTemplate, nil)
+	batchSize, _ := cmd.Flags().GetInt("batchSize")
+	linger, _ := cmd.Flags().GetDuration("linger")
+	options := []loop.Option{loop.WithBatching(batchSize, linger)}
+	speed, _ := cmd.Flags().GetFloat64("speed")
+	clock, err := state.ParseClock(from, to, speed)
 	if err != nil {
-		log.Error().Err(err).Str("valueTemplate", valueTemplate).Msg("error executing template")
-		return config.DefaultFrequency, err
+		return err
 	}
-	throughput, err := emitter.ParseThroughput(throughputString)
-	if err != nil {
-		log.Error().Err(err).Str("valueTemplate", valueTemplate).Msg("error parsing throughput")
-		return config.DefaultFrequency, err
+	if clock != nil {
+		options = append(options, loop.WithClock(clock))
+	}
+	if statsInterval, _ := cmd.Flags().GetDuration("stats"); statsInterval > 0 {
+		options = append(options, loop.WithStats(statsInterval))
+	}
+	if summary, _ := cmd.Flags().GetBool("summary"); summary {
+		options = append(options, loop.WithSummary())
+	}
+	if report, _ := cmd.Flags().GetString("report"); report != "" {
+		options = append(options, loop.WithReport(report))
+	}
+	if topKeys, _ := cmd.Flags().GetInt("keyReport"); topKeys > 0 {
+		options = append(options, loop.WithKeyReport(topKeys))
+	}
+	if metrics, _ := cmd.Flags().GetString("metrics"); metrics != "" {
+		options = append(options, loop.WithMetrics(metrics))
+	}
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		options = append(options, loop.WithWatch(nil))
+	}
+	resume, _ := cmd.Flags().GetString("resume")
+	if resume != "" {
+		options = append(options, loop.WithResume(resume))
+	}
+	checkpoint, _ := cmd.Flags().GetString("checkpoint")
+	if checkpoint == "" {
+		checkpoint = resume
+	}
+	if checkpoint != "" {
+		interval, _ := cmd.Flags().GetDuration("checkpointInterval")
+		options = append(options, loop.WithCheckpoint(checkpoint, interval))
+	}
+
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set(emitter.DefaultEmitterName, []emitter.Config{emitterConfig})
+	if err := loop.DoLoop(cmd.Context(), emitters, nil, output, -1, options...); err != nil {
+		return err
 	}
-	frequency := emitter.CalculateFrequency(len([]byte(result)), num, throughput)
-	return frequency, nil
 
+	return nil
 }
 
 func init() {
 	RunCmd.Flags().IntP("num", "n", config.DefaultNum, "Number of elements to create for each pass")
-	frequency := config.DefaultFrequency
-	RunCmd.Flags().DurationP("frequency", "f", frequency, "how much time to wait for next generation pass")
+	RunCmd.Flags().DurationP("frequency", "f", 0, "how much time to wait for next generation pass, 0 to run the template once")
 	duration := config.DefaultDuration
 	RunCmd.Flags().DurationP("duration", "d", duration, "If frequency is enabled, with Duration you can set a finite amount of time")
-	RunCmd.Flags().String("throughput", "", "You can set throughput, JR will calculate frequency automatically.")
+	RunCmd.Flags().String("throughput", "", "Maximum throughput, i.e. 10MB/s: objects are generated as fast as the throughput allows, ignoring frequency")
+	RunCmd.Flags().Float64("recordRate", 0, "Maximum number of objects per second: objects are generated as fast as the rate allows, ignoring frequency")
+	RunCmd.Flags().Int("batchSize", 0, "Maximum number of objects sent with a single call to the remote plugins supporting batches")
+	RunCmd.Flags().Duration("linger", 0, "Maximum time to wait for a batch to be full, i.e. 5ms")
 	RunCmd.Flags().Int("preload", config.DefaultPreloadSize, "Number of elements to create during the preload phase")
 	RunCmd.Flags().Bool("embedded", false, "If enabled, [template] must be a string containing a template, to be embedded directly in the script")
 	RunCmd.Flags().Bool("immediate", false, "If frequency is enabled, it will tick immediately too")
@@ -164,5 +235,30 @@ func init() {
 	RunCmd.Flags().BoolP("oneline", "l", false, "strips /n from output, for example to be pipelined to tools like kcat")
 	RunCmd.Flags().Bool("kcat", false, "If you want to pipe jr with kcat, use this flag: it is equivalent to --output stdout --outputTemplate '{{key}},{{value}}' --oneline")
 	RunCmd.Flags().String("locale", config.DefaultLocale, "DefaultLocale")
+	RunCmd.Flags().String("onError", emitter.SkipOnError, "What to do when an object can't be generated or produced: skip, retry, deadletter, fail or abort")
+	RunCmd.Flags().String("deadLetter", "", "Output receiving the objects which can't be produced, with --onError deadletter")
+	RunCmd.Flags().Int("maxErrors", 1, "Number of consecutive errors stopping the run, with --onError fail or abort")
+	RunCmd.Flags().Int("workers", 1, "Number of goroutines generating and producing the objects concurrently")
+	RunCmd.Flags().Bool("ordered", false, "With more than one worker, produces the objects with the same key in the order they are generated")
+	RunCmd.Flags().Float64("reorder", 0, "Probability of holding back an object, to produce it after up to --reorderWindow next objects")
+	RunCmd.Flags().Int("reorderWindow", 10, "Maximum number of objects produced before an object held back by --reorder")
+	RunCmd.Flags().Float64("late", 0, "Probability of producing an object --lateness after it is generated, keeping its time")
+	RunCmd.Flags().Duration("lateness", time.Minute, "Delay of the late objects, with --late")
+	RunCmd.Flags().Float64("duplicate", 0, "Probability of producing an exact copy of an object right after it")
+	RunCmd.Flags().Float64("nearDuplicate", 0, "Probability of producing a copy of an object with one of its JSON fields changed")
+	RunCmd.Flags().String("from", "", "Start of a simulated clock, i.e. 2026-09-01: the times in the templates and the ticks follow it")
+	RunCmd.Flags().String("to", "", "End of the simulated clock, i.e. 2026-10-01: with --speed 0 the time until the end is backfilled as fast as possible")
+	RunCmd.Flags().Float64("speed", 0, "How many times the simulated clock flows faster than the real time, 0 to jump from tick to tick")
+	RunCmd.Flags().Int64("seed", -1, "Seed of the random values, overriding JR_SEED: runs with the same seed generate the same objects")
 	RunCmd.Flags().String("csv", "", "Path to csv file to use")
+	RunCmd.Flags().Duration("stats", 0, "Writes the statistics of the run to stderr at the given interval, i.e. 5s")
+	RunCmd.Flags().Bool("summary", false, "Writes a summary table of the run to stderr at the end")
+	RunCmd.Flags().String("report", "", "Writes the summary of the run as JSON to the given file at the end")
+	RunCmd.Flags().Int("keyReport", 0, "Adds the given number of most frequent keys to the summary and the report, to check their skew")
+	RunCmd.Flags().Bool("watch", false, "Reloads [template] and the key and header templates when their files change, swapping them in at the next tick")
+	RunCmd.Flags().String("checkpoint", "", "Writes the state of the templates to the given file at every --checkpointInterval and at the end, to resume the run later")
+	RunCmd.Flags().Duration("checkpointInterval", time.Minute, "Interval of the checkpoints, 0 to write it only at the end")
+	RunCmd.Flags().String("resume", "", "Resumes the run from the given checkpoint, continuing its counters, lists and random values: the checkpoint is written to the same file if --checkpoint is not set")
+	RunCmd.Flags().String("metrics", "", "Exposes the metrics of the run in OpenMetrics format on /metrics at the given address")
+	RunCmd.Flags().Lookup("metrics").NoOptDefVal = fmt.Sprintf(":%d", config.DefaultHTTPPort)
 }
@@ -34,9 +34,10 @@ import (
 var ShowCmd = &cobra.Command{
 	Use:   "show [template]",
 	Short: "Show a template",
-	Long:  `Show a template. Templates must be in system or in user directory, which are '$JR_USER_DIR/templates' and '$JR_SYSTEM_DIR/templates'`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  show,
+	Long: `Show a template. Templates must be in system or in user directory, which are '$JR_USER_DIR/templates' and '$JR_SYSTEM_DIR/templates'.
+With --expand, the partials included by the template, which are in the 'partials' directory of the templates directories, are replaced by their text`,
+	Args: cobra.ExactArgs(1),
+	RunE: show,
 }
 
 func show(cmd *cobra.Command, args []string) error {
@@ -52,6 +53,9 @@ func show(cmd *cobra.Command, args []string) error {
 	}
 	cyanf := cyan.Sprintf
 	templateString, err := tpl.GetRawValidatedTemplate(args[0])
+	if expand, _ := cmd.Flags().GetBool("expand"); expand && err == nil {
+		templateString, err = tpl.Expand(args[0], templateString)
+	}
 
 	if runtime.GOOS != "windows" {
 		templateString = strings.ReplaceAll(templateString, "{{", cyanf("{{"))
@@ -66,4 +70,5 @@ func show(cmd *cobra.Command, args []string) error {
 
 func init() {
 	ShowCmd.Flags().BoolP("nocolor", "n", false, "Do not color output")
+	ShowCmd.Flags().BoolP("expand", "e", false, "Show the template with the partials it includes expanded")
 }
@@ -68,7 +68,7 @@ const (
 func InitEnvironmentVariables() {
 	JrSystemDir = os.Getenv(EnvJRSystemDir)
 	JrUserDir = os.Getenv(EnvJRUserDir)
-	JrSeedEnv := os.Getenv(EnvJRUserDir)
+	JrSeedEnv := os.Getenv(EnvJRSeed)
 	JrVerbosityEnv := os.Getenv(EnvJRVerbosity)
 	seed, err := strconv.ParseInt(JrSeedEnv, 10, 64)
 	if err != nil || JrSeedEnv == "" {
@@ -0,0 +1,137 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/tpl"
+)
+
+// DefaultOversizedLength is the length of the oversized values of Chaos
+const DefaultOversizedLength = 64 * 1024
+
+// Chaos corrupts the objects of an emitter after they are rendered, to test how the consumers handle
+// malformed payloads. Every corruption is applied with its probability, independently of the others.
+// The field corruptions change one top level field of the values which are JSON objects, re-encoding them.
+type Chaos struct {
+	// DropField removes a field
+	DropField float64
+	// RenameField swaps the case of the first letter of the name of a field
+	RenameField float64
+	// ChangeType changes the type of a field, i.e. a number to a string
+	ChangeType float64
+	// Null sets a field to null
+	Null float64
+	// Oversized sets a field to a string of OversizedLength characters
+	Oversized       float64
+	OversizedLength int
+	// Truncate cuts the value at a random point
+	Truncate float64
+	// Garble replaces some characters of the value with JSON delimiters
+	Garble float64
+	// BreakEncoding inserts bytes which are not valid UTF-8 in the value
+	BreakEncoding float64
+	// Drift switches the emitter to other templates partway through the run
+	Drift *Drift
+}
+
+// Drift is a schema drift of an emitter: after a time of the clock of the run from the start of the emitter,
+// or after a number of objects, whichever comes first, the objects are rendered with the templates of the
+// drift. Without a key or a header template, the ones of the emitter are kept.
+type Drift struct {
+	After          time.Duration
+	AfterObjects   int64
+	KeyTemplate    string
+	ValueTemplate  string
+	HeaderTemplate string
+}
+
+// Validate checks the probabilities of the corruptions and the Drift
+func (c *Chaos) Validate() error {
+	probabilities := []struct {
+		name  string
+		value float64
+	}{
+		{"dropField", c.DropField},
+		{"renameField", c.RenameField},
+		{"changeType", c.ChangeType},
+		{"null", c.Null},
+		{"oversized", c.Oversized},
+		{"truncate", c.Truncate},
+		{"garble", c.Garble},
+		{"breakEncoding", c.BreakEncoding},
+	}
+	for _, p := range probabilities {
+		if p.value < 0 || p.value > 1 {
+			return fmt.Errorf("chaos: the %s probability must be between 0 and 1", p.name)
+		}
+	}
+	if c.OversizedLength < 0 {
+		return fmt.Errorf("chaos: the oversized length must not be negative")
+	}
+	if d := c.Drift; d != nil {
+		if d.ValueTemplate == "" {
+			return fmt.Errorf("chaos: the drift needs a value template")
+		}
+		if d.After < 0 || d.AfterObjects < 0 {
+			return fmt.Errorf("chaos: the drift must not start before the emitter")
+		}
+		if d.After == 0 && d.AfterObjects == 0 {
+			return fmt.Errorf("chaos: the drift needs a time or a number of objects to start after")
+		}
+	}
+	return nil
+}
+
+// setDriftTemplates compiles the templates of the Drift of the Chaos, if any
+func (e *Emitter) setDriftTemplates(funcs map[string]any) error {
+	e.DriftTemplates = nil
+	if e.Config.Chaos == nil || e.Config.Chaos.Drift == nil {
+		return nil
+	}
+	d := e.Config.Chaos.Drift
+	text := d.ValueTemplate
+	if !e.Config.Embedded {
+		var err error
+		if text, err = tpl.GetRawTemplate(d.ValueTemplate); err != nil {
+			return fmt.Errorf("drift: %w", err)
+		}
+	}
+	t := &Templates{Key: e.KeyTemplate, Header: e.HeaderTemplate}
+	var err error
+	if t.Value, err = tpl.New("drift.value", text, funcs); err != nil {
+		return fmt.Errorf("drift: %w", err)
+	}
+	if d.KeyTemplate != "" {
+		if t.Key, err = e.newOptionalTemplate("drift.key", d.KeyTemplate, funcs); err != nil {
+			return fmt.Errorf("drift: %w", err)
+		}
+	}
+	if d.HeaderTemplate != "" {
+		if t.Header, err = e.newOptionalTemplate("drift.header", d.HeaderTemplate, funcs); err != nil {
+			return fmt.Errorf("drift: %w", err)
+		}
+	}
+	e.DriftTemplates = t
+	return nil
+}
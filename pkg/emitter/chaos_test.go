@@ -0,0 +1,79 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChaosValidate(t *testing.T) {
+	valid := emitter.Chaos{
+		DropField: 0.1,
+		Truncate:  0.01,
+		Drift:     &emitter.Drift{After: time.Minute, ValueTemplate: `{"v": 2}`},
+	}
+	assert.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		change func(c *emitter.Chaos)
+	}{
+		{"probability over 1", func(c *emitter.Chaos) { c.Garble = 2 }},
+		{"negative probability", func(c *emitter.Chaos) { c.Null = -1 }},
+		{"negative length", func(c *emitter.Chaos) { c.OversizedLength = -10 }},
+		{"drift without template", func(c *emitter.Chaos) { c.Drift = &emitter.Drift{After: time.Minute} }},
+		{"drift without start", func(c *emitter.Chaos) { c.Drift = &emitter.Drift{ValueTemplate: "{}"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.change(&c)
+			assert.Error(t, c.Validate())
+		})
+	}
+}
+
+func TestDriftTemplates(t *testing.T) {
+	cfg := emitter.Config{
+		Name:          "drift",
+		KeyTemplate:   "{{.Key}}",
+		ValueTemplate: `{"v": 1}`,
+		Embedded:      true,
+		Output:        "stdout",
+		Chaos:         &emitter.Chaos{Drift: &emitter.Drift{AfterObjects: 10, ValueTemplate: `{"v": 2}`}},
+	}
+	e, err := emitter.NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the drift keeps the key template of the emitter
+	assert.NotNil(t, e.DriftTemplates)
+	assert.Same(t, e.KeyTemplate, e.DriftTemplates.Key)
+	assert.NotSame(t, e.ValueTemplate, e.DriftTemplates.Value)
+
+	cfg.Chaos.Drift.ValueTemplate = `{{"unclosed"`
+	_, err = emitter.NewFromConfig(cfg)
+	assert.Error(t, err)
+}
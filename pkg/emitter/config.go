@@ -20,7 +20,12 @@
 
 package emitter
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
 
 const (
 	DefaultEmitterName        = "cli"
@@ -46,16 +51,103 @@ const (
 )
 
 type Config struct {
-	Tick             Ticker `mapstructure:",squash"`
-	Preload          int
-	Name             string
-	Locale           string
-	KeyTemplate      string
-	ValueTemplate    string
-	Embedded         bool
-	HeaderTemplate   string
-	OutputTemplate   string
-	Output           string
+	Tick    Ticker `mapstructure:",squash"`
+	Preload int
+	Name    string
+	// Group is the group of the emitter, set when it is run: emitters with the same Name can be in different groups
+	Group          string `mapstructure:"-"`
+	Locale         string
+	KeyTemplate    string
+	ValueTemplate  string
+	Embedded       bool
+	HeaderTemplate string
+	OutputTemplate string
+	Output         string
+	// Topic is passed to the output as its topic configuration parameter, unless ConfigParameters has one
+	Topic            string
 	Oneline          bool
 	ConfigParameters map[string]string
+	// DependsOn lists the emitters which must complete their preload phase before this one starts
+	DependsOn []string
+	// OnError is the policy applied when an object can't be generated or produced
+	OnError ErrorPolicy
+	// Workers is the number of goroutines generating and producing the objects of every tick.
+	// With a seed, the objects are generated in order and only produced concurrently, to be reproducible.
+	Workers int
+	// Ordered keeps the objects with the same key in the order they are generated when Workers is greater than 1
+	Ordered bool
+	// Scenario moves the entities created by the objects of the emitter through the states of their lifecycle
+	Scenario *Scenario
+	// Sessions groups the objects of the emitter in sessions of events, instead of a Scenario
+	Sessions *Sessions
+	// Disorder injects out-of-order, late and duplicate objects in the output of the emitter
+	Disorder *Disorder
+	// Chaos corrupts the objects of the emitter after they are rendered, and drifts its schema
+	Chaos *Chaos
+	// Keys generates the keys of the objects of the emitter with a skewed distribution, instead of a key template
+	Keys *KeyDistribution
+}
+
+// ID returns the Name of the emitter qualified by its Group, unique among the emitters of a run
+func (c *Config) ID() string {
+	if c.Group == "" {
+		return c.Name
+	}
+	return c.Group + "/" + c.Name
+}
+
+// DecodeConfigs decodes the groups of emitter configurations of a jrconfig file, as read by viper.
+// The keys are case insensitive, and the durations can be strings such as "1s".
+func DecodeConfigs(input any) (map[string][]Config, error) {
+	var emitters map[string][]Config
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			mapstructure.TextUnmarshallerHookFunc(),
+		),
+		WeaklyTypedInput: true,
+		Result:           &emitters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(input); err != nil {
+		return nil, err
+	}
+	return emitters, nil
+}
+
+// validate checks the Scenario or the Sessions, the Disorder, the Chaos and the Keys of the emitter, if any
+func (c *Config) validate() error {
+	if c.Scenario != nil && c.Sessions != nil {
+		return fmt.Errorf("an emitter can't have both a scenario and sessions")
+	}
+	if c.Keys != nil {
+		if c.KeyTemplate != "" && c.KeyTemplate != NullTemplate {
+			return fmt.Errorf("an emitter can't have both keys and a key template")
+		}
+		if err := c.Keys.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Scenario != nil {
+		if err := c.Scenario.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sessions != nil {
+		if err := c.Sessions.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Disorder != nil {
+		if err := c.Disorder.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Chaos != nil {
+		return c.Chaos.Validate()
+	}
+	return nil
 }
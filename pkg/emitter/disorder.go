@@ -0,0 +1,70 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import "fmt"
+
+// Disorder injects anomalies in the objects of an emitter, to test the stream processors with
+// out-of-order, late and duplicate objects. The objects keep the times they were generated at, and
+// every injected anomaly is marked with a header.
+type Disorder struct {
+	// Reorder is the probability of holding back an object, produced after up to Window next objects
+	Reorder float64
+	Window  int
+	// Late is the probability of delaying an object by a Lateness
+	Late     float64
+	Lateness Delay
+	// Duplicate is the probability of producing an exact copy of an object right after it
+	Duplicate float64
+	// NearDuplicate is the probability of producing a copy of an object with one of its NearFields changed,
+	// or one of its top level string or number fields if not set. Values which are not JSON objects are
+	// copied exactly.
+	NearDuplicate float64
+	NearFields    []string
+}
+
+// Validate checks the probabilities and the bounds of the Disorder
+func (d *Disorder) Validate() error {
+	probabilities := []struct {
+		name  string
+		value float64
+	}{
+		{"reorder", d.Reorder},
+		{"late", d.Late},
+		{"duplicate", d.Duplicate},
+		{"nearDuplicate", d.NearDuplicate},
+	}
+	for _, p := range probabilities {
+		if p.value < 0 || p.value > 1 {
+			return fmt.Errorf("disorder: the %s probability must be between 0 and 1", p.name)
+		}
+	}
+	if d.Reorder+d.Late > 1 {
+		return fmt.Errorf("disorder: the reorder and late probabilities add up to more than 1")
+	}
+	if d.Reorder > 0 && d.Window < 1 {
+		return fmt.Errorf("disorder: reordering needs a window of at least 1 object")
+	}
+	if err := d.Lateness.Validate(); err != nil {
+		return fmt.Errorf("disorder: lateness: %w", err)
+	}
+	return nil
+}
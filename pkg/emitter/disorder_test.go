@@ -0,0 +1,59 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisorderValidate(t *testing.T) {
+	valid := emitter.Disorder{
+		Reorder:       0.1,
+		Window:        10,
+		Late:          0.05,
+		Lateness:      emitter.Delay{Distribution: emitter.ExponentialDelay, Mean: time.Minute},
+		Duplicate:     0.01,
+		NearDuplicate: 0.01,
+	}
+	assert.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		change func(d *emitter.Disorder)
+	}{
+		{"negative probability", func(d *emitter.Disorder) { d.Duplicate = -0.5 }},
+		{"probability over 1", func(d *emitter.Disorder) { d.NearDuplicate = 1.5 }},
+		{"reorder and late over 1", func(d *emitter.Disorder) { d.Reorder, d.Late = 0.6, 0.6 }},
+		{"reorder without window", func(d *emitter.Disorder) { d.Window = 0 }},
+		{"invalid lateness", func(d *emitter.Disorder) { d.Lateness.Distribution = "pareto" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := valid
+			tt.change(&d)
+			assert.Error(t, d.Validate())
+		})
+	}
+}
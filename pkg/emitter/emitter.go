@@ -24,9 +24,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -35,21 +40,46 @@ import (
 	"github.com/jrnd-io/jrv2/pkg/function"
 	"github.com/jrnd-io/jrv2/pkg/jrpc"
 	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 	"github.com/jrnd-io/jrv2/pkg/tpl"
 )
 
 var Emitters map[string][]Config
 
+// NullTemplate disables the key or the header template
+const NullTemplate = "null"
+
+// Throughput is a rate in bytes per second
 type Throughput float64
 
+// UnmarshalText parses a Throughput in the format accepted by ParseThroughput, i.e. 10MB/s
+func (t *Throughput) UnmarshalText(text []byte) error {
+	throughput, err := ParseThroughput(string(text))
+	if err != nil {
+		return err
+	}
+	*t = throughput
+	return nil
+}
+
 type Ticker struct {
 	Type           string
 	ImmediateStart bool
 	Num            int
 	Frequency      time.Duration
 	Duration       time.Duration
-	Throughput     Throughput
-	// Parameters     map[string]any `mapstructure:",remain"`
+	// Throughput limits the bytes per second actually produced
+	Throughput Throughput
+	// RecordRate limits the objects per second actually produced
+	RecordRate float64
+	// Parameters of the Profile selected by Type
+	Parameters map[string]any
+}
+
+// IsLimited returns true if the Ticker limits the produced bytes or objects per second
+func (t Ticker) IsLimited() bool {
+	return t.Throughput > 0 || t.RecordRate > 0
 }
 
 type Emitter struct {
@@ -61,8 +91,26 @@ type Emitter struct {
 	ValueTemplate  *tpl.Tpl
 	HeaderTemplate *tpl.Tpl
 	OutputTemplate *tpl.Tpl
-
-	plugin *plugin.Plugin
+	// StateTemplates are the templates of the states of the Scenario, by state
+	StateTemplates map[string]*Templates
+	// DriftTemplates are the templates of the schema drift of the Chaos
+	DriftTemplates *Templates
+	Profile        Profile
+	// Random is the random stream of the templates, derived from the seed and the emitter name.
+	// It is nil without a seed.
+	Random random.Source
+	// Scope is the state of the templates, created by the loop. Without it the templates use the global one.
+	Scope *state.Scope
+
+	profileTicker *profileTicker
+	plugin        *plugin.Plugin
+	// reloaded holds the templates compiled by Reload, until they are swapped in
+	reloaded atomic.Pointer[Emitter]
+	// started is when the ticker started, in unix nanoseconds
+	started atomic.Int64
+	// lock guards the Config and the tickers, which can be changed while the emitter runs
+	lock     sync.Mutex
+	stopOnce sync.Once
 }
 
 func NewFromConfig(cfg Config) (*Emitter, error) {
@@ -71,18 +119,31 @@ func NewFromConfig(cfg Config) (*Emitter, error) {
 	e := &Emitter{
 		Config:      &cfg,
 		StopChannel: make(chan struct{}),
+		Random:      random.NewStream(cfg.ID()),
 	}
 	log.Debug().Interface("config", cfg).Msg("Creating new emitter from config")
 
 	if err := e.SetTemplates(); err != nil {
 		return nil, err
 	}
+	if err := e.SetProfile(); err != nil {
+		return nil, err
+	}
+	if err := e.Config.OnError.SetDefaults(); err != nil {
+		return nil, fmt.Errorf("emitter %s: %w", e.Config.Name, err)
+	}
+	if e.Config.Workers < 0 {
+		return nil, fmt.Errorf("emitter %s: workers must not be negative", e.Config.Name)
+	}
+	if err := e.Config.validate(); err != nil {
+		return nil, fmt.Errorf("emitter %s: %w", e.Config.Name, err)
+	}
 	return e, nil
 }
 func New(options ...func(*Emitter)) (*Emitter, error) {
 
 	tc := &Ticker{
-		Type:           "simple",
+		Type:           SimpleProfile,
 		ImmediateStart: false,
 		Num:            DefaultNum,
 		Frequency:      DefaultFrequency,
@@ -109,6 +170,7 @@ func New(options ...func(*Emitter)) (*Emitter, error) {
 	for _, option := range options {
 		option(e)
 	}
+	e.Random = random.NewStream(e.Config.ID())
 
 	return e, nil
 }
@@ -117,8 +179,41 @@ func (e *Emitter) SetPlugin(plugin *plugin.Plugin) {
 	e.plugin = plugin
 }
 
+func (e *Emitter) Plugin() *plugin.Plugin {
+	return e.plugin
+}
+
+// SetScope sets the state of the templates, binding to it the functions of the templates already set.
+// The functions draw their random values from the Random stream of the emitter, if seeded.
+func (e *Emitter) SetScope(s *state.Scope) {
+	e.Scope = s
+	s.SetRandom(e.Random)
+	funcs := e.funcs()
+	templates := []*tpl.Tpl{e.ValueTemplate, e.KeyTemplate, e.HeaderTemplate, e.OutputTemplate}
+	if e.DriftTemplates != nil {
+		templates = append(templates, e.DriftTemplates.Key, e.DriftTemplates.Value, e.DriftTemplates.Header)
+	}
+	for _, st := range e.StateTemplates {
+		templates = append(templates, st.Key, st.Value, st.Header)
+	}
+	for _, t := range templates {
+		if t != nil {
+			t.Template.Funcs(funcs)
+		}
+	}
+}
+
+// funcs returns the functions of the templates, bound to the Scope of the emitter
+func (e *Emitter) funcs() map[string]any {
+	if e.Scope == nil {
+		return function.Map()
+	}
+	return function.MapFor(e.Scope)
+}
+
 func (e *Emitter) SetTemplates() error {
 
+	funcs := e.funcs()
 	var vTplText string
 	var err error
 	if e.Config.Embedded {
@@ -129,27 +224,186 @@ func (e *Emitter) SetTemplates() error {
 			return err
 		}
 	}
-	valueTpl, err := tpl.New("value", vTplText, function.Map())
+	valueTpl, err := tpl.New("value", vTplText, funcs)
 	if err != nil {
 		return err
 	}
 	e.ValueTemplate = valueTpl
 
+	if e.KeyTemplate, err = e.newOptionalTemplate("key", e.Config.KeyTemplate, funcs); err != nil {
+		return err
+	}
+	if e.HeaderTemplate, err = e.newOptionalTemplate("header", e.Config.HeaderTemplate, funcs); err != nil {
+		return err
+	}
+
 	if e.Config.OutputTemplate != "" {
 
 		log.Debug().Str("name", e.Config.Name).Str("outputTemplate", e.Config.OutputTemplate).Msg("parsing output template")
-		outputTpl, err := tpl.New("output", e.Config.OutputTemplate, function.Map())
+		outputTpl, err := tpl.New("output", e.Config.OutputTemplate, funcs)
 		if err != nil {
 			return err
 		}
 		e.OutputTemplate = outputTpl
 	}
 
+	if err := e.setStateTemplates(funcs); err != nil {
+		return err
+	}
+	return e.setDriftTemplates(funcs)
+
+}
+
+// setStateTemplates compiles the templates of the states of the Scenario, but the initial one
+func (e *Emitter) setStateTemplates(funcs map[string]any) error {
+	e.StateTemplates = nil
+	if e.Config.Scenario == nil {
+		return nil
+	}
+	e.StateTemplates = make(map[string]*Templates)
+	for name, st := range e.Config.Scenario.States {
+		if st == nil || name == e.Config.Scenario.Initial {
+			continue
+		}
+		text := st.ValueTemplate
+		if !e.Config.Embedded {
+			var err error
+			if text, err = tpl.GetRawTemplate(st.ValueTemplate); err != nil {
+				return fmt.Errorf("state %s: %w", name, err)
+			}
+		}
+		t := &Templates{}
+		var err error
+		if t.Value, err = tpl.New(name+".value", text, funcs); err != nil {
+			return fmt.Errorf("state %s: %w", name, err)
+		}
+		if t.Key, err = e.newOptionalTemplate(name+".key", st.KeyTemplate, funcs); err != nil {
+			return fmt.Errorf("state %s: %w", name, err)
+		}
+		if t.Header, err = e.newOptionalTemplate(name+".header", st.HeaderTemplate, funcs); err != nil {
+			return fmt.Errorf("state %s: %w", name, err)
+		}
+		e.StateTemplates[name] = t
+	}
 	return nil
+}
 
+// Reload compiles the templates of cfg, i.e. after the template files or the configuration changed,
+// to be swapped in by SwapTemplates at the next tick. If they don't parse, an error is returned and
+// the current templates are kept.
+func (e *Emitter) Reload(cfg Config) error {
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("emitter %s: %w", e.Config.Name, err)
+	}
+	next := &Emitter{Config: &cfg, Scope: e.Scope}
+	if err := next.SetTemplates(); err != nil {
+		return fmt.Errorf("emitter %s: %w", e.Config.Name, err)
+	}
+	e.reloaded.Store(next)
+	return nil
+}
+
+// Unswappable returns the settings of next differing from the ones of c which are not swapped in by
+// SwapTemplates, so that the emitter must be restarted to change them
+func (c Config) Unswappable(next Config) []string {
+	// the error policies are compared with their defaults, as set when the emitter is created
+	onError, nextOnError := c.OnError, next.OnError
+	_ = onError.SetDefaults()
+	_ = nextOnError.SetDefaults()
+
+	var settings []string
+	for _, s := range []struct {
+		name    string
+		changed bool
+	}{
+		{"profile", c.Tick.Type != next.Tick.Type || !reflect.DeepEqual(c.Tick.Parameters, next.Tick.Parameters)},
+		{"immediateStart", c.Tick.ImmediateStart != next.Tick.ImmediateStart},
+		{"duration", c.Tick.Duration != next.Tick.Duration},
+		{"throughput", c.Tick.Throughput != next.Tick.Throughput},
+		{"recordRate", c.Tick.RecordRate != next.Tick.RecordRate},
+		{"preload", c.Preload != next.Preload},
+		{"locale", c.Locale != next.Locale},
+		{"output", c.Output != next.Output},
+		{"topic", c.Topic != next.Topic},
+		{"configParameters", !maps.Equal(c.ConfigParameters, next.ConfigParameters)},
+		{"dependsOn", !slices.Equal(c.DependsOn, next.DependsOn)},
+		{"onError", !reflect.DeepEqual(onError, nextOnError)},
+		{"workers", c.Workers != next.Workers},
+		{"ordered", c.Ordered != next.Ordered},
+		{"disorder", !reflect.DeepEqual(c.Disorder, next.Disorder)},
+	} {
+		if s.changed {
+			settings = append(settings, s.name)
+		}
+	}
+	return settings
+}
+
+// SwapTemplates sets the templates compiled by the last Reload, with their configuration and the Num
+// and the Frequency of the reloaded configuration. It returns false if there was nothing to swap.
+// It must be called between the ticks, when no object is being generated.
+func (e *Emitter) SwapTemplates() bool {
+	next := e.reloaded.Swap(nil)
+	if next == nil {
+		return false
+	}
+	e.KeyTemplate = next.KeyTemplate
+	e.ValueTemplate = next.ValueTemplate
+	e.HeaderTemplate = next.HeaderTemplate
+	e.OutputTemplate = next.OutputTemplate
+	e.StateTemplates = next.StateTemplates
+	e.DriftTemplates = next.DriftTemplates
+
+	cfg := next.Config
+	e.lock.Lock()
+	e.Config.Scenario = cfg.Scenario
+	e.Config.Sessions = cfg.Sessions
+	e.Config.Chaos = cfg.Chaos
+	e.Config.Keys = cfg.Keys
+	e.Config.Embedded = cfg.Embedded
+	e.Config.KeyTemplate = cfg.KeyTemplate
+	e.Config.ValueTemplate = cfg.ValueTemplate
+	e.Config.HeaderTemplate = cfg.HeaderTemplate
+	e.Config.OutputTemplate = cfg.OutputTemplate
+	e.Config.Oneline = cfg.Oneline
+
+	// the ticker is reset only if the frequency changed
+	frequency := cfg.Tick.Frequency
+	if tick := e.Config.Tick; !tick.IsSimple() || frequency == tick.Frequency {
+		frequency = 0
+	}
+	e.lock.Unlock()
+	if err := e.Retune(cfg.Tick.Num, frequency); err != nil {
+		log.Warn().Err(err).Str("emitter", e.Config.Name).Msg("error in retuning reloaded emitter")
+	}
+	return true
+}
+
+// newOptionalTemplate compiles t, the embedded template text if the emitter is Embedded, otherwise
+// an inline text if it has an action, or the name of a template in the templates dirs, failing if
+// there is no such template. An empty or NullTemplate t returns a nil template.
+func (e *Emitter) newOptionalTemplate(name string, t string, funcs map[string]any) (*tpl.Tpl, error) {
+	if t == "" || t == NullTemplate {
+		return nil, nil
+	}
+
+	text := t
+	if !e.Config.Embedded {
+		var err error
+		if text, err = tpl.GetRawTemplateOrText(t); err != nil {
+			return nil, fmt.Errorf("%s template %s of emitter %s not found: %w", name, t, e.Config.Name, err)
+		}
+	}
+	log.Debug().Str("name", e.Config.Name).Str(name+"Template", t).Msg("parsing " + name + " template")
+	return tpl.New(name, text, funcs)
 }
 
 func (e *Emitter) Produce(ctx context.Context, key []byte, value []byte, headers map[string]string, configParams map[string]string) (*jrpc.ProduceResponse, error) {
+	return e.ProduceTo(ctx, e.plugin, key, value, headers, configParams)
+}
+
+// ProduceTo produces an object of the emitter to the output p, formatted as the objects of the emitter
+func (e *Emitter) ProduceTo(ctx context.Context, p *plugin.Plugin, key []byte, value []byte, headers map[string]string, configParams map[string]string) (*jrpc.ProduceResponse, error) {
 
 	sValue := string(value)
 	kValue := string(key)
@@ -162,21 +416,170 @@ func (e *Emitter) Produce(ctx context.Context, key []byte, value []byte, headers
 			V string
 			H map[string]string
 		}{kValue, string(value), headers}
-		sValue = e.OutputTemplate.ExecuteWith(data)
+		var err error
+		if sValue, err = e.OutputTemplate.ExecuteWith(data); err != nil {
+			return nil, err
+		}
 	}
 
 	if e.Config.Oneline {
 		sValue = strings.ReplaceAll(sValue, "\n", "")
 		sValue = strings.ReplaceAll(sValue, "\r", "")
 	}
-	if e.plugin == nil {
+	if p == nil {
 		return nil, errors.New("emitter plugin not initialized")
 	}
-	return e.plugin.Produce(ctx, key, []byte(sValue), headers, configParams)
+	return p.Produce(ctx, key, []byte(sValue), headers, configParams)
 }
 
+// SetProfile creates the Profile selected by the Ticker Type. Simple tickers need no Profile.
+func (e *Emitter) SetProfile() error {
+	if e.Config.Tick.IsSimple() {
+		e.Profile = nil
+		return nil
+	}
+	p, err := NewProfile(e.Config.Tick)
+	if err != nil {
+		return fmt.Errorf("emitter %s: %w", e.Config.Name, err)
+	}
+	// the random profiles have their own stream, as they don't tick in the order of the renders
+	if r, ok := p.(randomProfile); ok {
+		if stream := random.NewStream(e.Config.ID() + "/profile"); stream != nil {
+			r.setRandom(stream)
+		}
+	}
+	e.Profile = p
+	return nil
+}
+
+// IsOneShot returns true if the emitter has no ticker and generates its objects just once
+func (e *Emitter) IsOneShot() bool {
+	tick := e.Config.Tick
+	if !tick.IsSimple() {
+		return false
+	}
+	if tick.IsLimited() {
+		return tick.Num <= 0
+	}
+	return tick.Frequency <= 0
+}
+
+// unlimited is always ready to be received from
+var unlimited = func() chan time.Time {
+	c := make(chan time.Time)
+	close(c)
+	return c
+}()
+
+// StartTicker starts the ticker of the emitter. A simple ticker with a Throughput or a RecordRate
+// ignores the Frequency and ticks continuously: the pace is given by the limits.
+// The Frequency and the Profile follow the clock of the run, which can flow faster than the real time.
 func (e *Emitter) StartTicker() {
-	e.Ticker = t.NewUTicker(t.WithFrequency(e.Config.Tick.Frequency))
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.started.Store(time.Now().UnixNano())
+	clock := state.GetSharedState().Execution.Clock()
+	if e.Config.Tick.IsSimple() {
+		if e.Config.Tick.IsLimited() {
+			return
+		}
+		e.Ticker = t.NewUTicker(
+			t.WithFrequency(clock.Real(e.Config.Tick.Frequency)),
+			t.WithImmediateStart(e.Config.Tick.ImmediateStart))
+		return
+	}
+	e.profileTicker = newProfileTicker(e.Profile, e.Config.Tick.ImmediateStart, clock)
+}
+
+// Step returns the wait before the next tick, from the elapsed time since the first one, as the
+// ticker would do. It is used to tick on a stepped clock: when ok is false no tick is due after wait.
+func (e *Emitter) Step(elapsed time.Duration) (wait time.Duration, ok bool) {
+	tick := e.Tick()
+	if tick.IsSimple() {
+		return tick.Frequency, true
+	}
+	return e.Profile.Next(elapsed)
+}
+
+// Ticks returns the channel receiving the ticks of the started ticker
+func (e *Emitter) Ticks() <-chan time.Time {
+	if e.profileTicker != nil {
+		return e.profileTicker.C
+	}
+	if e.Ticker != nil {
+		return e.Ticker.C
+	}
+	return unlimited
+}
+
+// TargetRate returns the objects per second the emitter is currently aiming at,
+// or 0 if the ticker is not started or the rate is unknown
+func (e *Emitter) TargetRate() float64 {
+	started := e.started.Load()
+	if started == 0 {
+		return 0
+	}
+	tick := e.Tick()
+
+	rate := 0.0
+	switch {
+	case !tick.IsSimple():
+		if r, ok := e.Profile.(Rater); ok {
+			rate = r.Rate(time.Since(time.Unix(0, started)))
+		}
+	case !tick.IsLimited() && tick.Frequency > 0:
+		rate = float64(tick.Num) / tick.Frequency.Seconds()
+	}
+	if tick.RecordRate > 0 && (rate == 0 || tick.RecordRate < rate) {
+		rate = tick.RecordRate
+	}
+	return rate
+}
+
+// Tick returns a copy of the Ticker configuration, which can be changed by Retune while the emitter runs
+func (e *Emitter) Tick() Ticker {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.Config.Tick
+}
+
+// Retune changes the Num and the Frequency of the emitter, also while it runs.
+// Non positive values leave the current ones unchanged.
+func (e *Emitter) Retune(num int, frequency time.Duration) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if frequency > 0 && !e.Config.Tick.IsSimple() {
+		return fmt.Errorf("emitter %s: frequency can't be changed with the %s ticker type", e.Config.Name, e.Config.Tick.Type)
+	}
+	if num > 0 {
+		e.Config.Tick.Num = num
+	}
+	if frequency > 0 {
+		e.Config.Tick.Frequency = frequency
+		if e.Ticker != nil {
+			e.Ticker.Reset(state.GetSharedState().Execution.Clock().Real(frequency))
+		}
+	}
+	return nil
+}
+
+// Stop signals the emitter to stop through the StopChannel. It can be called more than once.
+func (e *Emitter) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.StopChannel)
+	})
+}
+
+func (e *Emitter) StopTicker() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.started.Store(0)
+	if e.Ticker != nil {
+		e.Ticker.Stop()
+	}
+	if e.profileTicker != nil {
+		e.profileTicker.Stop()
+	}
 }
 
 func WithName(n string) func(*Emitter) {
@@ -209,6 +612,13 @@ func WithImmediateStart(i bool) func(*Emitter) {
 	}
 }
 
+func WithProfile(p string, parameters map[string]any) func(*Emitter) {
+	return func(e *Emitter) {
+		e.Config.Tick.Type = p
+		e.Config.Tick.Parameters = parameters
+	}
+}
+
 func WithNum(n int) func(*Emitter) {
 	if n < 1 {
 		log.Warn().Msg("Num should be at least 1, setting to default")
@@ -240,6 +650,12 @@ func WithThroughput(t string) func(*Emitter) {
 	}
 }
 
+func WithRecordRate(r float64) func(*Emitter) {
+	return func(e *Emitter) {
+		e.Config.Tick.RecordRate = r
+	}
+}
+
 func WithDuration(d time.Duration) func(*Emitter) {
 	if d <= 0 {
 		log.Warn().Msg("Duration is <=0, setting to default")
@@ -260,6 +676,25 @@ func WithPreload(n int) func(*Emitter) {
 	}
 }
 
+func WithErrorPolicy(p ErrorPolicy) func(*Emitter) {
+	return func(e *Emitter) {
+		e.Config.OnError = p
+	}
+}
+
+func WithWorkers(n int, ordered bool) func(*Emitter) {
+	return func(e *Emitter) {
+		e.Config.Workers = n
+		e.Config.Ordered = ordered
+	}
+}
+
+func WithDependsOn(d ...string) func(*Emitter) {
+	return func(e *Emitter) {
+		e.Config.DependsOn = d
+	}
+}
+
 func WithKeyTemplate(k string) func(*Emitter) {
 	return func(e *Emitter) {
 		e.Config.KeyTemplate = k
@@ -2,11 +2,14 @@ package emitter_test
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/jrnd-io/jrv2/pkg/config"
 	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/tpl"
 
 	//	"github.com/jrnd-io/jrv2/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -38,6 +41,15 @@ func TestParseThroughput(t *testing.T) {
 	})
 }
 
+func TestThroughputUnmarshalText(t *testing.T) {
+	var throughput emitter.Throughput
+	if err := throughput.UnmarshalText([]byte("2KB/s")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, emitter.Throughput(2048), throughput)
+	assert.Error(t, throughput.UnmarshalText([]byte("fast")))
+}
+
 func TestNewEmitter(t *testing.T) {
 	t.Run("Default values", func(t *testing.T) {
 		em, err := emitter.New()
@@ -110,3 +122,210 @@ func TestNewEmitter(t *testing.T) {
 		assert.Equal(t, customDuration, em.Config.Tick.Duration)
 	})
 }
+
+func TestSetTemplates(t *testing.T) {
+	t.Run("Null key and header templates", func(t *testing.T) {
+		em, err := emitter.NewFromConfig(emitter.Config{
+			Name:           "null_templates",
+			ValueTemplate:  "{{\"value\"}}",
+			KeyTemplate:    emitter.NullTemplate,
+			HeaderTemplate: emitter.NullTemplate,
+			Embedded:       true,
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, em.ValueTemplate)
+		assert.Nil(t, em.KeyTemplate)
+		assert.Nil(t, em.HeaderTemplate)
+	})
+
+	t.Run("Embedded key and header templates", func(t *testing.T) {
+		em, err := emitter.NewFromConfig(emitter.Config{
+			Name:           "embedded_templates",
+			ValueTemplate:  "{{\"value\"}}",
+			KeyTemplate:    "{{\"key\"}}",
+			HeaderTemplate: `{"h1":"{{"header"}}"}`,
+			Embedded:       true,
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, em.KeyTemplate)
+		assert.NotNil(t, em.HeaderTemplate)
+		assert.Equal(t, "key", execute(t, em.KeyTemplate))
+		assert.Equal(t, `{"h1":"header"}`, execute(t, em.HeaderTemplate))
+	})
+
+	t.Run("Invalid key template", func(t *testing.T) {
+		_, err := emitter.NewFromConfig(emitter.Config{
+			Name:          "invalid_key",
+			ValueTemplate: "{{\"value\"}}",
+			KeyTemplate:   "{{\"key\"",
+			Embedded:      true,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Key and header template files", func(t *testing.T) {
+		userDir := config.JrUserDir
+		defer func() { config.JrUserDir = userDir }()
+		config.JrUserDir = t.TempDir()
+		templatesDir := filepath.Join(config.JrUserDir, "templates")
+		if err := os.MkdirAll(templatesDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for name, text := range map[string]string{"value": "{{\"value\"}}", "key": "{{\"key\"}}"} {
+			if err := os.WriteFile(filepath.Join(templatesDir, name+".tpl"), []byte(text), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		em, err := emitter.NewFromConfig(emitter.Config{
+			Name:          "template_files",
+			ValueTemplate: "value",
+			KeyTemplate:   "key",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "key", execute(t, em.KeyTemplate))
+
+		// the key and header templates with an action are inline text, also with a named value template
+		em, err = emitter.NewFromConfig(emitter.Config{
+			Name:           "inline_templates",
+			ValueTemplate:  "value",
+			KeyTemplate:    "{{\"inline key\"}}",
+			HeaderTemplate: "{{\"inline header\"}}",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "inline key", execute(t, em.KeyTemplate))
+		assert.Equal(t, "inline header", execute(t, em.HeaderTemplate))
+
+		// a misspelled template name is not taken as literal text
+		_, err = emitter.NewFromConfig(emitter.Config{
+			Name:           "missing_template",
+			ValueTemplate:  "value",
+			HeaderTemplate: "missing",
+		})
+		assert.ErrorContains(t, err, "header template missing of emitter missing_template not found")
+	})
+}
+
+func TestRetune(t *testing.T) {
+	e, err := emitter.NewFromConfig(emitter.Config{
+		Name:          "retune",
+		Tick:          emitter.Ticker{Num: 1, Frequency: time.Hour},
+		ValueTemplate: "v",
+		Embedded:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.StartTicker()
+	defer e.StopTicker()
+
+	if err := e.Retune(3, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, e.Tick().Num)
+	select {
+	case <-e.Ticks():
+	case <-time.After(time.Second):
+		t.Fatal("the retuned frequency is not applied")
+	}
+
+	e.Stop()
+	e.Stop()
+	_, open := <-e.StopChannel
+	assert.False(t, open)
+
+	profile, err := emitter.NewFromConfig(emitter.Config{
+		Name:          "profile",
+		Tick:          emitter.Ticker{Type: emitter.PoissonProfile, Num: 1, Parameters: map[string]any{"rate": 1}},
+		ValueTemplate: "v",
+		Embedded:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, profile.Retune(0, time.Second))
+	assert.NoError(t, profile.Retune(2, 0))
+}
+
+func TestReload(t *testing.T) {
+	cfg := emitter.Config{
+		Name:          "reload",
+		Tick:          emitter.Ticker{Num: 1, Frequency: time.Hour},
+		ValueTemplate: "v1",
+		Embedded:      true,
+	}
+	e, err := emitter.NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, e.SwapTemplates())
+
+	cfg.ValueTemplate = "v2"
+	cfg.KeyTemplate = "k2"
+	cfg.Tick.Num = 5
+	assert.NoError(t, e.Reload(cfg))
+	// the templates are swapped in only by SwapTemplates
+	assert.Equal(t, "v1", execute(t, e.ValueTemplate))
+	assert.True(t, e.SwapTemplates())
+	assert.Equal(t, "v2", execute(t, e.ValueTemplate))
+	assert.Equal(t, "k2", execute(t, e.KeyTemplate))
+	assert.Equal(t, 5, e.Tick().Num)
+	assert.Equal(t, "v2", e.Config.ValueTemplate)
+
+	cfg.ValueTemplate = "{{v3"
+	assert.Error(t, e.Reload(cfg))
+	assert.False(t, e.SwapTemplates())
+	assert.Equal(t, "v2", execute(t, e.ValueTemplate))
+}
+
+// execute executes the template tp without data, failing the test on errors
+func execute(t *testing.T, tp *tpl.Tpl) string {
+	t.Helper()
+	s, err := tp.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestErrorPolicySetDefaults(t *testing.T) {
+	policy := emitter.ErrorPolicy{}
+	assert.NoError(t, policy.SetDefaults())
+	assert.Equal(t, emitter.SkipOnError, policy.Action)
+	assert.Equal(t, 0, policy.Retries)
+	assert.Equal(t, 1, policy.MaxErrors)
+	assert.False(t, policy.Stops())
+
+	policy = emitter.ErrorPolicy{Action: emitter.RetryOnError}
+	assert.NoError(t, policy.SetDefaults())
+	assert.Equal(t, emitter.DefaultRetries, policy.Retries)
+	assert.Equal(t, emitter.DefaultBackoff, policy.Backoff)
+	assert.Equal(t, emitter.DefaultMaxBackoff, policy.MaxBackoff)
+
+	policy = emitter.ErrorPolicy{Action: emitter.AbortOnError, MaxErrors: 5}
+	assert.NoError(t, policy.SetDefaults())
+	assert.Equal(t, 5, policy.MaxErrors)
+	assert.True(t, policy.Stops())
+
+	policy = emitter.ErrorPolicy{Action: emitter.DeadLetterOnError}
+	assert.Error(t, policy.SetDefaults())
+	policy = emitter.ErrorPolicy{Action: "ignore"}
+	assert.Error(t, policy.SetDefaults())
+	policy = emitter.ErrorPolicy{Action: emitter.FailOnError, MaxErrors: -1}
+	assert.Error(t, policy.SetDefaults())
+}
+
+func TestUnswappable(t *testing.T) {
+	cfg := emitter.Config{Name: "swap", ValueTemplate: "v", Tick: emitter.Ticker{Num: 1, Frequency: time.Second}}
+	next := cfg
+	next.ValueTemplate = "w"
+	next.Tick.Num = 2
+	next.Tick.Frequency = time.Millisecond
+	next.OnError = emitter.ErrorPolicy{Action: emitter.SkipOnError}
+	assert.Empty(t, cfg.Unswappable(next))
+
+	next.Tick.Throughput = 1024
+	next.Workers = 4
+	next.Disorder = &emitter.Disorder{Late: 0.1}
+	assert.Equal(t, []string{"throughput", "workers", "disorder"}, cfg.Unswappable(next))
+}
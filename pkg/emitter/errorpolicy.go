@@ -0,0 +1,97 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Actions of an ErrorPolicy, applied when an object can't be generated or produced
+const (
+	// SkipOnError logs the error and goes on with the next object
+	SkipOnError = "skip"
+	// RetryOnError retries to produce the object with an exponential backoff, then skips it
+	RetryOnError = "retry"
+	// DeadLetterOnError sends the object to the DeadLetter output
+	DeadLetterOnError = "deadletter"
+	// FailOnError stops the emitter after MaxErrors consecutive errors
+	FailOnError = "fail"
+	// AbortOnError stops all the emitters after MaxErrors consecutive errors
+	AbortOnError = "abort"
+
+	DefaultRetries    = 3
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// ErrorPolicy tells what to do when an object can't be generated or produced.
+// Failed produces are retried Retries times before applying the Action, waiting Backoff
+// and doubling it at every retry up to MaxBackoff. Template errors are never retried.
+type ErrorPolicy struct {
+	Action     string
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxErrors is the number of consecutive errors stopping the emitter or all the emitters
+	MaxErrors int
+	// DeadLetter is the output receiving the failed objects, with DeadLetterParameters
+	DeadLetter           string
+	DeadLetterParameters map[string]string
+}
+
+// SetDefaults validates the ErrorPolicy and sets the defaults of the missing values
+func (p *ErrorPolicy) SetDefaults() error {
+	switch p.Action {
+	case "":
+		p.Action = SkipOnError
+	case RetryOnError:
+		if p.Retries == 0 {
+			p.Retries = DefaultRetries
+		}
+	case DeadLetterOnError:
+		if p.DeadLetter == "" {
+			return fmt.Errorf("the %s error policy needs a deadLetter output", DeadLetterOnError)
+		}
+	case SkipOnError, FailOnError, AbortOnError:
+	default:
+		return fmt.Errorf("unknown error policy %q", p.Action)
+	}
+
+	if p.Retries < 0 || p.MaxErrors < 0 {
+		return fmt.Errorf("retries and maxErrors of the error policy must not be negative")
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.MaxErrors == 0 {
+		p.MaxErrors = 1
+	}
+	return nil
+}
+
+// Stops returns true if the Action stops the emitter after MaxErrors consecutive errors
+func (p ErrorPolicy) Stops() bool {
+	return p.Action == FailOnError || p.Action == AbortOnError
+}
@@ -0,0 +1,92 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+)
+
+// Distributions of the Keys of an emitter
+const (
+	// UniformKeys draws every key with the same probability
+	UniformKeys = "uniform"
+	// ZipfKeys draws the key i with a probability proportional to 1/(i+1)^Exponent
+	ZipfKeys = "zipf"
+	// PowerLawKeys draws the keys from a power law of Exponent, without a table of the probabilities
+	PowerLawKeys = "powerlaw"
+	// HotSetKeys draws one of the first HotKeys with probability HotShare, and one of the others otherwise
+	HotSetKeys = "hotset"
+)
+
+// KeyDistribution generates the keys of the objects of an emitter instead of a key template, drawing
+// them from a number of distinct Keys with a skewed Distribution, i.e. to reproduce hot partitions and
+// skewed joins. The keys are the Prefix followed by their index, the most frequent ones first, and the
+// templates read the key of the object as .Key.
+type KeyDistribution struct {
+	Distribution string
+	Keys         int
+	Prefix       string
+	Exponent     float64
+	HotKeys      int
+	HotShare     float64
+}
+
+// Validate checks the parameters of the Distribution of the keys
+func (k *KeyDistribution) Validate() error {
+	if k.Keys < 1 {
+		return fmt.Errorf("keys: the number of keys must be at least 1")
+	}
+	switch k.Distribution {
+	case "", UniformKeys:
+	case ZipfKeys, PowerLawKeys:
+		if k.Exponent <= 0 {
+			return fmt.Errorf("keys: the %s distribution needs a positive exponent", k.Distribution)
+		}
+	case HotSetKeys:
+		if k.HotKeys < 1 || k.HotKeys > k.Keys {
+			return fmt.Errorf("keys: the hot keys must be between 1 and the number of keys")
+		}
+		if k.HotShare < 0 || k.HotShare > 1 {
+			return fmt.Errorf("keys: the hot share must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("keys: unknown distribution %q", k.Distribution)
+	}
+	return nil
+}
+
+// Next draws a key from the Distribution, uniform if not set
+func (k *KeyDistribution) Next(r random.Source) string {
+	var i int
+	switch k.Distribution {
+	case ZipfKeys:
+		i = random.ZipfIndex(r, k.Keys, k.Exponent)
+	case PowerLawKeys:
+		i = random.PowerLawIndex(r, k.Keys, k.Exponent)
+	case HotSetKeys:
+		i = random.HotSetIndex(r, k.Keys, k.HotKeys, k.HotShare)
+	default:
+		i = r.IntN(k.Keys)
+	}
+	return fmt.Sprintf("%s%d", k.Prefix, i)
+}
@@ -0,0 +1,89 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyDistributionValidate(t *testing.T) {
+	valid := []emitter.KeyDistribution{
+		{Keys: 10},
+		{Distribution: emitter.UniformKeys, Keys: 1},
+		{Distribution: emitter.ZipfKeys, Keys: 100, Exponent: 0.8},
+		{Distribution: emitter.PowerLawKeys, Keys: 1000000, Exponent: 2},
+		{Distribution: emitter.HotSetKeys, Keys: 100, HotKeys: 3, HotShare: 0.9},
+	}
+	for _, k := range valid {
+		assert.NoError(t, k.Validate(), "%+v", k)
+	}
+
+	invalid := []emitter.KeyDistribution{
+		{},
+		{Distribution: "normal", Keys: 10},
+		{Distribution: emitter.ZipfKeys, Keys: 10},
+		{Distribution: emitter.PowerLawKeys, Keys: 10, Exponent: -1},
+		{Distribution: emitter.HotSetKeys, Keys: 10, HotShare: 0.5},
+		{Distribution: emitter.HotSetKeys, Keys: 10, HotKeys: 11, HotShare: 0.5},
+		{Distribution: emitter.HotSetKeys, Keys: 10, HotKeys: 1, HotShare: 1.5},
+	}
+	for _, k := range invalid {
+		assert.Error(t, k.Validate(), "%+v", k)
+	}
+
+	_, err := emitter.NewFromConfig(emitter.Config{
+		Name:          "both",
+		ValueTemplate: "{{.Key}}",
+		KeyTemplate:   `{{key "KEY" 10}}`,
+		Embedded:      true,
+		Output:        "stdout",
+		Keys:          &emitter.KeyDistribution{Keys: 10},
+	})
+	assert.Error(t, err)
+}
+
+func TestKeyDistributionNext(t *testing.T) {
+	random.SetRandom(0)
+	const n = 10000
+	zipf := &emitter.KeyDistribution{Distribution: emitter.ZipfKeys, Keys: 50, Prefix: "customer-", Exponent: 1.2}
+	hot := &emitter.KeyDistribution{Distribution: emitter.HotSetKeys, Keys: 50, Prefix: "customer-", HotKeys: 1, HotShare: 0.5}
+	uniform := &emitter.KeyDistribution{Keys: 5, Prefix: "customer-"}
+	zipfCounts := make(map[string]int)
+	hotCounts := make(map[string]int)
+	uniformCounts := make(map[string]int)
+	for range n {
+		zipfCounts[zipf.Next(random.Random)]++
+		hotCounts[hot.Next(random.Random)]++
+		uniformCounts[uniform.Next(random.Random)]++
+	}
+	assert.LessOrEqual(t, len(zipfCounts), 50)
+	assert.Greater(t, zipfCounts["customer-0"], zipfCounts["customer-1"])
+	assert.Greater(t, zipfCounts["customer-1"], zipfCounts["customer-10"])
+	assert.InDelta(t, n/2, hotCounts["customer-0"], 300)
+	assert.Len(t, uniformCounts, 5)
+	for _, c := range uniformCounts {
+		assert.InDelta(t, n/5, c, 300)
+	}
+}
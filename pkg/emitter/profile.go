@@ -0,0 +1,448 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
+)
+
+const (
+	SimpleProfile  = "simple"
+	RampProfile    = "ramp"
+	StepProfile    = "step"
+	SineProfile    = "sine"
+	DiurnalProfile = "diurnal"
+	BurstProfile   = "burst"
+	PoissonProfile = "poisson"
+
+	// checkInterval is the longest wait before the rate of a profile is checked again
+	checkInterval = 100 * time.Millisecond
+)
+
+// Profile shapes the traffic of an emitter over time.
+// Next returns how long to wait, from the elapsed time since the ticker started, before the next tick.
+// When ok is false no tick is due: the profile is asked again after wait.
+type Profile interface {
+	Next(elapsed time.Duration) (wait time.Duration, ok bool)
+}
+
+// Rater is implemented by the profiles knowing their target rate in objects per second at elapsed
+type Rater interface {
+	Rate(elapsed time.Duration) float64
+}
+
+// randomProfile is implemented by the profiles drawing random numbers, to get the stream of their emitter
+type randomProfile interface {
+	setRandom(r random.Source)
+}
+
+// ProfileFactory creates a Profile from the Ticker configuration and its Parameters
+type ProfileFactory func(tick Ticker) (Profile, error)
+
+var profiles = map[string]ProfileFactory{}
+
+func init() {
+	RegisterProfile(RampProfile, newRampProfile)
+	RegisterProfile(StepProfile, newStepProfile)
+	RegisterProfile(SineProfile, newSineProfile)
+	RegisterProfile(DiurnalProfile, newSineProfile)
+	RegisterProfile(BurstProfile, newBurstProfile)
+	RegisterProfile(PoissonProfile, newPoissonProfile)
+}
+
+// RegisterProfile makes a profile available to the emitters with Ticker.Type name
+func RegisterProfile(name string, factory ProfileFactory) {
+	profiles[name] = factory
+}
+
+// NewProfile returns the Profile for the Ticker.Type of tick
+func NewProfile(tick Ticker) (Profile, error) {
+	factory, ok := profiles[tick.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown ticker type %q", tick.Type)
+	}
+	return factory(tick)
+}
+
+// IsSimple returns true if the Ticker ticks at the fixed Frequency
+func (t Ticker) IsSimple() bool {
+	return t.Type == "" || t.Type == SimpleProfile
+}
+
+// rateProfile emits Num objects at every tick, pacing the ticks to follow rate,
+// expressed in objects per second. The rate is integrated in steps of at most
+// checkInterval, so that slow or changing rates are followed closely.
+type rateProfile struct {
+	num    int
+	rate   func(elapsed time.Duration) float64
+	credit float64
+}
+
+func (p *rateProfile) Rate(elapsed time.Duration) float64 {
+	return max(p.rate(elapsed), 0)
+}
+
+func (p *rateProfile) Next(elapsed time.Duration) (time.Duration, bool) {
+	r := p.rate(elapsed)
+	if r <= 0 {
+		return checkInterval, false
+	}
+
+	missing := float64(max(p.num, 1)) - p.credit
+	wait := time.Duration(missing / r * float64(time.Second))
+	if wait > checkInterval {
+		p.credit += r * checkInterval.Seconds()
+		return checkInterval, false
+	}
+	p.credit = 0
+	return wait, true
+}
+
+// ramp changes linearly the rate from "from" to "to" during "over", then keeps it at "to"
+func newRampProfile(tick Ticker) (Profile, error) {
+	from, err := floatParameter(tick.Parameters, "from", 0)
+	if err != nil {
+		return nil, err
+	}
+	to, err := floatParameter(tick.Parameters, "to", 0)
+	if err != nil {
+		return nil, err
+	}
+	over, err := durationParameter(tick.Parameters, "over", 0)
+	if err != nil {
+		return nil, err
+	}
+	if over <= 0 {
+		return nil, fmt.Errorf("%s profile: over must be positive", RampProfile)
+	}
+
+	return &rateProfile{
+		num: tick.Num,
+		rate: func(elapsed time.Duration) float64 {
+			if elapsed >= over {
+				return to
+			}
+			return from + (to-from)*float64(elapsed)/float64(over)
+		},
+	}, nil
+}
+
+// step keeps each of the "rates" for "every", optionally starting over when "repeat" is true
+func newStepProfile(tick Ticker) (Profile, error) {
+	rates, err := floatsParameter(tick.Parameters, "rates")
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%s profile: rates must not be empty", StepProfile)
+	}
+	every, err := durationParameter(tick.Parameters, "every", 0)
+	if err != nil {
+		return nil, err
+	}
+	if every <= 0 {
+		return nil, fmt.Errorf("%s profile: every must be positive", StepProfile)
+	}
+	repeat, err := boolParameter(tick.Parameters, "repeat", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateProfile{
+		num: tick.Num,
+		rate: func(elapsed time.Duration) float64 {
+			step := int(elapsed / every)
+			if repeat {
+				step %= len(rates)
+			}
+			if step >= len(rates) {
+				step = len(rates) - 1
+			}
+			return rates[step]
+		},
+	}, nil
+}
+
+// sine oscillates the rate between "min" and "max" with the given "period",
+// which is 24h by default to simulate a diurnal traffic. The rate starts at
+// "min", shifted by "phase" if set.
+func newSineProfile(tick Ticker) (Profile, error) {
+	lowest, err := floatParameter(tick.Parameters, "min", 0)
+	if err != nil {
+		return nil, err
+	}
+	highest, err := floatParameter(tick.Parameters, "max", 0)
+	if err != nil {
+		return nil, err
+	}
+	period, err := durationParameter(tick.Parameters, "period", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	phase, err := durationParameter(tick.Parameters, "phase", 0)
+	if err != nil {
+		return nil, err
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("%s profile: period must be positive", tick.Type)
+	}
+
+	return &rateProfile{
+		num: tick.Num,
+		rate: func(elapsed time.Duration) float64 {
+			angle := 2 * math.Pi * float64(elapsed+phase) / float64(period)
+			return lowest + (highest-lowest)*(1-math.Cos(angle))/2
+		},
+	}, nil
+}
+
+// burst keeps the base "rate", switching to "burstRate" for "burstFor" at every "burstEvery"
+func newBurstProfile(tick Ticker) (Profile, error) {
+	rate, err := floatParameter(tick.Parameters, "rate", 0)
+	if err != nil {
+		return nil, err
+	}
+	burstRate, err := floatParameter(tick.Parameters, "burstRate", 0)
+	if err != nil {
+		return nil, err
+	}
+	burstEvery, err := durationParameter(tick.Parameters, "burstEvery", 0)
+	if err != nil {
+		return nil, err
+	}
+	burstFor, err := durationParameter(tick.Parameters, "burstFor", 0)
+	if err != nil {
+		return nil, err
+	}
+	if burstEvery <= 0 || burstFor <= 0 || burstFor > burstEvery {
+		return nil, fmt.Errorf("%s profile: burstFor and burstEvery must be positive, with burstFor <= burstEvery", BurstProfile)
+	}
+
+	return &rateProfile{
+		num: tick.Num,
+		rate: func(elapsed time.Duration) float64 {
+			if elapsed%burstEvery >= burstEvery-burstFor {
+				return burstRate
+			}
+			return rate
+		},
+	}, nil
+}
+
+// poissonProfile emits ticks as a Poisson process: the waits between ticks are
+// exponentially distributed, with an average "rate" of objects per second
+type poissonProfile struct {
+	rate   float64
+	mean   float64
+	random random.Source
+}
+
+func newPoissonProfile(tick Ticker) (Profile, error) {
+	rate, err := floatParameter(tick.Parameters, "rate", 0)
+	if err != nil {
+		return nil, err
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("%s profile: rate must be positive", PoissonProfile)
+	}
+	return &poissonProfile{
+		rate:   rate,
+		mean:   float64(max(tick.Num, 1)) / rate,
+		random: random.Random,
+	}, nil
+}
+
+func (p *poissonProfile) setRandom(r random.Source) {
+	p.random = r
+}
+
+func (p *poissonProfile) Rate(_ time.Duration) float64 {
+	return p.rate
+}
+
+func (p *poissonProfile) Next(_ time.Duration) (time.Duration, bool) {
+	// inverse transform sampling of the exponential distribution
+	wait := -math.Log(1-p.random.Float64()) * p.mean
+	return time.Duration(wait * float64(time.Second)), true
+}
+
+// profileTicker sends on C at the times given by a Profile
+type profileTicker struct {
+	C    chan time.Time
+	stop chan struct{}
+	once sync.Once
+}
+
+// newProfileTicker starts a ticker following p on clock, which can flow faster than the real time
+func newProfileTicker(p Profile, immediateStart bool, clock *state.Clock) *profileTicker {
+	t := &profileTicker{
+		C:    make(chan time.Time),
+		stop: make(chan struct{}),
+	}
+	go t.run(p, immediateStart, clock)
+	return t
+}
+
+func (t *profileTicker) run(p Profile, immediateStart bool, clock *state.Clock) {
+	start := time.Now()
+	if immediateStart && !t.send(start) {
+		return
+	}
+
+	var timer *time.Timer
+	for {
+		wait, ok := p.Next(clock.Simulated(time.Since(start)))
+		wait = clock.Real(wait)
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		} else {
+			timer.Reset(wait)
+		}
+		select {
+		case <-t.stop:
+			return
+		case now := <-timer.C:
+			if ok && !t.send(now) {
+				return
+			}
+		}
+	}
+}
+
+func (t *profileTicker) send(now time.Time) bool {
+	select {
+	case <-t.stop:
+		return false
+	case t.C <- now:
+		return true
+	}
+}
+
+func (t *profileTicker) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+}
+
+// parameter returns the named parameter, ignoring the case since viper lowercases the configuration keys
+func parameter(parameters map[string]any, name string) (any, bool) {
+	if v, ok := parameters[name]; ok {
+		return v, true
+	}
+	for k, v := range parameters {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func floatParameter(parameters map[string]any, name string, def float64) (float64, error) {
+	v, ok := parameter(parameters, name)
+	if !ok {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("parameter %s: %v is not a number", name, v)
+	}
+}
+
+func floatsParameter(parameters map[string]any, name string) ([]float64, error) {
+	v, ok := parameter(parameters, name)
+	if !ok {
+		return nil, nil
+	}
+	values, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("parameter %s: %v is not a list", name, v)
+	}
+	floats := make([]float64, len(values))
+	for i, value := range values {
+		f, err := floatParameter(map[string]any{name: value}, name, 0)
+		if err != nil {
+			return nil, err
+		}
+		floats[i] = f
+	}
+	return floats, nil
+}
+
+func durationParameter(parameters map[string]any, name string, def time.Duration) (time.Duration, error) {
+	v, ok := parameter(parameters, name)
+	if !ok {
+		return def, nil
+	}
+	switch d := v.(type) {
+	case time.Duration:
+		return d, nil
+	case string:
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		return duration, nil
+	default:
+		return 0, fmt.Errorf("parameter %s: %v is not a duration", name, v)
+	}
+}
+
+func boolParameter(parameters map[string]any, name string, def bool) (bool, error) {
+	v, ok := parameter(parameters, name)
+	if !ok {
+		return def, nil
+	}
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		parsed, err := strconv.ParseBool(b)
+		if err != nil {
+			return false, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		return parsed, nil
+	default:
+		return false, fmt.Errorf("parameter %s: %v is not a boolean", name, v)
+	}
+}
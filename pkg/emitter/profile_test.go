@@ -0,0 +1,209 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	random.SetRandom(0)
+}
+
+func newProfile(t *testing.T, profile string, num int, parameters map[string]any) emitter.Profile {
+	t.Helper()
+	p, err := emitter.NewProfile(emitter.Ticker{
+		Type:       profile,
+		Num:        num,
+		Parameters: parameters,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func assertWait(t *testing.T, p emitter.Profile, elapsed time.Duration, expected time.Duration) {
+	t.Helper()
+	wait, ok := p.Next(elapsed)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(expected), float64(wait), float64(time.Microsecond))
+}
+
+func TestRampProfile(t *testing.T) {
+	p := newProfile(t, emitter.RampProfile, 1, map[string]any{
+		"from": 10,
+		"to":   100.0,
+		"over": "90s",
+	})
+	assertWait(t, p, 0, 100*time.Millisecond)
+	assertWait(t, p, 45*time.Second, time.Second/55)
+	assertWait(t, p, 90*time.Second, 10*time.Millisecond)
+	assertWait(t, p, time.Hour, 10*time.Millisecond)
+
+	down := newProfile(t, emitter.RampProfile, 2, map[string]any{
+		"from": "100",
+		"to":   0,
+		"over": "10s",
+	})
+	assertWait(t, down, 0, 20*time.Millisecond)
+	_, ok := down.Next(10 * time.Second)
+	assert.False(t, ok)
+}
+
+func TestStepProfile(t *testing.T) {
+	parameters := map[string]any{
+		"rates": []any{10, 20, 40},
+		"every": "1m",
+	}
+	p := newProfile(t, emitter.StepProfile, 1, parameters)
+	assertWait(t, p, 30*time.Second, 100*time.Millisecond)
+	assertWait(t, p, 90*time.Second, 50*time.Millisecond)
+	assertWait(t, p, 10*time.Minute, 25*time.Millisecond)
+
+	parameters["repeat"] = true
+	repeated := newProfile(t, emitter.StepProfile, 1, parameters)
+	assertWait(t, repeated, 3*time.Minute+time.Second, 100*time.Millisecond)
+}
+
+func TestSineProfile(t *testing.T) {
+	p := newProfile(t, emitter.SineProfile, 1, map[string]any{
+		"min":    10,
+		"max":    30,
+		"period": "1h",
+	})
+	assertWait(t, p, 0, 100*time.Millisecond)
+	assertWait(t, p, 15*time.Minute, 50*time.Millisecond)
+	assertWait(t, p, 30*time.Minute, time.Second/30)
+	assertWait(t, p, time.Hour, 100*time.Millisecond)
+
+	diurnal := newProfile(t, emitter.DiurnalProfile, 1, map[string]any{
+		"min": 10,
+		"max": 30,
+	})
+	assertWait(t, diurnal, 12*time.Hour, time.Second/30)
+}
+
+func TestBurstProfile(t *testing.T) {
+	p := newProfile(t, emitter.BurstProfile, 1, map[string]any{
+		"rate":       10,
+		"burstrate":  1000,
+		"burstEvery": "1m",
+		"burstFor":   "10s",
+	})
+	assertWait(t, p, 0, 100*time.Millisecond)
+	assertWait(t, p, 49*time.Second, 100*time.Millisecond)
+	assertWait(t, p, 55*time.Second, time.Millisecond)
+	assertWait(t, p, 61*time.Second, 100*time.Millisecond)
+}
+
+func TestPoissonProfile(t *testing.T) {
+	p := newProfile(t, emitter.PoissonProfile, 1, map[string]any{
+		"rate": 100,
+	})
+
+	samples := 20000
+	var total time.Duration
+	for i := 0; i < samples; i++ {
+		wait, ok := p.Next(0)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, wait, time.Duration(0))
+		total += wait
+	}
+	mean := total / time.Duration(samples)
+	assert.InDelta(t, float64(10*time.Millisecond), float64(mean), float64(time.Millisecond))
+}
+
+func TestInvalidProfiles(t *testing.T) {
+	tests := map[string]emitter.Ticker{
+		"unknown type":      {Type: "unknown"},
+		"ramp without over": {Type: emitter.RampProfile, Parameters: map[string]any{"to": 10}},
+		"step without rate": {Type: emitter.StepProfile, Parameters: map[string]any{"every": "1s"}},
+		"bad duration":      {Type: emitter.SineProfile, Parameters: map[string]any{"period": "forever"}},
+		"bad number":        {Type: emitter.PoissonProfile, Parameters: map[string]any{"rate": "fast"}},
+		"long burst":        {Type: emitter.BurstProfile, Parameters: map[string]any{"burstEvery": "1s", "burstFor": "2s"}},
+	}
+	for name, tick := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := emitter.NewProfile(tick)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProfileTicker(t *testing.T) {
+	em, err := emitter.New(
+		emitter.WithProfile(emitter.PoissonProfile, map[string]any{"rate": 200}),
+		emitter.WithImmediateStart(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = em.SetProfile(); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, em.IsOneShot())
+
+	em.StartTicker()
+	defer em.StopTicker()
+	for i := 0; i < 5; i++ {
+		select {
+		case <-em.Ticks():
+		case <-time.After(5 * time.Second):
+			t.Fatal("ticker did not tick")
+		}
+	}
+}
+
+func TestTargetRate(t *testing.T) {
+	newEmitter := func(tick emitter.Ticker) *emitter.Emitter {
+		e, err := emitter.NewFromConfig(emitter.Config{Name: "rate", Tick: tick, ValueTemplate: "v", Embedded: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	simple := newEmitter(emitter.Ticker{Num: 5, Frequency: 500 * time.Millisecond})
+	assert.Equal(t, 0.0, simple.TargetRate())
+	simple.StartTicker()
+	defer simple.StopTicker()
+	assert.Equal(t, 10.0, simple.TargetRate())
+
+	limited := newEmitter(emitter.Ticker{Num: 1, Frequency: time.Second, RecordRate: 30})
+	limited.StartTicker()
+	defer limited.StopTicker()
+	assert.Equal(t, 30.0, limited.TargetRate())
+
+	profile := newEmitter(emitter.Ticker{
+		Type:       emitter.StepProfile,
+		Num:        1,
+		Parameters: map[string]any{"rates": []any{100, 200}, "every": "1h"},
+	})
+	profile.StartTicker()
+	defer profile.StopTicker()
+	assert.Equal(t, 100.0, profile.TargetRate())
+}
@@ -0,0 +1,185 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/tpl"
+)
+
+// Distributions of the Delay of a Transition
+const (
+	// FixedDelay always waits Mean
+	FixedDelay = "fixed"
+	// UniformDelay waits between Min and Max
+	UniformDelay = "uniform"
+	// ExponentialDelay waits Mean on average, as the time between the events of a Poisson process
+	ExponentialDelay = "exponential"
+	// NormalDelay waits Mean on average with a standard deviation StdDev, and at least Min
+	NormalDelay = "normal"
+)
+
+// Scenario moves the entities created by an emitter through the States of their lifecycle, i.e.
+// created → preparing → completed or cancelled.
+// Every object produced by the emitter creates an entity in the Initial state, with the fields of the
+// object if it is a JSON object. Then the entity follows the Transitions of its state: the templates of
+// the next state are rendered with the fields of the entity as .Entity, and produced to the output of
+// the state, adding the fields of the rendered object to the entity. The entity ends in a state without
+// transitions, or when none of them is drawn.
+type Scenario struct {
+	Initial string
+	States  map[string]*ScenarioState
+}
+
+// ScenarioState is a state of a Scenario. Its templates are template names or embedded templates, like
+// the ones of the emitter, which are used for the Initial state. Without a key template the key of the
+// entity is kept. Without an Output the objects go to the output of the emitter, and the ConfigParameters
+// are added to the ones of the emitter.
+type ScenarioState struct {
+	KeyTemplate      string
+	ValueTemplate    string
+	HeaderTemplate   string
+	Output           string
+	ConfigParameters map[string]string
+	Transitions      []Transition
+}
+
+// Transition moves an entity to the state To with a Probability, after a Delay
+type Transition struct {
+	To          string
+	Probability float64
+	Delay       Delay
+}
+
+// Delay is the distribution of the time waited before a Transition
+type Delay struct {
+	Distribution string
+	Mean         time.Duration
+	StdDev       time.Duration
+	Min          time.Duration
+	Max          time.Duration
+}
+
+// Templates are the compiled templates of a state of a Scenario
+type Templates struct {
+	Key    *tpl.Tpl
+	Value  *tpl.Tpl
+	Header *tpl.Tpl
+}
+
+// Validate checks that the states and the transitions of the Scenario are consistent
+func (s *Scenario) Validate() error {
+	initial, ok := s.States[s.Initial]
+	if !ok {
+		return fmt.Errorf("scenario: unknown initial state %q", s.Initial)
+	}
+	if initial != nil && (initial.ValueTemplate != "" || initial.KeyTemplate != "" || initial.HeaderTemplate != "") {
+		return fmt.Errorf("scenario: the initial state %s is rendered by the templates of the emitter", s.Initial)
+	}
+	for name, st := range s.States {
+		if st == nil {
+			continue
+		}
+		if name != s.Initial && st.ValueTemplate == "" {
+			return fmt.Errorf("scenario: state %s needs a value template", name)
+		}
+		total := 0.0
+		for _, t := range st.Transitions {
+			if _, ok := s.States[t.To]; !ok {
+				return fmt.Errorf("scenario: unknown state %q in the transitions of %s", t.To, name)
+			}
+			if t.To == s.Initial {
+				return fmt.Errorf("scenario: state %s can't go back to the initial state", name)
+			}
+			if t.Probability < 0 || t.Probability > 1 {
+				return fmt.Errorf("scenario: the probability of %s → %s must be between 0 and 1", name, t.To)
+			}
+			if err := t.Delay.Validate(); err != nil {
+				return fmt.Errorf("scenario: delay of %s → %s: %w", name, t.To, err)
+			}
+			total += t.Probability
+		}
+		if total > 1+1e-9 {
+			return fmt.Errorf("scenario: the probabilities of the transitions of %s add up to more than 1", name)
+		}
+	}
+	return nil
+}
+
+// Next draws the next Transition of the state, returning false if the entity stays in it
+func (st *ScenarioState) Next(r random.Source) (Transition, bool) {
+	if st == nil || len(st.Transitions) == 0 {
+		return Transition{}, false
+	}
+	u := r.Float64()
+	for _, t := range st.Transitions {
+		if u < t.Probability {
+			return t, true
+		}
+		u -= t.Probability
+	}
+	return Transition{}, false
+}
+
+// Validate checks the parameters of the Distribution of the Delay
+func (d Delay) Validate() error {
+	if d.Mean < 0 || d.StdDev < 0 || d.Min < 0 || d.Max < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	switch d.Distribution {
+	case "", FixedDelay, NormalDelay:
+	case UniformDelay:
+		if d.Max < d.Min {
+			return fmt.Errorf("max must not be less than min")
+		}
+	case ExponentialDelay:
+		if d.Mean <= 0 {
+			return fmt.Errorf("the %s distribution needs a positive mean", ExponentialDelay)
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q", d.Distribution)
+	}
+	return nil
+}
+
+// Next draws a delay from the Distribution, fixed if not set
+func (d Delay) Next(r random.Source) time.Duration {
+	switch d.Distribution {
+	case UniformDelay:
+		return d.Min + time.Duration(r.Int64N(int64(d.Max-d.Min)+1))
+	case ExponentialDelay:
+		// inverse transform sampling of the exponential distribution
+		return time.Duration(-math.Log(1-r.Float64()) * float64(d.Mean))
+	case NormalDelay:
+		return max(d.Mean+time.Duration(standardNormal(r)*float64(d.StdDev)), d.Min)
+	default:
+		return d.Mean
+	}
+}
+
+// standardNormal draws from the standard normal distribution with the Box-Muller transform
+func standardNormal(r random.Source) float64 {
+	return math.Sqrt(-2*math.Log(1-r.Float64())) * math.Cos(2*math.Pi*r.Float64())
+}
@@ -0,0 +1,128 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+func newScenario() *emitter.Scenario {
+	return &emitter.Scenario{
+		Initial: "created",
+		States: map[string]*emitter.ScenarioState{
+			"created": {
+				Transitions: []emitter.Transition{
+					{To: "completed", Probability: 0.75, Delay: emitter.Delay{Distribution: emitter.FixedDelay, Mean: time.Second}},
+					{To: "cancelled", Probability: 0.25, Delay: emitter.Delay{Distribution: emitter.UniformDelay, Min: time.Second, Max: time.Minute}},
+				},
+			},
+			"completed": {ValueTemplate: "{{.Entity.id}}"},
+			"cancelled": {ValueTemplate: "{{.Entity.id}}"},
+		},
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	assert.NoError(t, newScenario().Validate())
+
+	tests := []struct {
+		name   string
+		change func(s *emitter.Scenario)
+	}{
+		{"unknown initial state", func(s *emitter.Scenario) { s.Initial = "none" }},
+		{"initial state with a template", func(s *emitter.Scenario) { s.States["created"].ValueTemplate = "x" }},
+		{"state without a template", func(s *emitter.Scenario) { s.States["completed"].ValueTemplate = "" }},
+		{"unknown target", func(s *emitter.Scenario) { s.States["created"].Transitions[0].To = "none" }},
+		{"back to the initial state", func(s *emitter.Scenario) {
+			s.States["completed"].Transitions = []emitter.Transition{{To: "created", Probability: 1}}
+		}},
+		{"negative probability", func(s *emitter.Scenario) { s.States["created"].Transitions[0].Probability = -0.1 }},
+		{"probabilities over 1", func(s *emitter.Scenario) { s.States["created"].Transitions[0].Probability = 0.9 }},
+		{"unknown distribution", func(s *emitter.Scenario) { s.States["created"].Transitions[0].Delay.Distribution = "pareto" }},
+		{"uniform max below min", func(s *emitter.Scenario) { s.States["created"].Transitions[1].Delay.Max = 0 }},
+		{"exponential without mean", func(s *emitter.Scenario) {
+			s.States["created"].Transitions[0].Delay = emitter.Delay{Distribution: emitter.ExponentialDelay}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScenario()
+			tt.change(s)
+			assert.Error(t, s.Validate())
+		})
+	}
+}
+
+func TestScenarioStateNext(t *testing.T) {
+	s := newScenario()
+	counts := make(map[string]int)
+	for range 10000 {
+		next, ok := s.States["created"].Next(random.Random)
+		assert.True(t, ok)
+		counts[next.To]++
+	}
+	assert.InDelta(t, 7500, counts["completed"], 300)
+	assert.InDelta(t, 2500, counts["cancelled"], 300)
+
+	_, ok := s.States["completed"].Next(random.Random)
+	assert.False(t, ok)
+
+	// the entity stays in a state with a probability of 1 minus the sum of the transitions
+	partial := &emitter.ScenarioState{Transitions: []emitter.Transition{{To: "completed", Probability: 0.5}}}
+	stays := 0
+	for range 10000 {
+		if _, ok := partial.Next(random.Random); !ok {
+			stays++
+		}
+	}
+	assert.InDelta(t, 5000, stays, 300)
+}
+
+func TestDelayNext(t *testing.T) {
+	fixed := emitter.Delay{Mean: time.Second}
+	assert.Equal(t, time.Second, fixed.Next(random.Random))
+
+	uniform := emitter.Delay{Distribution: emitter.UniformDelay, Min: time.Second, Max: 2 * time.Second}
+	normal := emitter.Delay{Distribution: emitter.NormalDelay, Mean: time.Minute, StdDev: 30 * time.Second, Min: 10 * time.Second}
+	exponential := emitter.Delay{Distribution: emitter.ExponentialDelay, Mean: time.Minute}
+	var normalSum, exponentialSum time.Duration
+	const n = 10000
+	for range n {
+		u := uniform.Next(random.Random)
+		assert.GreaterOrEqual(t, u, time.Second)
+		assert.LessOrEqual(t, u, 2*time.Second)
+
+		d := normal.Next(random.Random)
+		assert.GreaterOrEqual(t, d, 10*time.Second)
+		normalSum += d
+
+		e := exponential.Next(random.Random)
+		assert.GreaterOrEqual(t, e, time.Duration(0))
+		exponentialSum += e
+	}
+	assert.InDelta(t, float64(time.Minute), float64(normalSum/n), float64(3*time.Second))
+	assert.InDelta(t, float64(time.Minute), float64(exponentialSum/n), float64(3*time.Second))
+}
@@ -0,0 +1,100 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+)
+
+// Sessions groups the objects of an emitter in sessions, i.e. the page views of a user visiting a website.
+// Every object generated at a tick starts a session, which generates a number of Events drawn from its
+// distribution, waiting a ThinkTime between them. The templates read the session as .Session, and
+// the fields of the previous events of the session as .Entity. Without a key template the events of a
+// session keep the key of the first one.
+type Sessions struct {
+	// Events is the distribution of the number of events of a session
+	Events Count
+	// ThinkTime is the distribution of the time between the events of a session
+	ThinkTime Delay
+}
+
+// Count is the distribution of a number of events, at least Min and 1, and at most Max if set
+type Count struct {
+	Distribution string
+	Mean         float64
+	StdDev       float64
+	Min          int
+	Max          int
+}
+
+// Validate checks the distributions of the Sessions
+func (s *Sessions) Validate() error {
+	if err := s.Events.Validate(); err != nil {
+		return fmt.Errorf("sessions: events: %w", err)
+	}
+	if err := s.ThinkTime.Validate(); err != nil {
+		return fmt.Errorf("sessions: think time: %w", err)
+	}
+	return nil
+}
+
+// Validate checks the parameters of the Distribution of the Count
+func (c Count) Validate() error {
+	if c.Mean < 0 || c.StdDev < 0 || c.Min < 0 || c.Max < 0 {
+		return fmt.Errorf("parameters must not be negative")
+	}
+	if c.Max > 0 && c.Max < c.Min {
+		return fmt.Errorf("max must not be less than min")
+	}
+	switch c.Distribution {
+	case "", FixedDelay, NormalDelay, ExponentialDelay:
+	case UniformDelay:
+		if c.Max == 0 {
+			return fmt.Errorf("the %s distribution needs a max", UniformDelay)
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q", c.Distribution)
+	}
+	return nil
+}
+
+// Next draws a count from the Distribution, fixed if not set
+func (c Count) Next(r random.Source) int {
+	var n float64
+	switch c.Distribution {
+	case UniformDelay:
+		n = float64(c.Min + r.IntN(c.Max-c.Min+1))
+	case ExponentialDelay:
+		n = -math.Log(1-r.Float64()) * c.Mean
+	case NormalDelay:
+		n = c.Mean + standardNormal(r)*c.StdDev
+	default:
+		n = c.Mean
+	}
+	count := max(int(math.Round(n)), c.Min, 1)
+	if c.Max > 0 {
+		count = min(count, c.Max)
+	}
+	return count
+}
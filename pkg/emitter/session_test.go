@@ -0,0 +1,92 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package emitter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionsValidate(t *testing.T) {
+	s := &emitter.Sessions{
+		Events:    emitter.Count{Distribution: emitter.UniformDelay, Min: 1, Max: 10},
+		ThinkTime: emitter.Delay{Distribution: emitter.ExponentialDelay, Mean: 5 * time.Second},
+	}
+	assert.NoError(t, s.Validate())
+
+	invalid := []emitter.Count{
+		{Distribution: "zipf"},
+		{Distribution: emitter.UniformDelay, Min: 1},
+		{Min: 5, Max: 2},
+		{Mean: -1},
+	}
+	for _, c := range invalid {
+		s.Events = c
+		assert.Error(t, s.Validate(), "%+v", c)
+	}
+	s.Events = emitter.Count{Mean: 3}
+	s.ThinkTime = emitter.Delay{Distribution: emitter.ExponentialDelay}
+	assert.Error(t, s.Validate())
+
+	_, err := emitter.NewFromConfig(emitter.Config{
+		Name:          "both",
+		ValueTemplate: "{{.Session.Seq}}",
+		Embedded:      true,
+		Output:        "stdout",
+		Scenario:      newScenario(),
+		Sessions:      &emitter.Sessions{Events: emitter.Count{Mean: 3}},
+	})
+	assert.Error(t, err)
+}
+
+func TestCountNext(t *testing.T) {
+	assert.Equal(t, 4, emitter.Count{Mean: 4}.Next(random.Random))
+	assert.Equal(t, 1, emitter.Count{}.Next(random.Random))
+
+	uniform := emitter.Count{Distribution: emitter.UniformDelay, Min: 2, Max: 5}
+	normal := emitter.Count{Distribution: emitter.NormalDelay, Mean: 10, StdDev: 3, Max: 15}
+	exponential := emitter.Count{Distribution: emitter.ExponentialDelay, Mean: 8}
+	seen := make(map[int]bool)
+	var normalSum, exponentialSum int
+	const n = 10000
+	for range n {
+		u := uniform.Next(random.Random)
+		assert.GreaterOrEqual(t, u, 2)
+		assert.LessOrEqual(t, u, 5)
+		seen[u] = true
+
+		c := normal.Next(random.Random)
+		assert.GreaterOrEqual(t, c, 1)
+		assert.LessOrEqual(t, c, 15)
+		normalSum += c
+
+		e := exponential.Next(random.Random)
+		assert.GreaterOrEqual(t, e, 1)
+		exponentialSum += e
+	}
+	assert.Len(t, seen, 4)
+	assert.InDelta(t, 10, float64(normalSum)/n, 0.5)
+	assert.InDelta(t, 8, float64(exponentialSum)/n, 0.5)
+}
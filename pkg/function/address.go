@@ -26,32 +26,36 @@ import (
 	"math"
 	"text/template"
 
-	"github.com/jrnd-io/jrv2/pkg/random"
-
 	"github.com/biter777/countries"
 )
 
 func init() {
 	AddFuncs(template.FuncMap{
-		"building":       BuildingNumber,
-		"cardinal":       Cardinal,
-		"capital":        Capital,
 		"capital_at":     CapitalAt,
-		"city":           City,
 		"city_at":        CityAt,
-		"country":        Country,
-		"country_random": CountryRandom,
 		"country_at":     CountryAt,
-		"latitude":       Latitude,
-		"longitude":      Longitude,
-		"nearby_gps":     NearbyGPS,
-		"state":          State,
 		"state_at":       StateAt,
-		"state_short":    StateShort,
 		"state_short_at": StateShortAt,
-		"street":         Street,
-		"zip":            Zip,
-		"zip_at":         ZipAt,
+	})
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"building":       func(n int) string { return buildingNumberIn(s, n) },
+			"cardinal":       func(short bool) string { return cardinalIn(s, short) },
+			"capital":        func() string { return capitalIn(s) },
+			"city":           func() string { return cityIn(s) },
+			"country":        func() string { return countryIn(s) },
+			"country_random": func() string { return countryRandomIn(s) },
+			"latitude":       func() string { return latitudeIn(s) },
+			"longitude":      func() string { return longitudeIn(s) },
+			"nearby_gps": func(latitude float64, longitude float64, radius int) string {
+				return nearbyGPSIn(s, latitude, longitude, radius)
+			},
+			"state":       func() string { return stateIn(s) },
+			"state_short": func() string { return stateShortIn(s) },
+			"street":      func() string { return streetIn(s) },
+			"zip":         func() string { return zipIn(s) },
+			"zip_at":      func(index int) string { return zipAtIn(s, index) },
+		}
 	})
 }
 
@@ -72,16 +76,24 @@ var CardinalLong = []string{"North", "South", "East", "Ovest", "North-East", "No
 
 // BuildingNumber generates a random building number of max n digits
 func BuildingNumber(n int) string {
-	building := make([]byte, random.Random.IntN(n)+1)
+	return buildingNumberIn(global(), n)
+}
+
+func buildingNumberIn(s *state.Scope, n int) string {
+	building := make([]byte, s.Random().IntN(n)+1)
 	for i := range building {
-		building[i] = digits[random.Random.IntN(len(digits))]
+		building[i] = digits[s.Random().IntN(len(digits))]
 	}
 	return string(building)
 }
 
 // Capital returns a random Capital
 func Capital() string {
-	return Word(CapitalMap)
+	return capitalIn(global())
+}
+
+func capitalIn(s *state.Scope) string {
+	return wordIn(s, CapitalMap)
 }
 
 // CapitalAt returns Capital at given index
@@ -91,20 +103,29 @@ func CapitalAt(index int) string {
 
 // Cardinal return a random cardinal direction, in long or short form
 func Cardinal(short bool) string {
+	return cardinalIn(global(), short)
+}
+
+func cardinalIn(s *state.Scope, short bool) string {
 
 	directions := CardinalLong
 	if short {
 		directions = CardinalShort
 	}
 
-	return directions[random.Random.IntN(len(directions))]
+	return directions[s.Random().IntN(len(directions))]
 }
 
 // City returns a random City
 func City() string {
-	c := Word(CityMap)
-	state.GetSharedState().Ctx.Store(fmt.Sprintf("_%s", CityMap), c)
-	state.GetSharedState().CityIndex = state.GetSharedState().LastIndex
+	return cityIn(global())
+}
+
+func cityIn(s *state.Scope) string {
+	c, index := wordIndexIn(s, CityMap)
+	s.Ctx.Store(fmt.Sprintf("_%s", CityMap), c)
+	s.LastIndex = index
+	s.CityIndex = index
 	return c
 }
 
@@ -115,20 +136,28 @@ func CityAt(index int) string {
 
 // Country returns the ISO 3166 Country selected with locale
 func Country() string {
-	countryIndex := state.GetSharedState().CountryIndex
+	return countryIn(global())
+}
+
+func countryIn(s *state.Scope) string {
+	countryIndex := s.CountryIndex
 	if countryIndex == -1 || countryIndex == 0 {
-		state.GetSharedState().LastIndex = random.Random.IntN(len(countries.All()))
-		c := countries.All()[state.GetSharedState().LastIndex].Alpha2()
+		s.LastIndex = s.Random().IntN(len(countries.All()))
+		c := countries.All()[s.LastIndex].Alpha2()
 		return c
 	}
 
-	return countries.All()[state.GetSharedState().CountryIndex].Alpha2()
+	return countries.All()[countryIndex].Alpha2()
 }
 
 // CountryRandom returns a random ISO 3166 Country
 func CountryRandom() string {
-	state.GetSharedState().LastIndex = random.Random.IntN(len(countries.All()))
-	return countries.ByNumeric(state.GetSharedState().LastIndex).Alpha2()
+	return countryRandomIn(global())
+}
+
+func countryRandomIn(s *state.Scope) string {
+	s.LastIndex = s.Random().IntN(len(countries.All()))
+	return countries.ByNumeric(s.LastIndex).Alpha2()
 }
 
 // CountryAt returns an ISO 3166 Country at a given index
@@ -138,25 +167,37 @@ func CountryAt(index int) string {
 
 // Latitude returns a random latitude between -90 and 90
 func Latitude() string {
-	latitude := -90 + random.Random.Float64()*(180)
+	return latitudeIn(global())
+}
+
+func latitudeIn(s *state.Scope) string {
+	latitude := -90 + s.Random().Float64()*(180)
 	return fmt.Sprintf("%.4f", latitude)
 }
 
 // Longitude returns a random longitude between -180 and 180
 func Longitude() string {
-	longitude := -180 + random.Random.Float64()*(360)
+	return longitudeIn(global())
+}
+
+func longitudeIn(s *state.Scope) string {
+	longitude := -180 + s.Random().Float64()*(360)
 	return fmt.Sprintf("%.4f", longitude)
 }
 
 // NearbyGPS returns a random latitude longitude within a given radius in meters
 func NearbyGPS(latitude float64, longitude float64, radius int) string {
+	return nearbyGPSIn(global(), latitude, longitude, radius)
+}
+
+func nearbyGPSIn(s *state.Scope, latitude float64, longitude float64, radius int) string {
 	radiusInMeters := float64(radius)
 
 	// Generate a random angle in radians
-	randomAngle := random.Random.Float64() * 2 * math.Pi
+	randomAngle := s.Random().Float64() * 2 * math.Pi
 
 	// Calculate the distance from the center point
-	distanceInMeters := random.Random.Float64() * radiusInMeters
+	distanceInMeters := s.Random().Float64() * radiusInMeters
 
 	// Convert the distance to degrees
 	distanceInDegrees := distanceInMeters * degreesPerMeter
@@ -171,10 +212,15 @@ func NearbyGPS(latitude float64, longitude float64, radius int) string {
 
 // State returns a random State
 func State() string {
-	s := Word(StateMap)
-	state.GetSharedState().Ctx.Store(fmt.Sprintf("_%s", StateMap), s)
-	state.GetSharedState().CountryIndex = state.GetSharedState().LastIndex
-	return s
+	return stateIn(global())
+}
+
+func stateIn(s *state.Scope) string {
+	st, index := wordIndexIn(s, StateMap)
+	s.Ctx.Store(fmt.Sprintf("_%s", StateMap), st)
+	s.LastIndex = index
+	s.CountryIndex = index
+	return st
 }
 
 // StateAt returns State at given index
@@ -184,7 +230,11 @@ func StateAt(index int) string {
 
 // StateShort returns a random short State
 func StateShort() string {
-	return Word(StateShortMap)
+	return stateShortIn(global())
+}
+
+func stateShortIn(s *state.Scope) string {
+	return wordIn(s, StateShortMap)
 }
 
 // StateShortAt returns short State at given index
@@ -194,7 +244,11 @@ func StateShortAt(index int) string {
 
 // Street returns a random street
 func Street() string {
-	return Word(StreetMap)
+	return streetIn(global())
+}
+
+func streetIn(s *state.Scope) string {
+	return wordIn(s, StreetMap)
 }
 
 // StreetAt returns a street at given index
@@ -204,20 +258,28 @@ func StreetAt(index int) string {
 
 // Zip returns a random Zip code
 func Zip() string {
-	cityIndex := state.GetSharedState().CityIndex
+	return zipIn(global())
+}
+
+func zipIn(s *state.Scope) string {
+	cityIndex := s.CityIndex
 
 	if cityIndex == -1 {
-		z := Word(ZipMap)
-		zip, _ := Regex(z)
+		z := wordIn(s, ZipMap)
+		zip, _ := regexIn(s, z)
 		return zip
 	}
 
-	return ZipAt(cityIndex)
+	return zipAtIn(s, cityIndex)
 }
 
 // ZipAt returns Zip code at given index
 func ZipAt(index int) string {
+	return zipAtIn(global(), index)
+}
+
+func zipAtIn(s *state.Scope, index int) string {
 	z := WordAt(ZipMap, index)
-	zip, _ := Regex(z)
+	zip, _ := regexIn(s, z)
 	return zip
 }
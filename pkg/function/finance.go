@@ -22,12 +22,11 @@ package function
 
 import (
 	"fmt"
-	"math/rand"
 	"strconv"
 	"strings"
 	"text/template"
 
-	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 )
 
 const (
@@ -35,63 +34,88 @@ const (
 )
 
 func init() {
-	AddFuncs(template.FuncMap{
-		"account":      Account,
-		"amount":       Amount,
-		"bitcoin":      Bitcoin,
-		"card":         CreditCard,
-		"cardCVV":      CreditCardCVV,
-		"cusip":        Cusip,
-		"ethereum":     Ethereum,
-		"isin":         Isin,
-		"sedol":        Sedol,
-		"stock_symbol": StockSymbol,
-		"swift":        Swift,
-		"valor":        Valor,
-		"wkn":          Wkn,
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"account":      func(length int) string { return accountIn(s, length) },
+			"amount":       func(min float32, max float32, currency string) string { return amountIn(s, min, max, currency) },
+			"bitcoin":      func() string { return bitcoinIn(s) },
+			"card":         func(issuer string) string { return creditCardIn(s, issuer) },
+			"cardCVV":      func(length int) string { return creditCardCVVIn(s, length) },
+			"cusip":        func() string { return cusipIn(s) },
+			"ethereum":     func() string { return ethereumIn(s) },
+			"isin":         func(country string) string { return isinIn(s, country) },
+			"sedol":        func() string { return sedolIn(s) },
+			"stock_symbol": func() string { return stockSymbolIn(s) },
+			"valor":        func() string { return valorIn(s) },
+			"wkn":          func() string { return wknIn(s) },
+		}
 	})
 
 }
 
 // Account returns a random account number of given length
 func Account(length int) string {
+	return accountIn(global(), length)
+}
+
+func accountIn(s *state.Scope, length int) string {
 	account := make([]byte, length)
 	for i := range account {
-		account[i] = digits[random.Random.IntN(len(digits))] //nolint no need to use a secure random generator
+		account[i] = digits[s.Random().IntN(len(digits))] //nolint no need to use a secure random generator
 	}
 	return string(account)
 }
 
 // Amount returns an amount of money between min and max, and given currency
 func Amount(min float32, max float32, currency string) string {
-	amount := min + random.Random.Float32()*(max-min)
+	return amountIn(global(), min, max, currency)
+}
+
+func amountIn(s *state.Scope, min float32, max float32, currency string) string {
+	amount := min + s.Random().Float32()*(max-min)
 	return fmt.Sprintf("%s%.2f", currency, amount)
 }
 
 // Bitcoin returns a bitcoin address
 func Bitcoin() string {
-	bc, _ := Regex("^(bc1|[13])[a-zA-HJ-NP-Z0-9]{25,39}$")
+	return bitcoinIn(global())
+}
+
+func bitcoinIn(s *state.Scope) string {
+	bc, _ := regexIn(s, "^(bc1|[13])[a-zA-HJ-NP-Z0-9]{25,39}$")
 	return bc
 }
 
 // Cusip returns a valid 9 characters Cusip code
 func Cusip() string {
-	cusip, _ := Regex("^[0-9]{3}[0-9A-Z]{5}")
+	return cusipIn(global())
+}
+
+func cusipIn(s *state.Scope) string {
+	cusip, _ := regexIn(s, "^[0-9]{3}[0-9A-Z]{5}")
 	check := CusipCheckDigit(cusip)
 	return cusip + check
 }
 
 // CreditCardCVV returns a random credit card CVV of given length
 func CreditCardCVV(length int) string {
+	return creditCardCVVIn(global(), length)
+}
+
+func creditCardCVVIn(s *state.Scope, length int) string {
 	cvv := make([]byte, length)
 	for i := range cvv {
-		cvv[i] = digits[rand.Intn(len(digits))] //nolint no need to use a secure random generator
+		cvv[i] = digits[s.Random().IntN(len(digits))]
 	}
 	return string(cvv)
 }
 
 // CreditCard returns a valid credit card
 func CreditCard(issuer string) string {
+	return creditCardIn(global(), issuer)
+}
+
+func creditCardIn(s *state.Scope, issuer string) string {
 
 	var regex string
 	switch issuer {
@@ -106,46 +130,66 @@ func CreditCard(issuer string) string {
 	default:
 		return ""
 	}
-	card, _ := Regex(regex)
+	card, _ := regexIn(s, regex)
 	check := LuhnCheckDigit(card)
 	return card + check
 }
 
 // Ethereum returns an ethereum address
 func Ethereum() string {
-	eth, _ := Regex("^0x[a-fA-F0-9]{40}$")
+	return ethereumIn(global())
+}
+
+func ethereumIn(s *state.Scope) string {
+	eth, _ := regexIn(s, "^0x[a-fA-F0-9]{40}$")
 	return eth
 }
 
 // Isin returns a valid 12 characters Isin code
 func Isin(country string) string {
-	c := country + Cusip()
+	return isinIn(global(), country)
+}
+
+func isinIn(s *state.Scope, country string) string {
+	c := country + cusipIn(s)
 	return c + IsinCheckDigit(c)
 }
 
 // Sedol returns a valid 7 characters sedol code
 func Sedol() string {
-	sedol, _ := Regex("[0-9BCDFGHJKLMNPQRSTVWXYZ]{6}")
+	return sedolIn(global())
+}
+
+func sedolIn(s *state.Scope) string {
+	sedol, _ := regexIn(s, "[0-9BCDFGHJKLMNPQRSTVWXYZ]{6}")
 	return sedol + SedolCheckDigit(sedol)
 }
 
 // StockSymbol returns a NASDAQ stock symbol
 func StockSymbol() string {
-	symbol := Word("stock_symbol")
+	return stockSymbolIn(global())
+}
+
+func stockSymbolIn(s *state.Scope) string {
+	symbol := wordIn(s, StockSymbolMap)
 	return symbol
 }
 
 // Swift returns a swift/bic code
 func Swift() string {
+	return swiftIn(global())
+}
+
+func swiftIn(s *state.Scope) string {
 	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 	bankCode := make([]byte, 4)
 	for i := range bankCode {
-		bankCode[i] = letters[rand.Intn(len(letters))] //nolint no need to use a secure random generator
+		bankCode[i] = letters[s.Random().IntN(len(letters))]
 	}
-	country := Country()
-	location := rand.Intn(100) //nolint no need to use a secure random generator
-	branch := rand.Intn(1000)  //nolint no need to use a secure random generator
+	country := countryIn(s)
+	location := s.Random().IntN(100)
+	branch := s.Random().IntN(1000)
 
 	return string(bankCode) + country + fmt.Sprintf("%02d", location) + fmt.Sprintf("%03d", branch)
 
@@ -153,13 +197,21 @@ func Swift() string {
 
 // Valor returns a valid 6-9 digits Valor code
 func Valor() string {
-	valor, _ := Regex("[0-9]{6,9}")
+	return valorIn(global())
+}
+
+func valorIn(s *state.Scope) string {
+	valor, _ := regexIn(s, "[0-9]{6,9}")
 	return valor
 }
 
 // Wkn returns a valid 6 characters wkn code
 func Wkn() string {
-	wkn, _ := Regex("[ABCDEFGHLMNPQRSTUVXYZ]{6}")
+	return wknIn(global())
+}
+
+func wknIn(s *state.Scope) string {
+	wkn, _ := regexIn(s, "[ABCDEFGHLMNPQRSTUVXYZ]{6}")
 	return wkn
 }
 
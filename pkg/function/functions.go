@@ -28,6 +28,7 @@ import (
 	"github.com/jrnd-io/jrv2/pkg/state"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/jrnd-io/jrv2/pkg/config"
 	"github.com/rs/zerolog/log"
@@ -35,17 +36,22 @@ import (
 
 var defaultLocale = "us"
 var data = map[string][]string{}
+var dataLock sync.RWMutex
 
 // ClearCache is used to internally Cache data from word files
 func ClearCache(name string) {
+	dataLock.Lock()
+	defer dataLock.Unlock()
 	data[name] = nil
 }
 func GetCache(name string) []string {
+	dataLock.RLock()
+	defer dataLock.RUnlock()
 	return data[name]
 }
 func Cache(name string) (bool, error) {
 
-	v := data[name]
+	v := GetCache(name)
 	if v != nil {
 		return false, nil
 	}
@@ -75,15 +81,17 @@ func Cache(name string) (bool, error) {
 
 func CacheFromFile(fileName string, name string) (bool, error) {
 
-	var err error
-	data[name], err = initialize(fileName)
+	words, err := initialize(fileName)
 	if err != nil {
 		return false, err
 	}
-	if len(data[name]) == 0 {
+	if len(words) == 0 {
 		return false, fmt.Errorf("no words found in %s", fileName)
 	}
 
+	dataLock.Lock()
+	defer dataLock.Unlock()
+	data[name] = words
 	return true, nil
 }
 
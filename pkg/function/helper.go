@@ -50,8 +50,7 @@ func ExecuteTemplate(key *template.Template, value *template.Template, oneline b
 	}
 
 	// TODO: maybe this does not go here since the actual produced bytes are in the plugin response
-	state.GetSharedState().Execution.GeneratedObjects++
-	state.GetSharedState().Execution.GeneratedBytes += uint64(len(v))
+	state.GetSharedState().Execution.AddGenerated(uint64(len(v)))
 
 	return k, v, err
 }
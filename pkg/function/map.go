@@ -20,7 +20,12 @@
 
 package function
 
-import "text/template"
+import (
+	"maps"
+	"text/template"
+
+	"github.com/jrnd-io/jrv2/pkg/state"
+)
 
 func Map() template.FuncMap {
 	return fmap
@@ -33,3 +38,27 @@ func AddFuncs(funcs template.FuncMap) {
 		fmap[k] = v
 	}
 }
+
+// scopedFuncs create the functions using the state of the templates, bound to a scope
+var scopedFuncs []func(s *state.Scope) template.FuncMap
+
+// AddScopedFuncs adds the functions using the state of the templates.
+// Map binds them to the global scope, MapFor to the scope of an emitter.
+func AddScopedFuncs(funcs func(s *state.Scope) template.FuncMap) {
+	scopedFuncs = append(scopedFuncs, funcs)
+	AddFuncs(funcs(global()))
+}
+
+// MapFor returns the functions with the ones using the state of the templates bound to s
+func MapFor(s *state.Scope) template.FuncMap {
+	m := maps.Clone(fmap)
+	for _, funcs := range scopedFuncs {
+		maps.Copy(m, funcs(s))
+	}
+	return m
+}
+
+// global returns the global scope, used by the exported functions
+func global() *state.Scope {
+	return state.GetSharedState().Scope
+}
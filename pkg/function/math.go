@@ -25,7 +25,7 @@ import (
 	"math"
 	"text/template"
 
-	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 )
 
 func init() {
@@ -33,9 +33,6 @@ func init() {
 		"add":          func(a, b int) int { return a + b },
 		"div":          func(a, b int) int { return a / b },
 		"format_float": func(f string, v float32) string { return fmt.Sprintf(f, v) },
-		"integer":      func(min, max int) int { return min + random.Random.IntN(max-min) },
-		"integer64":    func(min, max int64) int64 { return min + random.Random.Int64N(max-min) },
-		"floating":     func(min, max float32) float32 { return min + random.Random.Float32()*(max-min) },
 		"sub":          func(a, b int) int { return a - b },
 		"max":          math.Max,
 		"min":          math.Min,
@@ -44,6 +41,13 @@ func init() {
 		"mod":          func(a, b int) int { return a % b },
 		"mul":          func(a, b int) int { return a * b },
 	})
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"integer":   func(min, max int) int { return min + s.Random().IntN(max-min) },
+			"integer64": func(min, max int64) int64 { return min + s.Random().Int64N(max-min) },
+			"floating":  func(min, max float32) float32 { return min + s.Random().Float32()*(max-min) },
+		}
+	})
 
 }
 
@@ -21,27 +21,30 @@
 package function
 
 import (
-	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"math/big"
 	"net"
 	"text/template"
 
-	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 )
 
 // adding functions to map
 func init() {
-	AddFuncs(template.FuncMap{
-		"http_method":       HTTPMethod,
-		"ip":                IP,
-		"ipv6":              IPv6,
-		"ip_known_protocol": IPKnownProtocol,
-		"ip_known_port":     IPKnownPort,
-		"mac":               Mac,
-		"password":          Password,
-		"useragent":         UserAgent,
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"http_method":       func() string { return httpMethodIn(s) },
+			"ip":                func(cidr string) string { return ipIn(s, cidr) },
+			"ipv6":              func() string { return ipv6In(s) },
+			"ip_known_protocol": func() string { return ipKnownProtocolIn(s) },
+			"ip_known_port":     func() string { return ipKnownPortIn(s) },
+			"mac":               func() string { return macIn(s) },
+			"password": func(length int, memorable bool, prefix string, suffix string) string {
+				return passwordIn(s, length, memorable, prefix, suffix)
+			},
+			"useragent": func() string { return userAgentIn(s) },
+		}
 	})
 }
 
@@ -53,10 +56,19 @@ var (
 
 // HTTPMethod returns a random http method
 func HTTPMethod() string {
-	return HTTPMethods[random.Random.IntN(len(HTTPMethods))]
+	return httpMethodIn(global())
+}
+
+func httpMethodIn(s *state.Scope) string {
+	return HTTPMethods[s.Random().IntN(len(HTTPMethods))]
 }
 
+// IP returns a random IPv4 address in the given network
 func IP(cidr string) string {
+	return ipIn(global(), cidr)
+}
+
+func ipIn(s *state.Scope, cidr string) string {
 	_, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return "0.0.0.0"
@@ -72,10 +84,10 @@ func IP(cidr string) string {
 	networkSize.Sub(networkSize, big.NewInt(2))                                                          // Exclude network and broadcast addresses
 
 	// Generate a random offset within the network size
-	offset, err := rand.Int(rand.Reader, networkSize)
-	if err != nil {
+	if networkSize.Sign() <= 0 {
 		return "0.0.0.0"
 	}
+	offset := big.NewInt(s.Random().Int64N(networkSize.Int64()))
 
 	// Add the offset to the network address
 	ipInt.Add(ipInt, offset)
@@ -90,19 +102,31 @@ func IP(cidr string) string {
 
 // IPKnownPort returns a random known port number
 func IPKnownPort() string {
-	return Ports[random.Random.IntN(len(Ports))]
+	return ipKnownPortIn(global())
+}
+
+func ipKnownPortIn(s *state.Scope) string {
+	return Ports[s.Random().IntN(len(Ports))]
 }
 
 // IPKnownProtocol returns a random known protocol
 func IPKnownProtocol() string {
-	return Protocols[random.Random.IntN(len(Protocols))]
+	return ipKnownProtocolIn(global())
+}
+
+func ipKnownProtocolIn(s *state.Scope) string {
+	return Protocols[s.Random().IntN(len(Protocols))]
 }
 
 // IPv6 returns a random Ipv6 Address
 func IPv6() string {
+	return ipv6In(global())
+}
+
+func ipv6In(s *state.Scope) string {
 	ip := make(net.IP, net.IPv6len)
 	for i := 0; i < net.IPv6len; i++ {
-		ip[i] = byte(random.Random.IntN(256))
+		ip[i] = byte(s.Random().IntN(256))
 	}
 	ip[0] &= 0xfe // Set the "locally administered" flag
 	ip[0] |= 0x02 // Set the "unicast" flag
@@ -111,9 +135,13 @@ func IPv6() string {
 
 // Mac returns a random Mac Address
 func Mac() string {
+	return macIn(global())
+}
+
+func macIn(s *state.Scope) string {
 	mac := make(net.HardwareAddr, 8)
 	// config.ChaCha8.Read(mac) //nolint
-	binary.LittleEndian.PutUint64(mac, random.Random.Uint64())
+	binary.LittleEndian.PutUint64(mac, s.Random().Uint64())
 	mac[0] &= 0xfe // Set the "locally administered" flag
 	mac[0] |= 0x02 // Set the "unicast" flag
 	return mac[0:6].String()
@@ -121,6 +149,10 @@ func Mac() string {
 
 // Password returns a random Password of given length, memorable, and with prefix and suffix
 func Password(length int, memorable bool, prefix string, suffix string) string {
+	return passwordIn(global(), length, memorable, prefix, suffix)
+}
+
+func passwordIn(s *state.Scope, length int, memorable bool, prefix string, suffix string) string {
 
 	const (
 		// Define the set of vowels and consonants that can be used to generate the Password.
@@ -135,11 +167,11 @@ func Password(length int, memorable bool, prefix string, suffix string) string {
 		for i := range password {
 			if i%2 == 0 {
 				// Use a vowel.
-				char := vowels[random.Random.IntN(len(vowels))]
+				char := vowels[s.Random().IntN(len(vowels))]
 				password[i] = char
 			} else {
 				// Use a consonant.
-				char := consonants[random.Random.IntN(len(consonants))]
+				char := consonants[s.Random().IntN(len(consonants))]
 				password[i] = char
 			}
 		}
@@ -147,7 +179,7 @@ func Password(length int, memorable bool, prefix string, suffix string) string {
 		// Generate a random Password using the full charset.
 		charset := vowels + consonants + "0123456789!@#$%^&*()_+{}:\"<>?,./;'[]\\-=`~"
 		for i := range password {
-			char := charset[random.Random.IntN(len(charset))]
+			char := charset[s.Random().IntN(len(charset))]
 			password[i] = char
 		}
 	}
@@ -157,6 +189,10 @@ func Password(length int, memorable bool, prefix string, suffix string) string {
 
 // UserAgent returns a random user agent
 func UserAgent() string {
+	return userAgentIn(global())
+}
+
+func userAgentIn(s *state.Scope) string {
 
 	var desktopOperatingSystems = []string{
 		"Windows NT 10.0", "Windows NT 6.3", "Macintosh; Intel Mac OS X 10_15_7", "Macintosh; Intel Mac OS X 10_14_5", "X11; Linux x86_64",
@@ -175,32 +211,32 @@ func UserAgent() string {
 	}
 
 	// Generate random desktop user agent
-	isDesktop := random.Random.IntN(2) == 0
+	isDesktop := s.Random().IntN(2) == 0
 	var os string
 	var browser string
 	var version string
 	if isDesktop {
-		os = desktopOperatingSystems[random.Random.IntN(len(desktopOperatingSystems))]
-		browser = desktopBrowsers[random.Random.IntN(len(desktopBrowsers))]
-		version = fmt.Sprintf("%d.%d.%d.%d", random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10))
+		os = desktopOperatingSystems[s.Random().IntN(len(desktopOperatingSystems))]
+		browser = desktopBrowsers[s.Random().IntN(len(desktopBrowsers))]
+		version = fmt.Sprintf("%d.%d.%d.%d", s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10))
 	} else {
-		os = mobileOperatingSystems[random.Random.IntN(len(mobileOperatingSystems))]
-		browser = mobileBrowsers[random.Random.IntN(len(mobileBrowsers))]
+		os = mobileOperatingSystems[s.Random().IntN(len(mobileOperatingSystems))]
+		browser = mobileBrowsers[s.Random().IntN(len(mobileBrowsers))]
 		switch browser {
 		case "Chrome Mobile":
-			version = fmt.Sprintf("%d.%d.%d.%d", random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10))
+			version = fmt.Sprintf("%d.%d.%d.%d", s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10))
 		case "Safari Mobile":
-			version = fmt.Sprintf("%d.%d", random.Random.IntN(14)+1, random.Random.IntN(3)+1)
+			version = fmt.Sprintf("%d.%d", s.Random().IntN(14)+1, s.Random().IntN(3)+1)
 		case "Firefox Mobile":
-			version = fmt.Sprintf("%d.%d", random.Random.IntN(10)+1, random.Random.IntN(10))
+			version = fmt.Sprintf("%d.%d", s.Random().IntN(10)+1, s.Random().IntN(10))
 		case "Opera Mobile":
-			version = fmt.Sprintf("%d.%d.%d.%d", random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10))
+			version = fmt.Sprintf("%d.%d.%d.%d", s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10))
 		case "Edge Mobile":
-			version = fmt.Sprintf("%d.%d.%d.%d", random.Random.IntN(10)+40, random.Random.IntN(10), random.Random.IntN(10), random.Random.IntN(10))
+			version = fmt.Sprintf("%d.%d.%d.%d", s.Random().IntN(10)+40, s.Random().IntN(10), s.Random().IntN(10), s.Random().IntN(10))
 		}
 	}
 
-	userAgent := fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/%d.%d (KHTML, like Gecko) %s/%s Mobile Safari/%d.%d", os, random.Random.IntN(100)+500, random.Random.IntN(100)+1, browser, version, random.Random.IntN(10)+1, random.Random.IntN(10)+1)
+	userAgent := fmt.Sprintf("Mozilla/5.0 (%s) AppleWebKit/%d.%d (KHTML, like Gecko) %s/%s Mobile Safari/%d.%d", os, s.Random().IntN(100)+500, s.Random().IntN(100)+1, browser, version, s.Random().IntN(10)+1, s.Random().IntN(10)+1)
 
 	return userAgent
 
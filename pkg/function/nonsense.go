@@ -31,6 +31,7 @@ import (
 	"text/template"
 
 	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 )
 
 const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -43,11 +44,15 @@ var alice string
 var lorem string
 
 func init() {
-	AddFuncs(template.FuncMap{
-		"sentence":        Sentence,       // to nonsense
-		"sentence_prefix": SentencePrefix, // to nonsense
-		"lorem":           Lorem,          // to nonsense
-		"markov":          Nonsense,       // to nonsense
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"sentence":        func(numWords int) string { return sentenceIn(s, numWords) },                             // to nonsense
+			"sentence_prefix": func(prefixLen, numWords int) string { return sentencePrefixIn(s, prefixLen, numWords) }, // to nonsense
+			"lorem":           func(size int) string { return loremIn(s, size) },                                        // to nonsense
+			"markov": func(prefixLen, numWords int, baseText string) string { // to nonsense
+				return nonsenseIn(s, prefixLen, numWords, baseText)
+			},
+		}
 	})
 
 }
@@ -107,6 +112,11 @@ func (c *Chain) Build(r io.Reader) {
 
 // Generate returns a string of at most n words generated from Chain.
 func (c *Chain) Generate(n int) string {
+	return c.generateFrom(global().Random(), n)
+}
+
+// generateFrom returns a string of at most n words generated from Chain, drawing from r
+func (c *Chain) generateFrom(r random.Source, n int) string {
 	p := make(Prefix, c.prefixLen)
 	var words []string
 	for i := 0; i < n; i++ {
@@ -114,7 +124,7 @@ func (c *Chain) Generate(n int) string {
 		if len(choices) == 0 {
 			break
 		}
-		next := choices[random.Random.IntN(len(choices))]
+		next := choices[r.IntN(len(choices))]
 
 		if i == n-1 {
 			if strings.HasSuffix(next, ",") {
@@ -129,34 +139,54 @@ func (c *Chain) Generate(n int) string {
 
 // Lorem generates a 'lorem ipsum' text of size words
 func Lorem(size int) string {
-	return Nonsense(2, size, string(lorem))
+	return loremIn(global(), size)
+}
+
+func loremIn(s *state.Scope, size int) string {
+	return nonsenseIn(s, 2, size, string(lorem))
 }
 
 // SentencePrefix generates an 'alice in wonderland' text of size words with given prefixLen
 func SentencePrefix(prefixLen, numWords int) string {
-	return Nonsense(prefixLen, numWords, string(alice))
+	return sentencePrefixIn(global(), prefixLen, numWords)
+}
+
+func sentencePrefixIn(s *state.Scope, prefixLen, numWords int) string {
+	return nonsenseIn(s, prefixLen, numWords, string(alice))
 }
 
 // Nonsense generates a random Sentence of numWords wordsm using a prefixLen and a baseText to start from
 func Nonsense(prefixLen, numWords int, baseText string) string {
+	return nonsenseIn(global(), prefixLen, numWords, baseText)
+}
+
+func nonsenseIn(s *state.Scope, prefixLen, numWords int, baseText string) string {
 	c := NewChain(prefixLen)
 	c.Build(strings.NewReader(baseText))
-	return c.Generate(numWords)
+	return c.generateFrom(s.Random(), numWords)
 }
 
 // RandomStringVocabulary returns a random string long between min and max characters using a vocabulary
 func RandomStringVocabulary(min, max int, source string) string {
+	return randomStringVocabularyIn(global(), min, max, source)
+}
+
+func randomStringVocabularyIn(s *state.Scope, min, max int, source string) string {
 	if len(source) == 0 {
 		return ""
 	}
-	textb := make([]byte, min+random.Random.IntN(max-min+1))
+	textb := make([]byte, min+s.Random().IntN(max-min+1))
 	for i := range textb {
-		textb[i] = source[random.Random.IntN(len(source))]
+		textb[i] = source[s.Random().IntN(len(source))]
 	}
 	return string(textb)
 }
 
 // Sentence generates an 'alice in wonderland' text of size words
 func Sentence(numWords int) string {
-	return SentencePrefix(2, numWords)
+	return sentenceIn(global(), numWords)
+}
+
+func sentenceIn(s *state.Scope, numWords int) string {
+	return sentencePrefixIn(s, 2, numWords)
 }
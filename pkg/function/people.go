@@ -27,29 +27,32 @@ import (
 	"strings"
 	"text/template"
 
-	"github.com/jrnd-io/jrv2/pkg/random"
 	"github.com/squeeze69/generacodicefiscale"
 
 	"github.com/rs/zerolog/log"
 )
 
 func init() {
-	AddFuncs(template.FuncMap{
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
 		// people related utilities
-		"cf":             CodiceFiscale,
-		"company":        Company,
-		"email":          Email,
-		"email_provider": EmailProvider,
-		"email_work":     WorkEmail,
-		"gender":         Gender,
-		"middlename":     Middlename,
-		"name":           Name,
-		"name_m":         NameM,
-		"name_f":         NameF,
-		"ssn":            Ssn,
-		"surname":        Surname,
-		"user":           User,
-		"username":       Username,
+		return template.FuncMap{
+			"cf":             func() string { return codiceFiscaleIn(s) },
+			"company":        func() string { return companyIn(s) },
+			"email":          func() string { return emailIn(s) },
+			"email_provider": func() string { return emailProviderIn(s) },
+			"email_work":     func() string { return workEmailIn(s) },
+			"gender":         func() string { return genderIn(s) },
+			"middlename":     func() string { return middlenameIn(s) },
+			"name":           func() string { return nameIn(s) },
+			"name_m":         func() string { return nameMIn(s) },
+			"name_f":         func() string { return nameFIn(s) },
+			"ssn":            func() string { return ssnIn(s) },
+			"surname":        func() string { return surnameIn(s) },
+			"user": func(firstName string, lastName string, size int) string {
+				return userIn(s, firstName, lastName, size)
+			},
+			"username": func(firstName string, lastName string) string { return usernameIn(s, firstName, lastName) },
+		}
 	})
 }
 
@@ -63,27 +66,31 @@ const (
 
 // CodiceFiscale return a valid Italian Codice Fiscale
 func CodiceFiscale() string {
+	return codiceFiscaleIn(global())
+}
+
+func codiceFiscaleIn(s *state.Scope) string {
 
-	name := state.GetSharedState().Value("_name").(string)
-	surname := state.GetSharedState().Value("_surname").(string)
-	gender := state.GetSharedState().Value("_gender").(string)
-	birthdate := state.GetSharedState().Value("_birthdate").(string)
-	city := state.GetSharedState().Value("_city").(string)
+	name := s.String("_name")
+	surname := s.String("_surname")
+	gender := s.String("_gender")
+	birthdate := s.String("_birthdate")
+	city := s.String("_city")
 
 	if name == "" {
-		name = Name()
+		name = nameIn(s)
 	}
 	if surname == "" {
-		surname = Surname()
+		surname = surnameIn(s)
 	}
 	if gender == "" {
-		gender = Gender()
+		gender = genderIn(s)
 	}
 	if birthdate == "" {
-		birthdate = BirthDate(18, 75)
+		birthdate = birthDateIn(s, 18, 75)
 	}
 	if city == "" {
-		city = City()
+		city = cityIn(s)
 	}
 
 	if city == "Bolzano" {
@@ -109,25 +116,33 @@ func CodiceFiscale() string {
 
 // Company returns a random Company Name
 func Company() string {
-	c := Word(CompanyMap)
-	state.GetSharedState().Ctx.Store("_company", c)
+	return companyIn(global())
+}
+
+func companyIn(s *state.Scope) string {
+	c := wordIn(s, CompanyMap)
+	s.Ctx.Store("_company", c)
 	return c
 }
 
 // WorkEmail returns a random work email.
 func WorkEmail() string {
-	name := state.GetSharedState().Value("_name").(string)
-	surname := state.GetSharedState().Value("_surname").(string)
-	company := state.GetSharedState().Value("_company").(string)
+	return workEmailIn(global())
+}
+
+func workEmailIn(s *state.Scope) string {
+	name := s.String("_name")
+	surname := s.String("_surname")
+	company := s.String("_company")
 
 	if name == "" {
-		name = Name()
+		name = nameIn(s)
 	}
 	if surname == "" {
-		surname = Surname()
+		surname = surnameIn(s)
 	}
 	if company == "" {
-		company = Company()
+		company = companyIn(s)
 	}
 	company = strings.ReplaceAll(company, " ", "")
 	return fmt.Sprintf("%s.%s@%s.com", strings.ToLower(name), strings.ToLower(surname), strings.ToLower(company))
@@ -135,15 +150,19 @@ func WorkEmail() string {
 
 // Email returns a random email.
 func Email() string {
-	name := state.GetSharedState().Value("_name").(string)
-	surname := state.GetSharedState().Value("_surname").(string)
-	provider := Word(MailProviderMap)
+	return emailIn(global())
+}
+
+func emailIn(s *state.Scope) string {
+	name := s.String("_name")
+	surname := s.String("_surname")
+	provider := wordIn(s, MailProviderMap)
 
 	if name == "" {
-		name = Name()
+		name = nameIn(s)
 	}
 	if surname == "" {
-		surname = Surname()
+		surname = surnameIn(s)
 	}
 
 	return fmt.Sprintf("%s.%s@%s", strings.ToLower(name), strings.ToLower(surname), strings.ToLower(provider))
@@ -151,78 +170,113 @@ func Email() string {
 
 // EmailProvider returns a random email provider
 func EmailProvider() string {
-	return Word(MailProviderMap)
+	return emailProviderIn(global())
+}
+
+func emailProviderIn(s *state.Scope) string {
+	return wordIn(s, MailProviderMap)
 }
 
 // Gender returns a random gender. Note: it gets the gender context automatically setup by previous name calls
 func Gender() string {
-	g := state.GetSharedState().Value("_gender").(string)
+	return genderIn(global())
+}
+
+func genderIn(s *state.Scope) string {
+	g := s.String("_gender")
 	if g == "" {
 		gender := []string{"M", "F"}
-		g = gender[random.Random.IntN(len(gender))]
-		state.GetSharedState().Ctx.Store("_gender", g)
+		g = gender[s.Random().IntN(len(gender))]
+		s.Ctx.Store("_gender", g)
 	}
 	return g
 }
 
 // Middlename returns a random Middlename
 func Middlename() string {
+	return middlenameIn(global())
+}
+
+func middlenameIn(s *state.Scope) string {
 	middles := []string{"M", "J", "K", "P", "T", "S"}
-	return middles[random.Random.IntN(len(middles))]
+	return middles[s.Random().IntN(len(middles))]
 }
 
 // Name returns a random Name (male/female)
 func Name() string {
-	s := random.Random.IntN(2)
-	if s == 0 {
-		return NameM()
+	return nameIn(global())
+}
+
+func nameIn(s *state.Scope) string {
+	if s.Random().IntN(2) == 0 {
+		return nameMIn(s)
 	}
 
-	return NameF()
+	return nameFIn(s)
 }
 
 // NameM returns a random male Name
 func NameM() string {
-	name := Word(NameMMap)
-	state.GetSharedState().Ctx.Store("_name", name)
-	state.GetSharedState().Ctx.Store("_gender", "M")
+	return nameMIn(global())
+}
+
+func nameMIn(s *state.Scope) string {
+	name := wordIn(s, NameMMap)
+	s.Ctx.Store("_name", name)
+	s.Ctx.Store("_gender", "M")
 	return name
 }
 
 // NameF returns a random female Name
 func NameF() string {
-	name := Word(NameFMap)
-	state.GetSharedState().Ctx.Store("_name", name)
-	state.GetSharedState().Ctx.Store("_gender", "F")
+	return nameFIn(global())
+}
+
+func nameFIn(s *state.Scope) string {
+	name := wordIn(s, NameFMap)
+	s.Ctx.Store("_name", name)
+	s.Ctx.Store("_gender", "F")
 	return name
 }
 
 // Ssn return a valid Social Security Number id
 func Ssn() string {
-	first := random.Random.IntN(899) + 1
-	second := random.Random.IntN(99) + 1
-	third := random.Random.IntN(9999) + 1
+	return ssnIn(global())
+}
+
+func ssnIn(s *state.Scope) string {
+	first := s.Random().IntN(899) + 1
+	second := s.Random().IntN(99) + 1
+	third := s.Random().IntN(9999) + 1
 	return fmt.Sprintf("%03d-%02d-%04d", first, second, third)
 }
 
 // Surname returns a random Surname
 func Surname() string {
-	s := Word(SurnameMap)
-	state.GetSharedState().Ctx.Store("_surname", "F")
-	return s
+	return surnameIn(global())
+}
+
+func surnameIn(s *state.Scope) string {
+	surname := wordIn(s, SurnameMap)
+	s.Ctx.Store("_surname", surname)
+	return surname
 }
 
 // Username returns a random Username using Name, Surname
 func Username(firstName string, lastName string) string {
+	return usernameIn(global(), firstName, lastName)
+}
+
+func usernameIn(s *state.Scope, firstName string, lastName string) string {
 
 	firstName = strings.ToLower(firstName)
 	lastName = strings.ToLower(lastName)
 
 	separators := []string{".", "-", "", "_", "."}
-	separator := separators[random.Random.IntN(len(separators))]
-	onlyInitialForName := (random.Random.IntN(2)) != 0
-	onlyInitialForSurname := (random.Random.IntN(2)) != 0
-	useSurname := (random.Random.IntN(2)) != 0
+	separator := separators[s.Random().IntN(len(separators))]
+	onlyInitialForName := (s.Random().IntN(2)) != 0
+	onlyInitialForSurname := (s.Random().IntN(2)) != 0
+	useSurname := (s.Random().IntN(2)) != 0
 
 	if onlyInitialForName {
 		firstName = firstName[:1]
@@ -242,11 +296,15 @@ func Username(firstName string, lastName string) string {
 
 // User returns a random Username using Name, Surname and a length
 func User(firstName string, lastName string, size int) string {
+	return userIn(global(), firstName, lastName, size)
+}
+
+func userIn(s *state.Scope, firstName string, lastName string, size int) string {
 
 	var name string
 
-	useSurname := (random.Random.IntN(2)) != 0
-	shuffleName := (random.Random.IntN(2)) != 0
+	useSurname := (s.Random().IntN(2)) != 0
+	shuffleName := (s.Random().IntN(2)) != 0
 	if useSurname || len(name) < size {
 		name = firstName + lastName
 	} else {
@@ -255,7 +313,7 @@ func User(firstName string, lastName string, size int) string {
 
 	if shuffleName {
 		nameRunes := []rune(name)
-		random.Random.Shuffle(len(nameRunes), func(i, j int) {
+		s.Random().Shuffle(len(nameRunes), func(i, j int) {
 			nameRunes[i], nameRunes[j] = nameRunes[j], nameRunes[i]
 		})
 		name = string(nameRunes)
@@ -266,7 +324,7 @@ func User(firstName string, lastName string, size int) string {
 		username += string(name[i])
 	}
 
-	username += strconv.Itoa(50 + random.Random.IntN(49))
+	username += strconv.Itoa(50 + s.Random().IntN(49))
 
 	return username
 }
@@ -25,18 +25,21 @@ import (
 	"text/template"
 
 	"github.com/biter777/countries"
-	"github.com/jrnd-io/jrv2/pkg/random"
 )
 
 func init() {
 	AddFuncs(template.FuncMap{
-		"country_code":    CountryCode,
 		"country_code_at": CountryCodeAt,
-		"imei":            Imei,
-		"phone":           Phone,
-		"phone_at":        PhoneAt,
-		"mobile_phone":    MobilePhone,
-		"mobile_phone_at": MobilePhoneAt,
+	})
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"country_code":    func() string { return countryCodeIn(s) },
+			"imei":            func() string { return imeiIn(s) },
+			"phone":           func() string { return phoneIn(s) },
+			"phone_at":        func(index int) string { return phoneAtIn(s, index) },
+			"mobile_phone":    func() string { return mobilePhoneIn(s) },
+			"mobile_phone_at": func(index int) string { return mobilePhoneAtIn(s, index) },
+		}
 	})
 }
 
@@ -47,9 +50,13 @@ const (
 
 // CountryCode returns a random Country Code prefix
 func CountryCode() string {
-	countryIndex := state.GetSharedState().CountryIndex
+	return countryCodeIn(global())
+}
+
+func countryCodeIn(s *state.Scope) string {
+	countryIndex := s.CountryIndex
 	if countryIndex == -1 {
-		index := random.Random.IntN(len(countries.All()))
+		index := s.Random().IntN(len(countries.All()))
 		return countries.ByNumeric(index).Info().CallCodes[0].String()
 	}
 
@@ -63,9 +70,13 @@ func CountryCodeAt(index int) string {
 
 // Imei returns a random imei number of 15 digits
 func Imei() string {
+	return imeiIn(global())
+}
+
+func imeiIn(s *state.Scope) string {
 	account := make([]byte, 14)
 	for i := range account {
-		account[i] = digits[random.Random.IntN(len(digits))]
+		account[i] = digits[s.Random().IntN(len(digits))]
 	}
 	first14 := string(account)
 	return first14 + LuhnCheckDigit(first14)
@@ -73,38 +84,54 @@ func Imei() string {
 
 // Phone returns a random land prefix
 func Phone() string {
-	cityIndex := state.GetSharedState().CityIndex
+	return phoneIn(global())
+}
+
+func phoneIn(s *state.Scope) string {
+	cityIndex := s.CityIndex
 	if cityIndex == -1 {
-		l := Word(PhoneMap)
-		lp, _ := Regex(l)
+		l := wordIn(s, PhoneMap)
+		lp, _ := regexIn(s, l)
 		return lp
 	}
 
-	return PhoneAt(cityIndex)
+	return phoneAtIn(s, cityIndex)
 }
 
 // PhoneAt returns a land prefix at a given index
 func PhoneAt(index int) string {
+	return phoneAtIn(global(), index)
+}
+
+func phoneAtIn(s *state.Scope, index int) string {
 	l := WordAt(PhoneMap, index)
-	lp, _ := Regex(l)
+	lp, _ := regexIn(s, l)
 	return lp
 }
 
 // MobilePhone returns a random mobile phone
 func MobilePhone() string {
-	countryIndex := state.GetSharedState().CountryIndex
+	return mobilePhoneIn(global())
+}
+
+func mobilePhoneIn(s *state.Scope) string {
+	countryIndex := s.CountryIndex
 	if countryIndex == -1 {
-		m := Word(MobilePhoneMap)
-		mp, _ := Regex(m)
+		m := wordIn(s, MobilePhoneMap)
+		mp, _ := regexIn(s, m)
 		return mp
 	}
 
-	return MobilePhoneAt(countryIndex)
+	return mobilePhoneAtIn(s, countryIndex)
 }
 
 // MobilePhoneAt returns a mobile phone at a given index
 func MobilePhoneAt(index int) string {
+	return mobilePhoneAtIn(global(), index)
+}
+
+func mobilePhoneAtIn(s *state.Scope, index int) string {
 	m := WordAt(MobilePhoneMap, index)
-	mp, _ := Regex(m)
+	mp, _ := regexIn(s, m)
 	return mp
 }
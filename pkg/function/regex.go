@@ -30,6 +30,7 @@ import (
 	"text/template"
 
 	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 )
 
 const runeRangeEnd = 0x10ffff
@@ -38,14 +39,17 @@ const printableChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRST
 var printableCharsNoNL = printableChars[:len(printableChars)-2]
 
 func init() {
-	AddFuncs(template.FuncMap{
-		"regex": Regex,
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"regex": func(regex string) (string, error) { return regexIn(s, regex) },
+		}
 	})
 
 }
 
 type regexState struct {
-	limit int
+	limit  int
+	random random.Source
 }
 
 //gocyclo:ignore
@@ -91,14 +95,14 @@ func generate(s *regexState, re *syntax.Regexp) string {
 			}
 			// fmt.Println("Possible chars: ", possibleChars)
 			if len(possibleChars) > 0 {
-				c := possibleChars[random.Random.IntN(len(possibleChars))]
+				c := possibleChars[s.random.IntN(len(possibleChars))]
 				// fmt.Printf("Generated rune %c for inverse range %v\n", c, re)
 				return string([]byte{c})
 			}
 		}
 
 		// fmt.Println("Char range: ", sum)
-		r := random.Random.IntN(sum)
+		r := s.random.IntN(sum)
 		var ru rune
 		sum = 0
 		for i := 0; i < len(re.Rune); i += 2 {
@@ -118,7 +122,7 @@ func generate(s *regexState, re *syntax.Regexp) string {
 		if op == syntax.OpAnyCharNotNL {
 			chars = printableCharsNoNL
 		}
-		c := chars[random.Random.IntN(len(chars))]
+		c := chars[s.random.IntN(len(chars))]
 		return string([]byte{c})
 	case syntax.OpBeginLine:
 	case syntax.OpEndLine:
@@ -132,7 +136,7 @@ func generate(s *regexState, re *syntax.Regexp) string {
 	case syntax.OpStar:
 		// Repeat zero or more times
 		res := ""
-		count := random.Random.IntN(s.limit + 1)
+		count := s.random.IntN(s.limit + 1)
 		for i := 0; i < count; i++ {
 			for _, r := range re.Sub {
 				res += generate(s, r)
@@ -142,7 +146,7 @@ func generate(s *regexState, re *syntax.Regexp) string {
 	case syntax.OpPlus:
 		// Repeat one or more times
 		res := ""
-		count := random.Random.IntN(s.limit) + 1
+		count := s.random.IntN(s.limit) + 1
 		for i := 0; i < count; i++ {
 			for _, r := range re.Sub {
 				res += generate(s, r)
@@ -152,7 +156,7 @@ func generate(s *regexState, re *syntax.Regexp) string {
 	case syntax.OpQuest:
 		// Zero or one instances
 		res := ""
-		count := random.Random.IntN(2)
+		count := s.random.IntN(2)
 		// fmt.Println("Quest", count)
 		for i := 0; i < count; i++ {
 			for _, r := range re.Sub {
@@ -168,7 +172,7 @@ func generate(s *regexState, re *syntax.Regexp) string {
 		count := 0
 		re.Max = int(math.Min(float64(re.Max), float64(s.limit)))
 		if re.Max > re.Min {
-			count = random.Random.IntN(re.Max - re.Min + 1)
+			count = s.random.IntN(re.Max - re.Min + 1)
 		}
 		// fmt.Println(re.Max, count)
 
@@ -188,7 +192,7 @@ func generate(s *regexState, re *syntax.Regexp) string {
 	case syntax.OpAlternate:
 		// fmt.Println("OpAlternative", re.Sub, len(re.Sub))
 
-		i := random.Random.IntN(len(re.Sub))
+		i := s.random.IntN(len(re.Sub))
 		return generate(s, re.Sub[i])
 	default:
 		_, _ = fmt.Fprintln(os.Stderr, "[reg-gen] Unhandled op: ", op)
@@ -198,9 +202,13 @@ func generate(s *regexState, re *syntax.Regexp) string {
 
 // Regex returns a random string matching the given Regex parameter
 func Regex(regex string) (string, error) {
+	return regexIn(global(), regex)
+}
+
+func regexIn(s *state.Scope, regex string) (string, error) {
 	re, err := syntax.Parse(regex, syntax.Perl)
 	if err != nil {
 		return "", err
 	}
-	return generate(&regexState{limit: 10}, re), err
+	return generate(&regexState{limit: 10, random: s.Random()}, re), err
 }
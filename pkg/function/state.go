@@ -21,60 +21,98 @@
 package function
 
 import (
-	"github.com/jrnd-io/jrv2/pkg/state"
+	"fmt"
 	"text/template"
+
+	"github.com/jrnd-io/jrv2/pkg/state"
 )
 
 func init() {
 	AddFuncs(template.FuncMap{
 		// context utilities
-		"add_v_to_list":            AddValueToList,
-		"random_v_from_list":       RandomValueFromList,
-		"random_n_v_from_list":     RandomNValuesFromList,
-		"get_v_from_list_at_index": GetValueFromListAtIndex,
-		"get_v":                    GetV,
-		"set_v":                    SetV,
-		"fromcsv":                  FromCSV,
+		"fromcsv": FromCSV,
+	})
+	// the names of the lists and of the values can be prefixed with the scope, i.e. "global:ids"
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"add_v_to_list":            func(l string, v string) string { return addValueToListIn(s, l, v) },
+			"random_v_from_list":       func(l string) any { return randomValueFromListIn(s, l) },
+			"random_n_v_from_list":     func(l string, n int) []string { return randomNValuesFromListIn(s, l, n) },
+			"get_v_from_list_at_index": func(l string, index int) string { return getValueFromListAtIndexIn(s, l, index) },
+			"get_v":                    func(k string) (string, error) { return getVIn(s, k) },
+			"set_v":                    func(k string, v string) string { return setVIn(s, k, v) },
+		}
 	})
-
 }
 
 // AddValueToList adds value v to Context list l
 func AddValueToList(l string, v string) string {
-	state.GetSharedState().AddValueToList(l, v)
+	return addValueToListIn(global(), l, v)
+}
+
+func addValueToListIn(s *state.Scope, l string, v string) string {
+	scope, name := s.Resolve(l)
+	scope.AddValueToList(name, v)
 	return ""
 }
 
 // RandomValueFromList returns a random value from Context list l
-func RandomValueFromList(s string) any {
-	return state.GetSharedState().RandomValueFromList(s)
+func RandomValueFromList(l string) any {
+	return randomValueFromListIn(global(), l)
+}
+
+func randomValueFromListIn(s *state.Scope, l string) any {
+	scope, name := s.Resolve(l)
+	return scope.RandomValueFromList(s.Random(), name)
 }
 
 // RandomNValuesFromList returns a random value from Context list l
-func RandomNValuesFromList(s string, n int) []string {
-	l := state.GetSharedState().RandomNValuesFromList(s, n)
+func RandomNValuesFromList(l string, n int) []string {
+	return randomNValuesFromListIn(global(), l, n)
+}
+
+func randomNValuesFromListIn(s *state.Scope, l string, n int) []string {
+	scope, name := s.Resolve(l)
+	values := scope.RandomNValuesFromList(s.Random(), name, n)
 	r := make([]string, 0)
-	for i := range l {
-		r = append(r, l[i].(string))
+	for i := range values {
+		r = append(r, values[i].(string))
 	}
 	return r
 }
 
 // GetValueFromListAtIndex returns a value from Context list l at index
-func GetValueFromListAtIndex(s string, index int) string {
+func GetValueFromListAtIndex(l string, index int) string {
+	return getValueFromListAtIndexIn(global(), l, index)
+}
+
+func getValueFromListAtIndexIn(s *state.Scope, l string, index int) string {
+	scope, name := s.Resolve(l)
+	return scope.GetValueFromListAtIndex(name, index).(string)
+}
 
-	return state.GetSharedState().GetValueFromListAtIndex(s, index).(string)
+// GetV gets value k from Context, returning an error if it was not set
+func GetV(k string) (string, error) {
+	return getVIn(global(), k)
 }
 
-// GetV gets value s from Context
-func GetV(s string) string {
-	v, _ := state.GetSharedState().Ctx.Load(s)
-	return v.(string)
+func getVIn(s *state.Scope, k string) (string, error) {
+	scope, name := s.Resolve(k)
+	v, ok := scope.Ctx.Load(name)
+	if !ok {
+		return "", fmt.Errorf("no value for key %q", k)
+	}
+	return fmt.Sprint(v), nil
 }
 
 // SetV adds value v to Context
-func SetV(s string, v string) string {
-	state.GetSharedState().Ctx.Store(s, v)
+func SetV(k string, v string) string {
+	return setVIn(global(), k, v)
+}
+
+func setVIn(s *state.Scope, k string, v string) string {
+	scope, name := s.Resolve(k)
+	scope.Ctx.Store(name, v)
 	return ""
 }
 
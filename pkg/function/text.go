@@ -23,7 +23,7 @@ package function
 import (
 	"errors"
 	"github.com/jrnd-io/jrv2/pkg/state"
-	"math/rand"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
@@ -36,45 +36,51 @@ import (
 func init() {
 	AddFuncs(template.FuncMap{
 		// text utilities
-		"atoi":                     Atoi,
-		"itoa":                     strconv.Itoa,
-		"concat":                   func(a string, b string) string { return a + b },
-		"counter":                  Counter,
-		"first":                    func(s string) string { return s[:1] },
-		"firstword":                func(s string) string { return strings.Split(s, " ")[0] },
-		"from":                     Word,
-		"from_at":                  WordAt,
-		"from_shuffle":             WordShuffle,
-		"from_n":                   WordShuffleN,
-		"join":                     strings.Join,
-		"len":                      Len,
-		"lower":                    strings.ToLower,
-		"random":                   func(s []string) string { return s[random.Random.IntN(len(s))] },
-		"randoms":                  func(s string) string { a := strings.Split(s, "|"); return a[random.Random.IntN(len(a))] },
-		"random_index":             RandomIndex,
-		"random_string":            RandomString,
-		"random_string_vocabulary": RandomStringVocabulary,
-		"regex":                    Regex, // to regex
-		"repeat":                   strings.Repeat,
-		"replaceall":               strings.ReplaceAll,
-		"squeeze":                  func(s string) string { return strings.ReplaceAll(s, " ", "") },
-		"squeezechars":             func(s, c string) string { return strings.ReplaceAll(s, c, "") },
-		"split":                    strings.Split,
-		"substr":                   func(start, length int, s string) string { return s[start:length] },
-		"trim":                     strings.TrimSpace,
-		"trimchars":                strings.Trim,
-		"title":                    cases.Title(language.English).String,
-		"upper":                    strings.ToUpper,
+		"atoi":         Atoi,
+		"itoa":         strconv.Itoa,
+		"concat":       func(a string, b string) string { return a + b },
+		"first":        func(s string) string { return s[:1] },
+		"firstword":    func(s string) string { return strings.Split(s, " ")[0] },
+		"from_at":      WordAt,
+		"join":         strings.Join,
+		"len":          Len,
+		"lower":        strings.ToLower,
+		"repeat":       strings.Repeat,
+		"replaceall":   strings.ReplaceAll,
+		"squeeze":      func(s string) string { return strings.ReplaceAll(s, " ", "") },
+		"squeezechars": func(s, c string) string { return strings.ReplaceAll(s, c, "") },
+		"split":        strings.Split,
+		"substr":       func(start, length int, s string) string { return s[start:length] },
+		"trim":         strings.TrimSpace,
+		"trimchars":    strings.Trim,
+		"title":        cases.Title(language.English).String,
+		"upper":        strings.ToUpper,
+	})
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"counter":                  func(c string, start, step int) int { return counterIn(s, c, start, step) },
+			"from":                     func(name string) string { return wordIn(s, name) },
+			"from_shuffle":             func(name string) []string { return wordShuffleIn(s, name) },
+			"from_n":                   func(name string, n int) []string { return wordShuffleNIn(s, name, n) },
+			"random":                   func(a []string) string { return a[s.Random().IntN(len(a))] },
+			"randoms":                  func(l string) string { return randomsIn(s, l) },
+			"random_index":             func(name string) string { return randomIndexIn(s, name) },
+			"random_string":            func(min, max int) string { return randomStringIn(s, min, max) },
+			"random_string_vocabulary": func(min, max int, source string) string { return randomStringVocabularyIn(s, min, max, source) },
+		}
 	})
 
 }
 
 func Randoms(s ...string) string {
+	return randomsIn(global(), s...)
+}
+
+func randomsIn(sc *state.Scope, s ...string) string {
 	a := strings.Split(s[0], "|")
 	// use normal random if only one argument is provided
 	if len(s) == 1 {
-		a := strings.Split(s[0], "|")
-		return a[random.Random.IntN(len(a))]
+		return a[sc.Random().IntN(len(a))]
 	}
 
 	// if more than one argument is provided, second argument is a list of float separated by "|"
@@ -89,7 +95,7 @@ func Randoms(s ...string) string {
 		w[i] = _w
 	}
 
-	ret, err := WeightedRandomString(a, w)
+	ret, err := weightedRandomStringFrom(sc.Random(), a, w)
 	if err != nil {
 		return ""
 	}
@@ -108,18 +114,34 @@ func Atoi(s string) int {
 
 // Counter creates a counter named c, starting from start and incrementing by step
 func Counter(c string, start, step int) int {
-	return state.GetSharedState().Counter(c, start, step)
+	return counterIn(global(), c, start, step)
+}
+
+// counterIn increments the counter c in the scope addressed by its prefix
+func counterIn(s *state.Scope, c string, start, step int) int {
+	scope, name := s.Resolve(c)
+	return scope.Counter(name, start, step)
 }
 
 // Word returns a random string from a list of strings in a file.
 func Word(name string) string {
+	return wordIn(global(), name)
+}
+
+func wordIn(s *state.Scope, name string) string {
+	w, _ := wordIndexIn(s, name)
+	return w
+}
+
+// wordIndexIn returns a random string from a list of strings in a file, with its index
+func wordIndexIn(s *state.Scope, name string) (string, int) {
 	_, err := Cache(name)
 	if err != nil {
-		return ""
+		return "", -1
 	}
-	words := data[name]
-	state.GetSharedState().LastIndex = random.Random.IntN(len(words))
-	return words[state.GetSharedState().LastIndex]
+	words := GetCache(name)
+	index := s.Random().IntN(len(words))
+	return words[index], index
 }
 
 // WordAt returns a string at a given position in a list of strings in a file.
@@ -128,28 +150,37 @@ func WordAt(name string, index int) string {
 	if err != nil {
 		return ""
 	}
-	words := data[name]
+	words := GetCache(name)
 	return words[index]
 }
 
 // WordShuffle returns a shuffled list of strings in a file.
 func WordShuffle(name string) []string {
+	return wordShuffleIn(global(), name)
+}
+
+func wordShuffleIn(s *state.Scope, name string) []string {
 	_, err := Cache(name)
 	if err != nil {
 		return []string{""}
 	}
-	words := data[name]
-	return WordShuffleN(name, len(words))
+	words := GetCache(name)
+	return wordShuffleNIn(s, name, len(words))
 }
 
-// wordShuffleN return a subset of n elements in a list of string in a file.
+// WordShuffleN return a subset of n elements in a list of string in a file.
 func WordShuffleN(name string, n int) []string {
+	return wordShuffleNIn(global(), name, n)
+}
+
+func wordShuffleNIn(s *state.Scope, name string, n int) []string {
 	_, err := Cache(name)
 	if err != nil {
 		return []string{""}
 	}
-	words := data[name]
-	random.Random.Shuffle(len(words), func(i, j int) {
+	// shuffling a copy, the cached words are shared among the emitters
+	words := slices.Clone(GetCache(name))
+	s.Random().Shuffle(len(words), func(i, j int) {
 		words[i], words[j] = words[j], words[i]
 	})
 	number := Minint(n, len(words))
@@ -162,29 +193,42 @@ func Len(name string) string {
 	if err != nil {
 		return ""
 	}
-	l := len(data[name])
+	l := len(GetCache(name))
 	return strconv.Itoa(l)
 }
 
 // RandomIndex returns a random index in a word file
 func RandomIndex(name string) string {
+	return randomIndexIn(global(), name)
+}
+
+func randomIndexIn(s *state.Scope, name string) string {
 	_, err := Cache(name)
 	if err != nil {
 		return ""
 	}
-	words := data[name]
-	state.GetSharedState().LastIndex = random.Random.IntN(len(words))
-	return strconv.Itoa(state.GetSharedState().LastIndex)
+	words := GetCache(name)
+	s.LastIndex = s.Random().IntN(len(words))
+	return strconv.Itoa(s.LastIndex)
 }
 
 // RandomString returns a random string long between min and max characters
 func RandomString(min, max int) string {
-	return RandomStringVocabulary(min, max, alphabet)
+	return randomStringIn(global(), min, max)
+}
+
+func randomStringIn(s *state.Scope, min, max int) string {
+	return randomStringVocabularyIn(s, min, max, alphabet)
 }
 
 // WeightedRandomString selects a random string from the given slice
 // with probability proportional to the corresponding weight.
 func WeightedRandomString(items []string, weights []float64) (string, error) {
+	return weightedRandomStringFrom(global().Random(), items, weights)
+}
+
+// weightedRandomStringFrom is WeightedRandomString drawing from r
+func weightedRandomStringFrom(r random.Source, items []string, weights []float64) (string, error) {
 	if len(items) != len(weights) {
 		return "", errors.New("items and weights slices must have the same length")
 	}
@@ -203,12 +247,12 @@ func WeightedRandomString(items []string, weights []float64) (string, error) {
 	}
 
 	// Generate a random number between 0 and totalWeight
-	r := rand.Float64() * totalWeight //nolint no need for a secure random generator
+	n := r.Float64() * totalWeight
 
 	// Find the selected item
 	for i, w := range weights {
-		r -= w
-		if r <= 0 {
+		n -= w
+		if n <= 0 {
 			return items[i], nil
 		}
 	}
@@ -220,6 +264,11 @@ func WeightedRandomString(items []string, weights []float64) (string, error) {
 // WeightedRandomInt selects a random integer from the given slice
 // with probability proportional to the corresponding weight.
 func WeightedRandomInt(items []int, weights []float64) (int, error) {
+	return weightedRandomIntFrom(global().Random(), items, weights)
+}
+
+// weightedRandomIntFrom is WeightedRandomInt drawing from r
+func weightedRandomIntFrom(r random.Source, items []int, weights []float64) (int, error) {
 	if len(items) != len(weights) {
 		return 0, errors.New("items and weights slices must have the same length")
 	}
@@ -238,12 +287,12 @@ func WeightedRandomInt(items []int, weights []float64) (int, error) {
 	}
 
 	// Generate a random number between 0 and totalWeight
-	r := rand.Float64() * totalWeight //nolint no need for a secure random generator
+	n := r.Float64() * totalWeight
 
 	// Find the selected item
 	for i, w := range weights {
-		r -= w
-		if r <= 0 {
+		n -= w
+		if n <= 0 {
 			return items[i], nil
 		}
 	}
@@ -24,42 +24,62 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 	"github.com/rs/zerolog/log"
 )
 
 func init() {
 	AddFuncs(template.FuncMap{
-		"birthdate":       BirthDate,
-		"date_between":    DateBetween,
-		"dates_between":   DatesBetween,
-		"future":          Future,
-		"past":            Past,
-		"recent":          Recent,
-		"soon":            Soon,
-		"now":             Now,
-		"unix_time_stamp": UnixTimeStamp,
+		"now": Now,
 	})
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"birthdate":    func(minAge int, maxAge int) string { return birthDateIn(s, minAge, maxAge) },
+			"date_between": func(fromDate string, toDate string) string { return dateBetweenIn(s, fromDate, toDate) },
+			"dates_between": func(fromDate string, toDate string, num int) []string {
+				return datesBetweenIn(s, fromDate, toDate, num)
+			},
+			"future":          func(years int) string { return futureIn(s, years) },
+			"past":            func(years int) string { return pastIn(s, years) },
+			"recent":          func(days int) string { return recentIn(s, days) },
+			"soon":            func(days int) string { return soonIn(s, days) },
+			"unix_time_stamp": func(days int) int64 { return unixTimeStampIn(s, days) },
+		}
+	})
+}
+
+// clockNow returns the current time of the clock of the run, which can be simulated
+func clockNow() time.Time {
+	return state.GetSharedState().Execution.Now()
 }
 
+// Now returns the current time of the clock of the run in the given format
 func Now(format string) string {
-	return time.Now().Format(format)
+	return clockNow().Format(format)
 }
 
 // UnixTimeStamp returns a random unix timestamp not older than the given number of days
 func UnixTimeStamp(days int) int64 {
+	return unixTimeStampIn(global(), days)
+}
+
+func unixTimeStampIn(s *state.Scope, days int) int64 {
 	if days <= 0 {
-		return time.Now().Unix()
+		return clockNow().Unix()
 	}
 	unixEpoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
-	now := time.Now()
+	now := clockNow()
 	first := now.AddDate(0, 0, -days).Sub(unixEpoch).Seconds()
 	last := now.Sub(unixEpoch).Seconds()
-	return random.Random.Int64N(int64(last-first)) + int64(first)
+	return s.Random().Int64N(int64(last-first)) + int64(first)
 }
 
 // DateBetween returns a date between fromDate and toDate
 func DateBetween(fromDate string, toDate string) string {
+	return dateBetweenIn(global(), fromDate, toDate)
+}
+
+func dateBetweenIn(s *state.Scope, fromDate string, toDate string) string {
 	start, err := time.Parse(time.DateOnly, fromDate)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error parsing date")
@@ -75,7 +95,7 @@ func DateBetween(fromDate string, toDate string) string {
 	}
 
 	delta := end.Sub(start).Nanoseconds()
-	randNsec := random.Random.Int64N(delta)
+	randNsec := s.Random().Int64N(delta)
 
 	d := start.Add(time.Duration(randNsec))
 	return d.Format(time.DateOnly)
@@ -83,25 +103,33 @@ func DateBetween(fromDate string, toDate string) string {
 
 // DatesBetween returns an array of num dates between fromDate and toDate
 func DatesBetween(fromDate string, toDate string, num int) []string {
+	return datesBetweenIn(global(), fromDate, toDate, num)
+}
+
+func datesBetweenIn(s *state.Scope, fromDate string, toDate string, num int) []string {
 
 	dates := make([]string, num)
 	for i := 0; i < len(dates); i++ {
-		dates[i] = DateBetween(fromDate, toDate)
+		dates[i] = dateBetweenIn(s, fromDate, toDate)
 	}
 	return dates
 }
 
 // BirthDate returns a birthdate between minAge and maxAge
 func BirthDate(minAge int, maxAge int) string {
+	return birthDateIn(global(), minAge, maxAge)
+}
 
-	maxBirthYear := time.Now().Year() - minAge
+func birthDateIn(s *state.Scope, minAge int, maxAge int) string {
+
+	maxBirthYear := clockNow().Year() - minAge
 	minBirthYear := maxBirthYear - (maxAge - minAge)
 
-	birthYear := random.Random.IntN(maxBirthYear-minBirthYear+1) + minBirthYear
+	birthYear := s.Random().IntN(maxBirthYear-minBirthYear+1) + minBirthYear
 
-	birthMonth := random.Random.IntN(12) + 1
+	birthMonth := s.Random().IntN(12) + 1
 	lastDayOfMonth := time.Date(birthYear, time.Month(birthMonth+1), 0, 0, 0, 0, 0, time.UTC).Day()
-	birthDay := random.Random.IntN(lastDayOfMonth) + 1
+	birthDay := s.Random().IntN(lastDayOfMonth) + 1
 
 	d := time.Date(birthYear, time.Month(birthMonth), birthDay, 0, 0, 0, 0, time.UTC)
 	return d.Format(time.DateOnly)
@@ -109,52 +137,68 @@ func BirthDate(minAge int, maxAge int) string {
 
 // Past returns a date in the past not before the given years
 func Past(years int) string {
+	return pastIn(global(), years)
+}
+
+func pastIn(s *state.Scope, years int) string {
 	if years <= 0 {
-		return time.Now().Format(time.DateOnly)
+		return clockNow().Format(time.DateOnly)
 	}
-	now := time.Now().UTC()
+	now := clockNow().UTC()
 	start := now.AddDate(-years, 0, 0)
 	delta := now.Sub(start).Nanoseconds()
-	randNsec := random.Random.Int64N(delta)
+	randNsec := s.Random().Int64N(delta)
 	d := start.Add(time.Duration(randNsec))
 	return d.Format(time.DateOnly)
 }
 
 // Future returns a date in the future not after the given years
 func Future(years int) string {
+	return futureIn(global(), years)
+}
+
+func futureIn(s *state.Scope, years int) string {
 	if years <= 0 {
-		return time.Now().Format(time.DateOnly)
+		return clockNow().Format(time.DateOnly)
 	}
-	now := time.Now().UTC()
+	now := clockNow().UTC()
 	start := now.AddDate(years, 0, 0)
 	delta := start.Sub(now).Nanoseconds()
-	randNsec := random.Random.Int64N(delta)
+	randNsec := s.Random().Int64N(delta)
 	d := now.Add(time.Duration(randNsec))
 	return d.Format(time.DateOnly)
 }
 
 // Recent returns a date in the past not before the given days
 func Recent(days int) string {
+	return recentIn(global(), days)
+}
+
+func recentIn(s *state.Scope, days int) string {
 	if days <= 0 {
-		return time.Now().Format(time.DateOnly)
+		return clockNow().Format(time.DateOnly)
 	}
-	now := time.Now().UTC()
+	now := clockNow().UTC()
 	start := now.AddDate(0, 0, -days)
 	delta := now.Sub(start).Nanoseconds()
-	randNsec := random.Random.Int64N(delta)
+	randNsec := s.Random().Int64N(delta)
 	d := start.Add(time.Duration(randNsec))
 	return d.Format(time.DateOnly)
 }
 
 // Soon returns a date in the future not after the given days
 func Soon(days int) string {
+	return soonIn(global(), days)
+}
+
+func soonIn(s *state.Scope, days int) string {
 	if days <= 0 {
-		return time.Now().Format(time.DateOnly)
+		return clockNow().Format(time.DateOnly)
 	}
-	now := time.Now().UTC()
+	now := clockNow().UTC()
 	start := now.AddDate(0, 0, days)
 	delta := start.Sub(now).Nanoseconds()
-	randNsec := random.Random.Int64N(delta)
+	randNsec := s.Random().Int64N(delta)
 	d := now.Add(time.Duration(randNsec))
 	return d.Format(time.DateOnly)
 }
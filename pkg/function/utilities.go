@@ -22,11 +22,14 @@ package function
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
 
 	"github.com/google/uuid"
 	"github.com/rs/xid"
@@ -35,26 +38,39 @@ import (
 func init() {
 	AddFuncs(template.FuncMap{
 		"array":    func(count int) []int { return make([]int, count) },
-		"bool":     RandomBool,
-		"image":    Image,
 		"image_of": ImageOf,
 		"index_of": IndexOf,
-		"inject":   Inject,
-		"key":      func(name string, n int) string { return fmt.Sprintf("%s%d", name, random.Random.IntN(n)) },
-		"uuid":     UniqueID,
 		"xid":      Xid,
-		"yesorno":  YesOrNo,
+	})
+	AddScopedFuncs(func(s *state.Scope) template.FuncMap {
+		return template.FuncMap{
+			"bool":  func() string { return randomBoolIn(s) },
+			"image": func(width int, height int) string { return imageIn(s, width, height) },
+			"inject": func(probability float64, injected, original any) any {
+				return injectIn(s, probability, injected, original)
+			},
+			"key":          func(name string, n int) string { return fmt.Sprintf("%s%d", name, s.Random().IntN(n)) },
+			"key_hotset":   func(name string, n int, hot int, p float64) string { return keyHotSetIn(s, name, n, hot, p) },
+			"key_powerlaw": func(name string, n int, alpha float64) string { return keyPowerLawIn(s, name, n, alpha) },
+			"key_zipf":     func(name string, n int, exp float64) (string, error) { return keyZipfIn(s, name, n, exp) },
+			"uuid":         func() string { return uniqueIDIn(s) },
+			"yesorno":      func() string { return yesOrNoIn(s) },
+		}
 	})
 
 }
 
 // Image generates a random Image url of given width, height and type
 func Image(width int, height int) string {
+	return imageIn(global(), width, height)
+}
+
+func imageIn(s *state.Scope, width int, height int) string {
 	imageType := []string{"abstract", "animals", "business", "cats", "city", "fashion", "food", "nature", "nightlife", "people", "sport", "technics", "transport"}
 	return ImageOf(
 		width,
 		height,
-		imageType[random.Random.IntN(len(imageType))],
+		imageType[s.Random().IntN(len(imageType))],
 	)
 }
 
@@ -65,7 +81,11 @@ func ImageOf(width int, height int, imageType string) string {
 
 // RandomBool returns a random boolean
 func RandomBool() string {
-	b := random.Random.IntN(2)
+	return randomBoolIn(global())
+}
+
+func randomBoolIn(s *state.Scope) string {
+	b := s.Random().IntN(2)
 	if b == 0 {
 		return "false"
 	}
@@ -73,8 +93,48 @@ func RandomBool() string {
 	return "true"
 }
 
+// KeyZipf returns one of n keys with a prefix, the key i drawn with a probability proportional to 1/(i+1)^s
+func KeyZipf(name string, n int, s float64) (string, error) {
+	return keyZipfIn(global(), name, n, s)
+}
+
+func keyZipfIn(s *state.Scope, name string, n int, exp float64) (string, error) {
+	if !(exp > 0) || math.IsInf(exp, 1) {
+		return "", fmt.Errorf("the exponent of key_zipf must be positive and finite, got %v", exp)
+	}
+	return fmt.Sprintf("%s%d", name, random.ZipfIndex(s.Random(), n, exp)), nil
+}
+
+// KeyPowerLaw returns one of n keys with a prefix, drawn from a power law of exponent alpha
+func KeyPowerLaw(name string, n int, alpha float64) string {
+	return keyPowerLawIn(global(), name, n, alpha)
+}
+
+func keyPowerLawIn(s *state.Scope, name string, n int, alpha float64) string {
+	return fmt.Sprintf("%s%d", name, random.PowerLawIndex(s.Random(), n, alpha))
+}
+
+// KeyHotSet returns one of n keys with a prefix, one of the first hot keys with probability p
+func KeyHotSet(name string, n int, hot int, p float64) string {
+	return keyHotSetIn(global(), name, n, hot, p)
+}
+
+func keyHotSetIn(s *state.Scope, name string, n int, hot int, p float64) string {
+	return fmt.Sprintf("%s%d", name, random.HotSetIndex(s.Random(), n, hot, p))
+}
+
 // UniqueId returns a random uuid
 func UniqueID() string {
+	return uniqueIDIn(global())
+}
+
+// uniqueIDIn reads the uuid from the source of s when it is seeded
+func uniqueIDIn(s *state.Scope) string {
+	if r, ok := s.Random().(io.Reader); ok {
+		if id, err := uuid.NewRandomFromReader(r); err == nil {
+			return id.String()
+		}
+	}
 	return uuid.New().String()
 }
 
@@ -83,7 +143,11 @@ func Xid() string { return xid.New().String() }
 
 // YesOrNo returns a random yes or no
 func YesOrNo() string {
-	b := random.Random.IntN(2)
+	return yesOrNoIn(global())
+}
+
+func yesOrNoIn(s *state.Scope) string {
+	b := s.Random().IntN(2)
 	if b == 0 {
 		return "no"
 	}
@@ -103,7 +167,11 @@ func Contains(s []string, str string) bool {
 
 // Inject is used to inject a different value with a given probability, typically used to generate a bad value
 func Inject(probability float64, injected, original any) any {
-	if random.Random.Float64() < probability {
+	return injectIn(global(), probability, injected, original)
+}
+
+func injectIn(s *state.Scope, probability float64, injected, original any) any {
+	if s.Random().Float64() < probability {
 		return injected
 	}
 	return original
@@ -0,0 +1,115 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package function_test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/function"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+// keyCounts draws count keys with f and returns how many times every index was drawn
+func keyCounts(t *testing.T, n int, count int, f func() string) []int {
+	t.Helper()
+	counts := make([]int, n)
+	for range count {
+		k := f()
+		i, err := strconv.Atoi(strings.TrimPrefix(k, "KEY"))
+		if err != nil || i < 0 || i >= n {
+			t.Fatalf("unexpected key %s", k)
+		}
+		counts[i]++
+	}
+	return counts
+}
+
+// keyZipf draws a key with KeyZipf, failing t on error
+func keyZipf(t *testing.T, n int, s float64) string {
+	t.Helper()
+	k, err := function.KeyZipf("KEY", n, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeyZipf(t *testing.T) {
+	random.SetRandom(0)
+	counts := keyCounts(t, 100, 20000, func() string { return keyZipf(t, 100, 1) })
+	// with exponent 1, the first key is drawn twice as often as the second, and ten times as often as the tenth
+	assert.InDelta(t, 2, float64(counts[0])/float64(counts[1]), 0.3)
+	assert.InDelta(t, 10, float64(counts[0])/float64(counts[9]), 2)
+	assert.InDelta(t, 1/5.187, float64(counts[0])/20000, 0.02)
+	assert.Equal(t, "KEY0", keyZipf(t, 1, 1))
+
+	for _, s := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		_, err := function.KeyZipf("KEY", 100, s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestKeyZipfManyKeys(t *testing.T) {
+	random.SetRandom(0)
+	// the keys are drawn without a table, with the same distribution: with exponent 1.1 and 10^8 keys
+	// the first key is drawn 2^1.1 times as often as the second, with probability 1/9.0
+	n := 100000000
+	counts := make(map[string]int)
+	for range 20000 {
+		counts[keyZipf(t, n, 1.1)]++
+	}
+	assert.InDelta(t, math.Pow(2, 1.1), float64(counts["KEY0"])/float64(counts["KEY1"]), 0.3)
+	assert.InDelta(t, 1/9.0, float64(counts["KEY0"])/20000, 0.02)
+}
+
+func TestKeyPowerLaw(t *testing.T) {
+	random.SetRandom(0)
+	counts := keyCounts(t, 1000, 20000, func() string { return function.KeyPowerLaw("KEY", 1000, 2) })
+	// the first key takes half of the draws with exponent 2
+	assert.InDelta(t, 0.5, float64(counts[0])/20000, 0.02)
+	assert.Greater(t, counts[1], counts[10])
+	assert.Greater(t, counts[10], counts[500])
+
+	counts = keyCounts(t, 10, 20000, func() string { return function.KeyPowerLaw("KEY", 10, 1) })
+	for i := 1; i < len(counts); i++ {
+		assert.Greater(t, counts[i-1], counts[i], fmt.Sprintf("key %d", i))
+	}
+}
+
+func TestKeyHotSet(t *testing.T) {
+	random.SetRandom(0)
+	counts := keyCounts(t, 100, 20000, func() string { return function.KeyHotSet("KEY", 100, 2, 0.8) })
+	assert.InDelta(t, 0.8, float64(counts[0]+counts[1])/20000, 0.02)
+	for i := 2; i < len(counts); i++ {
+		assert.Less(t, counts[i], counts[0]/10, fmt.Sprintf("key %d", i))
+	}
+
+	// with all the keys hot the draws are uniform
+	counts = keyCounts(t, 4, 20000, func() string { return function.KeyHotSet("KEY", 4, 4, 0.8) })
+	for _, c := range counts {
+		assert.InDelta(t, 5000, c, 300)
+	}
+}
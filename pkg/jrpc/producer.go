@@ -22,8 +22,15 @@ package jrpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
 	"github.com/hashicorp/go-plugin"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -44,8 +51,29 @@ type Producer interface {
 	Produce([]byte, []byte, map[string]string, map[string]string) (*ProduceResponse, error)
 }
 
+// BatchProducer is implemented by the producers which can produce many objects at once.
+// A response must be returned for every request, in the same order, with the Error of the objects
+// which can't be produced.
+type BatchProducer interface {
+	ProduceBatch([]*ProduceRequest) ([]*ProduceResponse, error)
+}
+
+// Lifecycle is implemented by the producers which must be configured for every emitter, checked,
+// flushed or closed gracefully, draining the buffered objects before exiting.
+// Flush writes the objects of the emitter in configParams.
+type Lifecycle interface {
+	Configure(configParams map[string]string, config []byte) error
+	HealthCheck() error
+	Flush(configParams map[string]string) error
+	Close() error
+}
+
 // GRPC Client
-type GRPCClient struct{ client ProducerClient }
+type GRPCClient struct {
+	client       ProducerClient
+	capabilities *CapabilitiesResponse
+	lock         sync.Mutex
+}
 
 func (m *GRPCClient) Produce(key []byte, v []byte, headers map[string]string, configParams map[string]string) (*ProduceResponse, error) {
 	resp, err := m.client.Produce(context.Background(), &ProduceRequest{Key: key, Value: v, Headers: headers, ConfigParams: configParams})
@@ -55,6 +83,135 @@ func (m *GRPCClient) Produce(key []byte, v []byte, headers map[string]string, co
 	return resp, nil
 }
 
+// Capabilities returns the calls supported by the plugin, asking them until they are known.
+// Older plugins, not implementing Capabilities, only support Produce: the same is returned while
+// the plugin can't be asked, for example because it is unavailable, and it is asked again at the next call.
+func (m *GRPCClient) Capabilities() *CapabilitiesResponse {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.capabilities != nil {
+		return m.capabilities
+	}
+	resp, err := m.client.Capabilities(context.Background(), &CapabilitiesRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		resp = &CapabilitiesResponse{}
+	case err != nil:
+		return &CapabilitiesResponse{}
+	}
+	m.capabilities = resp
+	return m.capabilities
+}
+
+// ProduceBatch produces the requests with the best call supported by the plugin: ProduceBatch,
+// ProduceStream or Produce for every request. A response is returned for every request, in the
+// same order, with the Error of the objects which can't be produced.
+func (m *GRPCClient) ProduceBatch(requests []*ProduceRequest) ([]*ProduceResponse, error) {
+	capabilities := m.Capabilities()
+	size := len(requests)
+	if capabilities.MaxBatchSize > 0 {
+		size = min(size, int(capabilities.MaxBatchSize))
+	}
+
+	responses := make([]*ProduceResponse, 0, len(requests))
+	for len(requests) > 0 {
+		batch := requests[:min(size, len(requests))]
+		requests = requests[len(batch):]
+
+		var resps []*ProduceResponse
+		var err error
+		switch {
+		case capabilities.Batch:
+			resps, err = m.produceBatch(batch)
+		case capabilities.Stream:
+			resps, err = m.produceStream(batch)
+		default:
+			resps = m.produceEach(batch)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(resps) != len(batch) {
+			return nil, fmt.Errorf("%d responses received for a batch of %d objects", len(resps), len(batch))
+		}
+		responses = append(responses, resps...)
+	}
+	return responses, nil
+}
+
+func (m *GRPCClient) produceBatch(requests []*ProduceRequest) ([]*ProduceResponse, error) {
+	resp, err := m.client.ProduceBatch(context.Background(), &ProduceBatchRequest{Requests: requests})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Responses, nil
+}
+
+func (m *GRPCClient) produceStream(requests []*ProduceRequest) ([]*ProduceResponse, error) {
+	stream, err := m.client.ProduceStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			// the error of the stream is returned by CloseAndRecv
+			break
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Responses, nil
+}
+
+func (m *GRPCClient) produceEach(requests []*ProduceRequest) []*ProduceResponse {
+	responses := make([]*ProduceResponse, len(requests))
+	for i, req := range requests {
+		resp, err := m.client.Produce(context.Background(), req)
+		if err != nil {
+			resp = &ProduceResponse{Error: status.Convert(err).Message()}
+		}
+		responses[i] = resp
+	}
+	return responses
+}
+
+// Configure configures the plugin for an emitter. The lifecycle calls are ignored by the older plugins.
+func (m *GRPCClient) Configure(configParams map[string]string, config []byte) error {
+	_, err := m.client.Configure(context.Background(), &ConfigureRequest{ConfigParams: configParams, Config: config})
+	return ignoreUnimplemented(err)
+}
+
+func (m *GRPCClient) HealthCheck() error {
+	resp, err := m.client.HealthCheck(context.Background(), &HealthCheckRequest{})
+	if err != nil {
+		return ignoreUnimplemented(err)
+	}
+	if !resp.Healthy {
+		return fmt.Errorf("plugin not healthy: %s", resp.Message)
+	}
+	return nil
+}
+
+func (m *GRPCClient) Flush(configParams map[string]string) error {
+	_, err := m.client.Flush(context.Background(), &FlushRequest{ConfigParams: configParams})
+	return ignoreUnimplemented(err)
+}
+
+func (m *GRPCClient) Close() error {
+	_, err := m.client.Close(context.Background(), &CloseRequest{})
+	return ignoreUnimplemented(err)
+}
+
+// ignoreUnimplemented ignores the errors of the calls not implemented by the older plugins
+func ignoreUnimplemented(err error) error {
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	return err
+}
+
 type GRPCServer struct {
 	Impl Producer
 }
@@ -66,6 +223,108 @@ func (m *GRPCServer) Produce(
 	return m.Impl.Produce(req.Key, req.Value, req.Headers, req.ConfigParams)
 }
 
+func (m *GRPCServer) ProduceBatch(
+	_ context.Context,
+	req *ProduceBatchRequest) (*ProduceBatchResponse, error) {
+
+	responses, err := m.produceBatch(req.Requests)
+	if err != nil {
+		return nil, err
+	}
+	return &ProduceBatchResponse{Responses: responses}, nil
+}
+
+func (m *GRPCServer) ProduceStream(stream grpc.ClientStreamingServer[ProduceRequest, ProduceBatchResponse]) error {
+	var requests []*ProduceRequest
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		requests = append(requests, req)
+	}
+
+	responses, err := m.produceBatch(requests)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&ProduceBatchResponse{Responses: responses})
+}
+
+// Capabilities of the server: batches are produced one by one if Impl is not a BatchProducer
+func (m *GRPCServer) Capabilities(
+	_ context.Context,
+	_ *CapabilitiesRequest) (*CapabilitiesResponse, error) {
+
+	return &CapabilitiesResponse{Batch: true, Stream: true}, nil
+}
+
+func (m *GRPCServer) Configure(
+	_ context.Context,
+	req *ConfigureRequest) (*ConfigureResponse, error) {
+
+	if impl, ok := m.Impl.(Lifecycle); ok {
+		if err := impl.Configure(req.ConfigParams, req.Config); err != nil {
+			return nil, err
+		}
+	}
+	return &ConfigureResponse{}, nil
+}
+
+func (m *GRPCServer) HealthCheck(
+	_ context.Context,
+	_ *HealthCheckRequest) (*HealthCheckResponse, error) {
+
+	if impl, ok := m.Impl.(Lifecycle); ok {
+		if err := impl.HealthCheck(); err != nil {
+			return &HealthCheckResponse{Healthy: false, Message: err.Error()}, nil
+		}
+	}
+	return &HealthCheckResponse{Healthy: true}, nil
+}
+
+func (m *GRPCServer) Flush(
+	_ context.Context,
+	req *FlushRequest) (*FlushResponse, error) {
+
+	if impl, ok := m.Impl.(Lifecycle); ok {
+		if err := impl.Flush(req.ConfigParams); err != nil {
+			return nil, err
+		}
+	}
+	return &FlushResponse{}, nil
+}
+
+func (m *GRPCServer) Close(
+	_ context.Context,
+	_ *CloseRequest) (*CloseResponse, error) {
+
+	if impl, ok := m.Impl.(Lifecycle); ok {
+		if err := impl.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return &CloseResponse{}, nil
+}
+
+func (m *GRPCServer) produceBatch(requests []*ProduceRequest) ([]*ProduceResponse, error) {
+	if impl, ok := m.Impl.(BatchProducer); ok {
+		return impl.ProduceBatch(requests)
+	}
+	responses := make([]*ProduceResponse, len(requests))
+	for i, req := range requests {
+		resp, err := m.Impl.Produce(req.Key, req.Value, req.Headers, req.ConfigParams)
+		if err != nil {
+			resp = &ProduceResponse{Error: err.Error()}
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
+
 // Plugin Map
 var PluginMap = map[string]plugin.Plugin{
 	JRProducerGRPCPlugin: &ProducerGRPCPlugin{},
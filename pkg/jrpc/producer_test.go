@@ -0,0 +1,240 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package jrpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// countingProducer fails the objects with value "bad"
+type countingProducer struct {
+	produced atomic.Int64
+}
+
+func (p *countingProducer) Produce(_ []byte, value []byte, _ map[string]string, _ map[string]string) (*jrpc.ProduceResponse, error) {
+	p.produced.Add(1)
+	if string(value) == "bad" {
+		return nil, errors.New("bad value")
+	}
+	return &jrpc.ProduceResponse{Bytes: uint64(len(value))}, nil
+}
+
+// legacyServer only implements Produce, like the plugins built before batches
+type legacyServer struct {
+	jrpc.UnimplementedProducerServer
+	server *jrpc.GRPCServer
+}
+
+func (s *legacyServer) Produce(ctx context.Context, req *jrpc.ProduceRequest) (*jrpc.ProduceResponse, error) {
+	return s.server.Produce(ctx, req)
+}
+
+// streamServer implements ProduceStream but not ProduceBatch
+type streamServer struct {
+	legacyServer
+	streams atomic.Int64
+}
+
+func (s *streamServer) ProduceStream(stream grpc.ClientStreamingServer[jrpc.ProduceRequest, jrpc.ProduceBatchResponse]) error {
+	s.streams.Add(1)
+	return s.server.ProduceStream(stream)
+}
+
+func (s *streamServer) Capabilities(context.Context, *jrpc.CapabilitiesRequest) (*jrpc.CapabilitiesResponse, error) {
+	return &jrpc.CapabilitiesResponse{Stream: true, MaxBatchSize: 2}, nil
+}
+
+// unavailableServer fails the first Capabilities call, as a plugin not ready yet
+type unavailableServer struct {
+	streamServer
+	calls atomic.Int64
+}
+
+func (s *unavailableServer) Capabilities(ctx context.Context, req *jrpc.CapabilitiesRequest) (*jrpc.CapabilitiesResponse, error) {
+	if s.calls.Add(1) == 1 {
+		return nil, status.Error(codes.Unavailable, "not ready")
+	}
+	return s.streamServer.Capabilities(ctx, req)
+}
+
+// newClient serves server in memory, returning a client connected to it
+func newClient(t *testing.T, server jrpc.ProducerServer) *jrpc.GRPCClient {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	jrpc.RegisterProducerServer(s, server)
+	go func() {
+		_ = s.Serve(listener)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	client, err := (&jrpc.ProducerGRPCPlugin{}).GRPCClient(context.Background(), nil, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.(*jrpc.GRPCClient)
+}
+
+func requests(values ...string) []*jrpc.ProduceRequest {
+	reqs := make([]*jrpc.ProduceRequest, len(values))
+	for i, v := range values {
+		reqs[i] = &jrpc.ProduceRequest{Value: []byte(v)}
+	}
+	return reqs
+}
+
+func assertResponses(t *testing.T, responses []*jrpc.ProduceResponse, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, responses, 3)
+	assert.Equal(t, uint64(3), responses[0].Bytes)
+	assert.Equal(t, "bad value", responses[1].Error)
+	assert.Equal(t, uint64(4), responses[2].Bytes)
+}
+
+func TestProduceBatch(t *testing.T) {
+	producer := &countingProducer{}
+	client := newClient(t, &jrpc.GRPCServer{Impl: producer})
+
+	capabilities := client.Capabilities()
+	assert.True(t, capabilities.Batch)
+	assert.True(t, capabilities.Stream)
+
+	responses, err := client.ProduceBatch(requests("one", "bad", "four"))
+	assertResponses(t, responses, err)
+	assert.Equal(t, int64(3), producer.produced.Load())
+}
+
+func TestProduceStream(t *testing.T) {
+	producer := &countingProducer{}
+	server := &streamServer{legacyServer: legacyServer{server: &jrpc.GRPCServer{Impl: producer}}}
+	client := newClient(t, server)
+
+	responses, err := client.ProduceBatch(requests("one", "bad", "four"))
+	assertResponses(t, responses, err)
+	// the batch is split by the maximum batch size of the plugin
+	assert.Equal(t, int64(2), server.streams.Load())
+}
+
+func TestProduceBatchFallback(t *testing.T) {
+	producer := &countingProducer{}
+	client := newClient(t, &legacyServer{server: &jrpc.GRPCServer{Impl: producer}})
+
+	capabilities := client.Capabilities()
+	assert.False(t, capabilities.Batch)
+	assert.False(t, capabilities.Stream)
+
+	responses, err := client.ProduceBatch(requests("one", "bad", "four"))
+	assertResponses(t, responses, err)
+	assert.Equal(t, int64(3), producer.produced.Load())
+}
+
+func TestCapabilitiesRetry(t *testing.T) {
+	server := &unavailableServer{streamServer: streamServer{legacyServer: legacyServer{server: &jrpc.GRPCServer{Impl: &countingProducer{}}}}}
+	client := newClient(t, server)
+
+	// the fallback of a failed call is not kept, the capabilities are asked again until they are known
+	assert.False(t, client.Capabilities().Stream)
+	assert.True(t, client.Capabilities().Stream)
+	assert.True(t, client.Capabilities().Stream)
+	assert.Equal(t, int64(2), server.calls.Load())
+}
+
+// lifecycleProducer records the lifecycle calls
+type lifecycleProducer struct {
+	countingProducer
+	configured map[string]string
+	config     []byte
+	flushed    map[string]string
+	closed     bool
+	unhealthy  error
+}
+
+func (p *lifecycleProducer) Configure(configParams map[string]string, config []byte) error {
+	p.configured = configParams
+	p.config = config
+	return nil
+}
+
+func (p *lifecycleProducer) HealthCheck() error {
+	return p.unhealthy
+}
+
+func (p *lifecycleProducer) Flush(configParams map[string]string) error {
+	p.flushed = configParams
+	return nil
+}
+
+func (p *lifecycleProducer) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestLifecycle(t *testing.T) {
+	producer := &lifecycleProducer{}
+	client := newClient(t, &jrpc.GRPCServer{Impl: producer})
+
+	assert.NoError(t, client.Configure(map[string]string{"emitter.name": "test"}, []byte(`{"url": "localhost"}`)))
+	assert.Equal(t, "test", producer.configured["emitter.name"])
+	assert.JSONEq(t, `{"url": "localhost"}`, string(producer.config))
+
+	assert.NoError(t, client.HealthCheck())
+	producer.unhealthy = errors.New("connection lost")
+	assert.ErrorContains(t, client.HealthCheck(), "connection lost")
+
+	assert.NoError(t, client.Flush(map[string]string{"emitter.name": "test", "emitter.group": "group"}))
+	assert.Equal(t, map[string]string{"emitter.name": "test", "emitter.group": "group"}, producer.flushed)
+	assert.NoError(t, client.Close())
+	assert.True(t, producer.closed)
+}
+
+func TestLifecycleFallback(t *testing.T) {
+	client := newClient(t, &legacyServer{server: &jrpc.GRPCServer{Impl: &countingProducer{}}})
+
+	assert.NoError(t, client.Configure(nil, nil))
+	assert.NoError(t, client.HealthCheck())
+	assert.NoError(t, client.Flush(nil))
+	assert.NoError(t, client.Close())
+}
@@ -0,0 +1,180 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Retuning is the body of the requests changing Num and Frequency of the emitters.
+// Missing values are left unchanged.
+type Retuning struct {
+	Num       int    `json:"num,omitempty"`
+	Frequency string `json:"frequency,omitempty"`
+}
+
+// Handler returns the REST API of the Controller:
+//
+//	GET   /emitters                              status of all the groups of emitters
+//	GET   /emitters/{group}                      status of the emitters of a group
+//	GET   /emitters/{group}/{emitter}            status of an emitter
+//	POST  /emitters/{group}/start                starts all the emitters of a group
+//	POST  /emitters/{group}/stop                 stops all the emitters of a group
+//	POST  /emitters/{group}/{emitter}/start      starts an emitter
+//	POST  /emitters/{group}/{emitter}/stop       stops an emitter
+//	PATCH /emitters/{group}                      changes num and frequency of the emitters of a group
+//	PATCH /emitters/{group}/{emitter}            changes num and frequency of an emitter
+//	GET   /health                                health of the outputs, 503 if any is unhealthy
+//	GET   /metrics                               metrics in OpenMetrics format
+func (c *Controller) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /emitters", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Groups())
+	})
+	mux.HandleFunc("GET /emitters/{group}", func(w http.ResponseWriter, r *http.Request) {
+		c.writeGroup(w, r.PathValue("group"), nil)
+	})
+	mux.HandleFunc("GET /emitters/{group}/{emitter}", func(w http.ResponseWriter, r *http.Request) {
+		c.writeEmitter(w, r.PathValue("group"), r.PathValue("emitter"), nil)
+	})
+	mux.HandleFunc("POST /emitters/{group}/start", func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("group")
+		c.writeGroup(w, group, c.Start(group, ""))
+	})
+	mux.HandleFunc("POST /emitters/{group}/stop", func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("group")
+		c.writeGroup(w, group, c.Stop(group, ""))
+	})
+	mux.HandleFunc("POST /emitters/{group}/{emitter}/start", func(w http.ResponseWriter, r *http.Request) {
+		group, name := r.PathValue("group"), r.PathValue("emitter")
+		c.writeEmitter(w, group, name, c.Start(group, name))
+	})
+	mux.HandleFunc("POST /emitters/{group}/{emitter}/stop", func(w http.ResponseWriter, r *http.Request) {
+		group, name := r.PathValue("group"), r.PathValue("emitter")
+		c.writeEmitter(w, group, name, c.Stop(group, name))
+	})
+	mux.HandleFunc("PATCH /emitters/{group}", func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("group")
+		c.writeGroup(w, group, c.retune(r, group, ""))
+	})
+	mux.HandleFunc("PATCH /emitters/{group}/{emitter}", func(w http.ResponseWriter, r *http.Request) {
+		group, name := r.PathValue("group"), r.PathValue("emitter")
+		c.writeEmitter(w, group, name, c.retune(r, group, name))
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		unhealthy := make(map[string]string)
+		for name, err := range c.HealthCheck(r.Context()) {
+			unhealthy[name] = err.Error()
+		}
+		if len(unhealthy) > 0 {
+			writeJSON(w, http.StatusServiceUnavailable, unhealthy)
+			return
+		}
+		writeJSON(w, http.StatusOK, unhealthy)
+	})
+	mux.Handle("GET /metrics", c.metrics.handler())
+	return mux
+}
+
+// errBadRequest marks the errors caused by invalid requests
+var errBadRequest = errors.New("bad request")
+
+func (c *Controller) retune(r *http.Request, group string, name string) error {
+	var retuning Retuning
+	if err := json.NewDecoder(r.Body).Decode(&retuning); err != nil {
+		return fmt.Errorf("%w: %w", errBadRequest, err)
+	}
+	if retuning.Num < 0 {
+		return fmt.Errorf("%w: num must be positive", errBadRequest)
+	}
+	var frequency time.Duration
+	if retuning.Frequency != "" {
+		var err error
+		if frequency, err = time.ParseDuration(retuning.Frequency); err != nil {
+			return fmt.Errorf("%w: %w", errBadRequest, err)
+		}
+		if frequency <= 0 {
+			return fmt.Errorf("%w: frequency must be positive", errBadRequest)
+		}
+	}
+	if err := c.Retune(group, name, retuning.Num, frequency); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", errBadRequest, err)
+	}
+	return nil
+}
+
+// writeGroup writes err if not nil, or the status of group
+func (c *Controller) writeGroup(w http.ResponseWriter, group string, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	g, err := c.Group(group)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+// writeEmitter writes err if not nil, or the status of the named emitter of group
+func (c *Controller) writeEmitter(w http.ResponseWriter, group string, name string, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s, err := c.Emitter(group, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrRunning):
+		code = http.StatusConflict
+	case errors.Is(err, errBadRequest):
+		code = http.StatusBadRequest
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn().Err(err).Msg("error in writing response")
+	}
+}
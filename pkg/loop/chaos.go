@@ -0,0 +1,214 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/rs/zerolog/log"
+)
+
+// Anomalies marked by the chaos of an emitter
+const (
+	DroppedFieldAnomaly   = "dropped-field"
+	RenamedFieldAnomaly   = "renamed-field"
+	ChangedTypeAnomaly    = "changed-type"
+	NullFieldAnomaly      = "null-field"
+	OversizedFieldAnomaly = "oversized-field"
+	TruncatedAnomaly      = "truncated"
+	GarbledAnomaly        = "garbled"
+	BrokenEncodingAnomaly = "broken-encoding"
+	SchemaDriftAnomaly    = "schema-drift"
+)
+
+// garbage are the characters replacing the ones of the garbled values
+const garbage = `{}[]:,"\`
+
+// chaos corrupts the objects of an emitter as configured in its Chaos, and drifts its schema
+type chaos struct {
+	random    random.Source
+	lock      sync.Mutex
+	start     time.Time
+	generated atomic.Int64
+	drifted   atomic.Bool
+}
+
+// newChaos returns the chaos of e starting at start, or nil if it has none
+func newChaos(e *emitter.Emitter, start time.Time) *chaos {
+	if e.Config.Chaos == nil {
+		return nil
+	}
+	c := &chaos{random: random.Random, start: start}
+	if stream := random.NewStream(e.Config.ID() + "/chaos"); stream != nil {
+		c.random = stream
+	}
+	return c
+}
+
+// drift returns true if the next object must be rendered with the templates of the drift d at now
+func (c *chaos) drift(name string, d *emitter.Drift, now time.Time) bool {
+	if c == nil || d == nil {
+		return false
+	}
+	n := c.generated.Add(1)
+	if c.drifted.Load() {
+		return true
+	}
+	if (d.AfterObjects > 0 && n > d.AfterObjects) || (d.After > 0 && !now.Before(c.start.Add(d.After))) {
+		if c.drifted.CompareAndSwap(false, true) {
+			log.Info().Str("emitter", name).Int64("objects", n-1).Msg("schema drift")
+		}
+		return true
+	}
+	return false
+}
+
+// fieldCorruption changes the field of a decoded JSON object
+type fieldCorruption struct {
+	probability float64
+	anomaly     string
+	change      func(fields map[string]any, field string)
+}
+
+// corrupt applies the corruptions of cfg to obj, marking them in its headers
+func (c *chaos) corrupt(cfg *emitter.Chaos, obj object) object {
+	if c == nil || cfg == nil {
+		return obj
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	oversized := cfg.OversizedLength
+	if oversized == 0 {
+		oversized = emitter.DefaultOversizedLength
+	}
+	corruptions := []fieldCorruption{
+		{cfg.DropField, DroppedFieldAnomaly, func(fields map[string]any, field string) {
+			delete(fields, field)
+		}},
+		{cfg.RenameField, RenamedFieldAnomaly, func(fields map[string]any, field string) {
+			v := fields[field]
+			delete(fields, field)
+			fields[nearString(field)] = v
+		}},
+		{cfg.ChangeType, ChangedTypeAnomaly, func(fields map[string]any, field string) {
+			fields[field] = changeType(fields[field])
+		}},
+		{cfg.Null, NullFieldAnomaly, func(fields map[string]any, field string) {
+			fields[field] = nil
+		}},
+		{cfg.Oversized, OversizedFieldAnomaly, func(fields map[string]any, field string) {
+			fields[field] = strings.Repeat("x", oversized)
+		}},
+	}
+
+	var anomalies []string
+	value := obj.value
+	var decoded map[string]any
+	for _, corruption := range corruptions {
+		if c.random.Float64() >= corruption.probability {
+			continue
+		}
+		if decoded == nil && !decodeObject(value, &decoded) {
+			continue
+		}
+		if len(decoded) == 0 {
+			continue
+		}
+		fields := slices.Sorted(maps.Keys(decoded))
+		corruption.change(decoded, fields[c.random.IntN(len(fields))])
+		anomalies = append(anomalies, corruption.anomaly)
+	}
+	if len(anomalies) > 0 {
+		var b bytes.Buffer
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(decoded); err == nil {
+			value = bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+		}
+	} else {
+		value = bytes.Clone(value)
+	}
+
+	if c.random.Float64() < cfg.Truncate && len(value) > 1 {
+		value = value[:1+c.random.IntN(len(value)-1)]
+		anomalies = append(anomalies, TruncatedAnomaly)
+	}
+	if c.random.Float64() < cfg.Garble && len(value) > 0 {
+		for n := 1 + c.random.IntN(3); n > 0; n-- {
+			value[c.random.IntN(len(value))] = garbage[c.random.IntN(len(garbage))]
+		}
+		anomalies = append(anomalies, GarbledAnomaly)
+	}
+	if c.random.Float64() < cfg.BreakEncoding {
+		// a UTF-8 leading byte followed by an ASCII character is not valid
+		i := c.random.IntN(len(value) + 1)
+		value = slices.Insert(value, i, 0xc3, 0x28)
+		anomalies = append(anomalies, BrokenEncodingAnomaly)
+	}
+
+	if len(anomalies) == 0 {
+		return obj
+	}
+	obj = withAnomaly(obj, strings.Join(anomalies, ","))
+	obj.value = value
+	return obj
+}
+
+// decodeObject decodes value in fields, returning false if it is not a JSON object
+func decodeObject(value []byte, fields *map[string]any) bool {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	return decoder.Decode(fields) == nil && *fields != nil
+}
+
+// changeType returns v as a value of another JSON type
+func changeType(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String()
+	case string:
+		if _, err := strconv.ParseFloat(v, 64); err == nil && json.Valid([]byte(v)) {
+			return json.Number(v)
+		}
+		return []any{v}
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return 0
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(b)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+const chaosTemplate = `{"id": {{counter "emitter:id" 1 1}}, "name": "abc", "price": 1.5, "ok": true}`
+
+func decodeFields(t *testing.T, value string) map[string]any {
+	t.Helper()
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		t.Fatal(err, value)
+	}
+	return fields
+}
+
+func TestChaos(t *testing.T) {
+	tests := []struct {
+		name    string
+		chaos   emitter.Chaos
+		anomaly string
+		check   func(t *testing.T, value string, original string)
+	}{
+		{"drop", emitter.Chaos{DropField: 1}, loop.DroppedFieldAnomaly, func(t *testing.T, value string, original string) {
+			assert.Len(t, decodeFields(t, value), 3)
+		}},
+		{"rename", emitter.Chaos{RenameField: 1}, loop.RenamedFieldAnomaly, func(t *testing.T, value string, original string) {
+			fields := decodeFields(t, value)
+			assert.Len(t, fields, 4)
+			renamed := 0
+			for _, f := range []string{"Id", "Name", "Price", "Ok"} {
+				if _, ok := fields[f]; ok {
+					renamed++
+				}
+			}
+			assert.Equal(t, 1, renamed, value)
+		}},
+		{"type", emitter.Chaos{ChangeType: 1}, loop.ChangedTypeAnomaly, func(t *testing.T, value string, original string) {
+			fields := decodeFields(t, value)
+			_, idOk := fields["id"].(float64)
+			_, nameOk := fields["name"].(string)
+			_, priceOk := fields["price"].(float64)
+			_, okOk := fields["ok"].(bool)
+			changed := 0
+			for _, ok := range []bool{idOk, nameOk, priceOk, okOk} {
+				if !ok {
+					changed++
+				}
+			}
+			assert.Equal(t, 1, changed, value)
+		}},
+		{"null", emitter.Chaos{Null: 1}, loop.NullFieldAnomaly, func(t *testing.T, value string, original string) {
+			assert.Contains(t, value, ":null")
+			assert.Len(t, decodeFields(t, value), 4)
+		}},
+		{"oversized", emitter.Chaos{Oversized: 1, OversizedLength: 100}, loop.OversizedFieldAnomaly, func(t *testing.T, value string, original string) {
+			assert.Contains(t, value, `"`+strings.Repeat("x", 100)+`"`)
+		}},
+		{"truncate", emitter.Chaos{Truncate: 1}, loop.TruncatedAnomaly, func(t *testing.T, value string, original string) {
+			assert.True(t, strings.HasPrefix(original, value), value)
+			assert.Less(t, len(value), len(original))
+		}},
+		{"garble", emitter.Chaos{Garble: 1}, loop.GarbledAnomaly, func(t *testing.T, value string, original string) {
+			assert.Len(t, value, len(original))
+			changed := 0
+			for i := range value {
+				if value[i] != original[i] {
+					assert.Contains(t, `{}[]:,"\`, string(value[i]))
+					changed++
+				}
+			}
+			assert.LessOrEqual(t, changed, 3)
+		}},
+		{"encoding", emitter.Chaos{BreakEncoding: 1}, loop.BrokenEncodingAnomaly, func(t *testing.T, value string, original string) {
+			assert.False(t, utf8.ValidString(value))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer.reset()
+			cfg := newConfig("chaos_"+tt.name, chaosTemplate, emitter.Ticker{Num: 20})
+			cfg.Chaos = &tt.chaos
+			runLoop(t, cfg)
+			records := producer.produced()
+			assert.Len(t, records, 20)
+			for i, rec := range records {
+				assert.Equal(t, tt.anomaly, rec.headers[loop.AnomalyHeader])
+				tt.check(t, rec.value, fmt.Sprintf(`{"id": %d, "name": "abc", "price": 1.5, "ok": true}`, i+1))
+			}
+		})
+	}
+}
+
+func TestChaosProbabilities(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("chaos_mixed", chaosTemplate, emitter.Ticker{Num: 1000})
+	cfg.Chaos = &emitter.Chaos{DropField: 0.1, Null: 0.2, Truncate: 0.05}
+	runLoop(t, cfg)
+
+	anomalies := make(map[string]int)
+	for _, rec := range producer.produced() {
+		marked := rec.headers[loop.AnomalyHeader]
+		if marked == "" {
+			assert.True(t, json.Valid([]byte(rec.value)), rec.value)
+			continue
+		}
+		for _, anomaly := range strings.Split(marked, ",") {
+			anomalies[anomaly]++
+		}
+	}
+	assert.InDelta(t, 100, anomalies[loop.DroppedFieldAnomaly], 35)
+	assert.InDelta(t, 200, anomalies[loop.NullFieldAnomaly], 45)
+	assert.InDelta(t, 50, anomalies[loop.TruncatedAnomaly], 25)
+	assert.Len(t, anomalies, 3)
+}
+
+func TestSchemaDrift(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("drift", `{"id": {{counter "emitter:id" 1 1}}}`, emitter.Ticker{Num: 10})
+	cfg.Chaos = &emitter.Chaos{Drift: &emitter.Drift{
+		AfterObjects:  4,
+		ValueTemplate: `{"id": {{counter "emitter:id" 1 1}}, "version": 2}`,
+	}}
+	runLoop(t, cfg)
+
+	records := producer.produced()
+	assert.Len(t, records, 10)
+	for i, rec := range records {
+		fields := decodeFields(t, rec.value)
+		assert.Equal(t, float64(i+1), fields["id"])
+		if i < 4 {
+			assert.NotContains(t, fields, "version")
+			assert.Empty(t, rec.headers[loop.AnomalyHeader])
+		} else {
+			assert.Equal(t, float64(2), fields["version"])
+			assert.Equal(t, loop.SchemaDriftAnomaly, rec.headers[loop.AnomalyHeader])
+		}
+	}
+}
+
+func TestSteppedSchemaDrift(t *testing.T) {
+	producer.reset()
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, start.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig("stepped_drift", `{"v": 1, "time": "`+clockTemplate+`"}`, emitter.Ticker{Num: 1, Frequency: 10 * time.Minute})
+	cfg.Chaos = &emitter.Chaos{Drift: &emitter.Drift{
+		After:         30 * time.Minute,
+		ValueTemplate: `{"v": 2, "time": "` + clockTemplate + `"}`,
+	}}
+	runClock(t, clock, cfg)
+
+	versions := make(map[string]float64)
+	for _, rec := range producer.produced() {
+		fields := decodeFields(t, rec.value)
+		versions[fields["time"].(string)] = fields["v"].(float64)
+	}
+	assert.Equal(t, map[string]float64{
+		"2026-09-01T00:10:00Z": 1,
+		"2026-09-01T00:20:00Z": 1,
+		"2026-09-01T00:30:00Z": 2,
+		"2026-09-01T00:40:00Z": 2,
+		"2026-09-01T00:50:00Z": 2,
+	}, versions)
+}
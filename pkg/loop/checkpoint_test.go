@@ -0,0 +1,78 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+func TestResume(t *testing.T) {
+	defer random.SetRandom(0)
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	run := func(num int, options ...loop.Option) []string {
+		producer.reset()
+		cfg := newConfig("resume", `{{counter "id" 1 1}} {{integer 0 1000000}}`, emitter.Ticker{Num: num})
+		cfg.Preload = 2
+		emitters := orderedmap.New[string, []emitter.Config](1)
+		emitters.Set("resume", []emitter.Config{cfg})
+		if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, options...); err != nil {
+			t.Fatal(err)
+		}
+		var values []string
+		for _, rec := range producer.produced() {
+			values = append(values, rec.value)
+		}
+		return values
+	}
+
+	random.SetRandom(42)
+	first := run(3, loop.WithCheckpoint(path, 0))
+	assert.Len(t, first, 5)
+
+	// the resumed run skips the preload and continues the counters and the random values
+	random.SetRandom(1)
+	second := run(3, loop.WithResume(path))
+	assert.Len(t, second, 3)
+	resumed := append(first, second...)
+	for i, v := range resumed {
+		assert.Equal(t, strconv.Itoa(i+1), strings.Fields(v)[0])
+	}
+
+	// the random values are the ones of a run which was not interrupted, whose counters continue
+	// as the state of the emitter is the same
+	random.SetRandom(42)
+	full := run(6)
+	assert.Len(t, full, 8)
+	for i, v := range full {
+		assert.Equal(t, strings.Fields(resumed[i])[1], strings.Fields(v)[1])
+	}
+}
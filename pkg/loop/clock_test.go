@@ -0,0 +1,97 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+const clockTemplate = `{{now "2006-01-02T15:04:05Z07:00"}}`
+
+func runClock(t *testing.T, clock *state.Clock, configs ...emitter.Config) {
+	t.Helper()
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("clock", configs)
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, loop.WithClock(clock)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSteppedClock(t *testing.T) {
+	producer.reset()
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, start.Add(24*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minutes := newConfig("minutes", clockTemplate, emitter.Ticker{Num: 1, Frequency: time.Minute, ImmediateStart: true})
+	hours := newConfig("hours", clockTemplate, emitter.Ticker{Num: 2, Frequency: time.Hour})
+	hours.Workers = 2
+
+	begin := time.Now()
+	runClock(t, clock, minutes, hours)
+	assert.Less(t, time.Since(begin), 10*time.Second)
+
+	assert.Equal(t, 24*60, producer.count("minutes"))
+	assert.Equal(t, 2*23, producer.count("hours"))
+
+	// the emitters never go past each other
+	var last time.Time
+	for _, rec := range producer.produced() {
+		now, err := time.Parse(time.RFC3339, rec.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, now.Before(last), "%s before %s", now, last)
+		assert.True(t, now.Before(start.Add(24*time.Hour)))
+		last = now
+	}
+	assert.Equal(t, start.Add(24*time.Hour-time.Minute), last)
+	assert.WithinDuration(t, time.Now(), state.GetSharedState().Execution.Now(), time.Minute)
+}
+
+func TestSpeedClock(t *testing.T) {
+	producer.reset()
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, start.Add(time.Hour), 7200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runClock(t, clock, newConfig("speed", clockTemplate, emitter.Ticker{Num: 1, Frequency: 10 * time.Minute}))
+
+	values := producer.produced()
+	assert.InDelta(t, 5, len(values), 1)
+	for _, rec := range values {
+		now, err := time.Parse(time.RFC3339, rec.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, now.After(start) && now.Before(start.Add(time.Hour)), now)
+	}
+}
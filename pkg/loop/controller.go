@@ -0,0 +1,430 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/rs/zerolog/log"
+)
+
+// Status of an emitter managed by a Controller
+type Status string
+
+const (
+	// Idle emitters have never been started
+	Idle Status = "idle"
+	// Running emitters are generating objects
+	Running Status = "running"
+	// Stopped emitters have been stopped before their end
+	Stopped Status = "stopped"
+	// Completed emitters have generated all their objects or reached their duration
+	Completed Status = "completed"
+	// Failed emitters could not be started
+	Failed Status = "failed"
+)
+
+var (
+	// ErrNotFound is returned for unknown groups and emitters
+	ErrNotFound = errors.New("not found")
+	// ErrRunning is returned starting an emitter which is already running
+	ErrRunning = errors.New("already running")
+)
+
+// EmitterStatus describes an emitter managed by a Controller
+type EmitterStatus struct {
+	Group      string    `json:"group"`
+	Name       string    `json:"name"`
+	Status     Status    `json:"status"`
+	Type       string    `json:"type"`
+	Num        int       `json:"num"`
+	Frequency  string    `json:"frequency"`
+	TargetRate float64   `json:"targetRate"`
+	Objects    uint64    `json:"objects"`
+	Bytes      uint64    `json:"bytes"`
+	Errors     uint64    `json:"errors"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// GroupStatus describes a group of emitters managed by a Controller
+type GroupStatus struct {
+	Name     string          `json:"name"`
+	Emitters []EmitterStatus `json:"emitters"`
+}
+
+// Controller starts, stops and retunes the configured emitters on demand, i.e. from the API of jr serve.
+// Every start creates the emitter again from its configuration, including the changes made with Retune.
+// Dependencies among emitters are not started automatically.
+type Controller struct {
+	ctx          context.Context
+	configParams map[string]string
+	outputs      *plugins
+	global       *rateLimit
+	stats        *stats
+	metrics      *metrics
+
+	lock   sync.Mutex
+	groups map[string][]*managed
+	wg     sync.WaitGroup
+}
+
+// managed is an emitter managed by a Controller
+type managed struct {
+	group     string
+	config    emitter.Config
+	emitter   *emitter.Emitter
+	status    Status
+	err       error
+	startedAt time.Time
+	counters  *counters
+	metrics   *emitterMetrics
+}
+
+// NewController returns a Controller of emitters, a map of groups of emitter configurations.
+// The emitters run until they complete, they are stopped or ctx is done.
+// The WithThroughput, WithRecordRate and WithBatching options are applied.
+func NewController(ctx context.Context,
+	emitters map[string][]emitter.Config,
+	configParams map[string]string,
+	pluginName string,
+	pluginLogLevel hclog.Level,
+	opts ...Option) *Controller {
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := &Controller{
+		ctx:          ctx,
+		configParams: configParams,
+		outputs:      newPlugins(pluginName, pluginLogLevel, plugin.WithBatching(o.batching)),
+		global:       newRateLimit(float64(o.throughput), o.recordRate),
+		stats:        newStats(0),
+		metrics:      newMetrics(),
+		groups:       make(map[string][]*managed),
+	}
+	for group, configs := range emitters {
+		for _, cfg := range configs {
+			cfg.Group = group
+			m := &managed{
+				group:    group,
+				config:   cfg,
+				status:   Idle,
+				counters: c.stats.newCounters(group, cfg.Name),
+			}
+			pluginName := cfg.Output
+			if c.outputs.name != "" {
+				pluginName = c.outputs.name
+			}
+			m.metrics = c.metrics.register(group, cfg.Name, pluginName, func() *emitter.Emitter {
+				c.lock.Lock()
+				defer c.lock.Unlock()
+				return m.emitter
+			})
+			c.groups[group] = append(c.groups[group], m)
+		}
+	}
+	return c
+}
+
+// Groups returns the status of all the groups of emitters, sorted by name
+func (c *Controller) Groups() []GroupStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	names := make([]string, 0, len(c.groups))
+	for name := range c.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]GroupStatus, 0, len(names))
+	for _, name := range names {
+		groups = append(groups, c.groupStatus(name))
+	}
+	return groups
+}
+
+// Group returns the status of the emitters of group
+func (c *Controller) Group(group string) (GroupStatus, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.groups[group]; !ok {
+		return GroupStatus{}, fmt.Errorf("group %s: %w", group, ErrNotFound)
+	}
+	return c.groupStatus(group), nil
+}
+
+// Emitter returns the status of the named emitter of group
+func (c *Controller) Emitter(group string, name string) (EmitterStatus, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ms, err := c.find(group, name)
+	if err != nil {
+		return EmitterStatus{}, err
+	}
+	return ms[0].describe(), nil
+}
+
+// Start starts the named emitter of group, or all the emitters of group if name is empty
+func (c *Controller) Start(group string, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ms, err := c.find(group, name)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range ms {
+		if m.status == Running {
+			if name != "" {
+				errs = append(errs, fmt.Errorf("emitter %s: %w", m.config.Name, ErrRunning))
+			}
+			continue
+		}
+		if err := c.start(m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stop stops the named emitter of group, or all the emitters of group if name is empty
+func (c *Controller) Stop(group string, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ms, err := c.find(group, name)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if m.status == Running {
+			m.status = Stopped
+			m.emitter.Stop()
+		}
+	}
+	return nil
+}
+
+// Retune changes Num and Frequency of the named emitter of group, or of all the emitters of group if name is empty.
+// Running emitters are changed on the fly. Non positive values leave the current ones unchanged.
+func (c *Controller) Retune(group string, name string, num int, frequency time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ms, err := c.find(group, name)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		if frequency > 0 && !m.config.Tick.IsSimple() {
+			return fmt.Errorf("emitter %s: frequency can't be changed with the %s ticker type", m.config.Name, m.config.Tick.Type)
+		}
+	}
+	for _, m := range ms {
+		if m.emitter != nil {
+			if err := m.emitter.Retune(num, frequency); err != nil {
+				return err
+			}
+		}
+		if num > 0 {
+			m.config.Tick.Num = num
+		}
+		if frequency > 0 {
+			m.config.Tick.Frequency = frequency
+		}
+	}
+	return nil
+}
+
+// Wait waits for the end of all the running emitters
+func (c *Controller) Wait() {
+	c.wg.Wait()
+}
+
+// HealthCheck checks the outputs of the emitters started so far, returning the error of every
+// unhealthy output by plugin name
+func (c *Controller) HealthCheck(ctx context.Context) map[string]error {
+	return c.outputs.healthCheck(ctx)
+}
+
+// Close stops all the emitters, waits for them and closes their plugins
+func (c *Controller) Close() {
+	c.lock.Lock()
+	c.stopAll()
+	c.lock.Unlock()
+	c.wg.Wait()
+	c.outputs.close()
+}
+
+// start creates the emitter of m and runs it. It must be called holding the lock.
+func (c *Controller) start(m *managed) error {
+	em, err := emitter.NewFromConfig(m.config)
+	if err == nil {
+		em.SetScope(state.GetSharedState().EmitterScope(m.group, m.config.Name))
+		err = c.outputs.set(em)
+	}
+	if err != nil {
+		m.status = Failed
+		m.err = err
+		return fmt.Errorf("emitter %s: %w", m.config.Name, err)
+	}
+
+	deadLetter, err := c.outputs.deadLetter(em)
+	if err != nil {
+		m.status = Failed
+		m.err = err
+		return fmt.Errorf("emitter %s: %w", m.config.Name, err)
+	}
+	stateOutputs, err := c.outputs.stateOutputs(em)
+	if err != nil {
+		m.status = Failed
+		m.err = err
+		return fmt.Errorf("emitter %s: %w", m.config.Name, err)
+	}
+
+	m.emitter = em
+	m.status = Running
+	m.err = nil
+	m.startedAt = time.Now()
+
+	r := &runner{
+		emitter:      em,
+		configParams: c.configParams,
+		limits:       rateLimits{newRateLimit(float64(m.config.Tick.Throughput), m.config.Tick.RecordRate), c.global},
+		counters:     m.counters,
+		metrics:      m.metrics,
+		deadLetter:   deadLetter,
+		abort:        c.abort,
+		stateOutputs: stateOutputs,
+		outputs:      c.outputs,
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		log.Debug().Str("group", m.group).Str("emitter", m.config.Name).Msg("starting emitter")
+		err := r.run(c.ctx, func() {})
+
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if m.emitter != em {
+			return
+		}
+		if err != nil {
+			m.status = Failed
+			m.err = err
+		} else if m.status == Running {
+			m.status = Completed
+		}
+	}()
+	return nil
+}
+
+// abort stops all the running emitters, as requested by the abort error policy
+func (c *Controller) abort(err error) {
+	log.Error().Err(err).Msg("aborting all the emitters")
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stopAll()
+}
+
+// stopAll must be called holding the lock
+func (c *Controller) stopAll() {
+	for _, ms := range c.groups {
+		for _, m := range ms {
+			if m.status == Running {
+				m.status = Stopped
+				m.emitter.Stop()
+			}
+		}
+	}
+}
+
+// find returns the named emitter of group, or all the emitters of group if name is empty.
+// It must be called holding the lock.
+func (c *Controller) find(group string, name string) ([]*managed, error) {
+	ms, ok := c.groups[group]
+	if !ok {
+		return nil, fmt.Errorf("group %s: %w", group, ErrNotFound)
+	}
+	if name == "" {
+		return ms, nil
+	}
+	for _, m := range ms {
+		if m.config.Name == name {
+			return []*managed{m}, nil
+		}
+	}
+	return nil, fmt.Errorf("emitter %s in group %s: %w", name, group, ErrNotFound)
+}
+
+// groupStatus must be called holding the lock
+func (c *Controller) groupStatus(group string) GroupStatus {
+	g := GroupStatus{Name: group}
+	for _, m := range c.groups[group] {
+		g.Emitters = append(g.Emitters, m.describe())
+	}
+	return g
+}
+
+// describe must be called holding the lock of the Controller
+func (m *managed) describe() EmitterStatus {
+	tick := m.config.Tick
+	targetRate := 0.0
+	if m.emitter != nil {
+		tick = m.emitter.Tick()
+		if m.status == Running {
+			targetRate = m.emitter.TargetRate()
+		}
+	}
+	s := EmitterStatus{
+		Group:      m.group,
+		Name:       m.config.Name,
+		Status:     m.status,
+		Type:       tick.Type,
+		Num:        tick.Num,
+		Frequency:  tick.Frequency.String(),
+		TargetRate: targetRate,
+		Objects:    m.counters.objects.Load(),
+		Bytes:      m.counters.bytes.Load(),
+		Errors:     m.counters.errors.Load(),
+		StartedAt:  m.startedAt,
+	}
+	if s.Type == "" {
+		s.Type = emitter.SimpleProfile
+	}
+	if m.err != nil {
+		s.Error = m.err.Error()
+	}
+	return s
+}
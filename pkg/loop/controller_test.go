@@ -0,0 +1,103 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/stretchr/testify/assert"
+)
+
+func request(t *testing.T, server *httptest.Server, method string, path string, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestController(t *testing.T) {
+	producer.reset()
+	controller := loop.NewController(context.Background(), map[string][]emitter.Config{
+		"api": {
+			newConfig("ticking", "value", emitter.Ticker{Num: 1, Frequency: 10 * time.Millisecond}),
+			newConfig("once", "value", emitter.Ticker{Num: 2}),
+		},
+	}, nil, PluginName, 0)
+	defer controller.Close()
+	server := httptest.NewServer(controller.Handler())
+	defer server.Close()
+
+	var groups []loop.GroupStatus
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/emitters", "", &groups))
+	assert.Len(t, groups, 1)
+	assert.Equal(t, loop.Idle, groups[0].Emitters[0].Status)
+
+	var status loop.EmitterStatus
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodPost, "/emitters/api/ticking/start", "", &status))
+	assert.Equal(t, loop.Running, status.Status)
+	assert.Equal(t, http.StatusConflict, request(t, server, http.MethodPost, "/emitters/api/ticking/start", "", nil))
+
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodPatch, "/emitters/api/ticking", `{"num": 3, "frequency": "20ms"}`, &status))
+	assert.Equal(t, 3, status.Num)
+	assert.Equal(t, "20ms", status.Frequency)
+
+	assert.Eventually(t, func() bool {
+		return producer.count("ticking") >= 6
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodPost, "/emitters/api/ticking/stop", "", &status))
+	assert.Equal(t, loop.Stopped, status.Status)
+	assert.Positive(t, status.Objects)
+
+	var group loop.GroupStatus
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodPost, "/emitters/api/start", "", &group))
+	assert.NoError(t, controller.Stop("api", "ticking"))
+	controller.Wait()
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/emitters/api/once", "", &status))
+	assert.Equal(t, loop.Completed, status.Status)
+	assert.Equal(t, uint64(2), status.Objects)
+
+	assert.Equal(t, http.StatusNotFound, request(t, server, http.MethodGet, "/emitters/missing", "", nil))
+	assert.Equal(t, http.StatusNotFound, request(t, server, http.MethodPost, "/emitters/api/missing/start", "", nil))
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPatch, "/emitters/api/ticking", `{"frequency": "fast"}`, nil))
+	assert.Equal(t, http.StatusBadRequest, request(t, server, http.MethodPatch, "/emitters/api/ticking", `{"num": -1}`, nil))
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/metrics", "", nil))
+}
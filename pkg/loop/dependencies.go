@@ -0,0 +1,142 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/rs/zerolog/log"
+)
+
+// startupGraph orders the startup of the emitters: an emitter starts only
+// when all the emitters it depends on have completed their preload phase.
+// Emitters are referenced by name, so depending on a name shared by more
+// emitters means waiting for all of them.
+type startupGraph struct {
+	emitters  []*emitter.Emitter
+	byName    map[string][]int
+	preloaded []chan struct{}
+	once      []sync.Once
+}
+
+func newStartupGraph(es []*emitter.Emitter) (*startupGraph, error) {
+
+	g := &startupGraph{
+		emitters:  es,
+		byName:    make(map[string][]int),
+		preloaded: make([]chan struct{}, len(es)),
+		once:      make([]sync.Once, len(es)),
+	}
+	for i, e := range es {
+		g.byName[e.Config.Name] = append(g.byName[e.Config.Name], i)
+		g.preloaded[i] = make(chan struct{})
+	}
+
+	for _, e := range es {
+		for _, d := range e.Config.DependsOn {
+			if _, ok := g.byName[d]; !ok {
+				return nil, fmt.Errorf("emitter %s depends on %s, which is not part of this run", e.Config.Name, d)
+			}
+		}
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("cyclic dependency between emitters: %s", strings.Join(cycle, " -> "))
+	}
+	return g, nil
+}
+
+// findCycle returns the names of the emitters forming a dependency cycle, if any
+func (g *startupGraph) findCycle() []string {
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	status := make(map[string]int)
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		status[name] = visiting
+		path = append(path, name)
+		for _, i := range g.byName[name] {
+			for _, d := range g.emitters[i].Config.DependsOn {
+				switch status[d] {
+				case visiting:
+					for j, n := range path {
+						if n == d {
+							return append(append([]string{}, path[j:]...), d)
+						}
+					}
+				case unvisited:
+					if cycle := visit(d); cycle != nil {
+						return cycle
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		status[name] = visited
+		return nil
+	}
+
+	for _, e := range g.emitters {
+		if status[e.Config.Name] == unvisited {
+			if cycle := visit(e.Config.Name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// waitDependencies blocks until the dependencies of the i-th emitter have completed
+// their preload phase. It returns false if ctx is done before.
+func (g *startupGraph) waitDependencies(ctx context.Context, i int) bool {
+	e := g.emitters[i]
+	for _, d := range e.Config.DependsOn {
+		log.Debug().
+			Str("emitter", e.Config.Name).
+			Str("dependency", d).
+			Msg("waiting for dependency preload")
+		for _, j := range g.byName[d] {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-g.preloaded[j]:
+			}
+		}
+	}
+	return true
+}
+
+// setPreloaded marks the preload phase of the i-th emitter as completed
+func (g *startupGraph) setPreloaded(i int) {
+	g.once[i].Do(func() {
+		close(g.preloaded[i])
+	})
+}
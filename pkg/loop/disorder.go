@@ -0,0 +1,298 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/random"
+)
+
+const (
+	// AnomalyHeader marks the objects injected or moved by the disorder of an emitter
+	AnomalyHeader = "jr.anomaly"
+
+	ReorderedAnomaly     = "reordered"
+	LateAnomaly          = "late"
+	DuplicateAnomaly     = "duplicate"
+	NearDuplicateAnomaly = "near-duplicate"
+)
+
+// lateObject is an object delayed by the disorder, due at the time of the clock of the run
+type lateObject struct {
+	obj object
+	due time.Time
+	seq uint64
+}
+
+// lateObjects is a heap of the late objects, by due time
+type lateObjects []*lateObject
+
+func (l lateObjects) Len() int { return len(l) }
+func (l lateObjects) Less(i, j int) bool {
+	if l[i].due.Equal(l[j].due) {
+		return l[i].seq < l[j].seq
+	}
+	return l[i].due.Before(l[j].due)
+}
+func (l lateObjects) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l *lateObjects) Push(x any)   { *l = append(*l, x.(*lateObject)) }
+func (l *lateObjects) Pop() any {
+	old := *l
+	n := len(old)
+	x := old[n-1]
+	*l = old[:n-1]
+	return x
+}
+
+// heldObject is an object held back by the disorder until after more objects are produced
+type heldObject struct {
+	obj   object
+	after int
+}
+
+// disorder injects the anomalies of the Disorder of an emitter in its objects
+type disorder struct {
+	config *emitter.Disorder
+	random random.Source
+	lock   sync.Mutex
+	late   lateObjects
+	held   []*heldObject
+	seq    uint64
+}
+
+// newDisorder returns the disorder of e, or nil if it has none
+func newDisorder(e *emitter.Emitter) *disorder {
+	if e.Config.Disorder == nil {
+		return nil
+	}
+	d := &disorder{config: e.Config.Disorder, random: random.Random}
+	if stream := random.NewStream(e.Config.ID() + "/disorder"); stream != nil {
+		d.random = stream
+	}
+	return d
+}
+
+// hold holds back obj to reorder it, or delays it from now by a lateness, returning false if obj
+// must be produced now
+func (d *disorder) hold(obj object, now time.Time) bool {
+	if d == nil {
+		return false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	u := d.random.Float64()
+	switch {
+	case u < d.config.Late:
+		d.seq++
+		heap.Push(&d.late, &lateObject{
+			obj: withAnomaly(obj, LateAnomaly),
+			due: now.Add(d.config.Lateness.Next(d.random)),
+			seq: d.seq,
+		})
+		return true
+	case u < d.config.Late+d.config.Reorder:
+		d.held = append(d.held, &heldObject{
+			obj:   withAnomaly(obj, ReorderedAnomaly),
+			after: 1 + d.random.IntN(d.config.Window),
+		})
+		return true
+	}
+	return false
+}
+
+// released returns the objects held back to be produced after one more object
+func (d *disorder) released() []object {
+	if d == nil {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var released []object
+	d.held = slices.DeleteFunc(d.held, func(h *heldObject) bool {
+		h.after--
+		if h.after > 0 {
+			return false
+		}
+		released = append(released, h.obj)
+		return true
+	})
+	return released
+}
+
+// flush returns all the objects held back
+func (d *disorder) flush() []object {
+	if d == nil {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	flushed := make([]object, 0, len(d.held))
+	for _, h := range d.held {
+		flushed = append(flushed, h.obj)
+	}
+	d.held = nil
+	return flushed
+}
+
+// copies returns the exact and near duplicates of obj to produce after it, if any
+func (d *disorder) copies(obj object) []object {
+	if d == nil {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var copies []object
+	if d.random.Float64() < d.config.Duplicate {
+		copies = append(copies, withAnomaly(obj, DuplicateAnomaly))
+	}
+	if d.random.Float64() < d.config.NearDuplicate {
+		if value, ok := nearValue(obj.value, d.config.NearFields, d.random); ok {
+			near := withAnomaly(obj, NearDuplicateAnomaly)
+			near.value = value
+			copies = append(copies, near)
+		} else {
+			copies = append(copies, withAnomaly(obj, DuplicateAnomaly))
+		}
+	}
+	return copies
+}
+
+// next returns when the next late object is due, false if there is none
+func (d *disorder) next() (time.Time, bool) {
+	if d == nil {
+		return time.Time{}, false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.late) == 0 {
+		return time.Time{}, false
+	}
+	return d.late[0].due, true
+}
+
+// popDue removes and returns the next late object if it is due at now
+func (d *disorder) popDue(now time.Time) (object, bool) {
+	if d == nil {
+		return object{}, false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.late) == 0 || d.late[0].due.After(now) {
+		return object{}, false
+	}
+	return heap.Pop(&d.late).(*lateObject).obj, true
+}
+
+// withAnomaly returns obj with its headers copied and marked with anomaly, after the anomalies
+// already marked separated by commas
+func withAnomaly(obj object, anomaly string) object {
+	obj.headers = maps.Clone(obj.headers)
+	if obj.headers == nil {
+		obj.headers = make(map[string]string)
+	}
+	if marked := obj.headers[AnomalyHeader]; marked != "" {
+		anomaly = marked + "," + anomaly
+	}
+	obj.headers[AnomalyHeader] = anomaly
+	return obj
+}
+
+// nearValue returns value with one of the fields changed, or one of its top level string or number
+// fields if there are none, returning false if value is not a JSON object or has no such fields
+func nearValue(value []byte, fields []string, r random.Source) ([]byte, bool) {
+	var decoded map[string]any
+	if !decodeObject(value, &decoded) {
+		return nil, false
+	}
+	if len(fields) == 0 {
+		fields = slices.Sorted(maps.Keys(decoded))
+	}
+	var candidates []string
+	for _, f := range fields {
+		switch decoded[f].(type) {
+		case string, json.Number:
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	field := candidates[r.IntN(len(candidates))]
+	switch v := decoded[field].(type) {
+	case string:
+		decoded[field] = nearString(v)
+	case json.Number:
+		decoded[field] = nearNumber(v, r)
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(decoded); err != nil {
+		return nil, false
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), true
+}
+
+// nearString swaps the case of the first letter of s, or adds a trailing space if it has none
+func nearString(s string) string {
+	runes := []rune(s)
+	for i, c := range runes {
+		switch {
+		case unicode.IsUpper(c):
+			runes[i] = unicode.ToLower(c)
+			return string(runes)
+		case unicode.IsLower(c):
+			runes[i] = unicode.ToUpper(c)
+			return string(runes)
+		}
+	}
+	return s + " "
+}
+
+// nearNumber adds or subtracts 1 to an integer, or up to 1% to a decimal number, 0.01 to 0
+func nearNumber(n json.Number, r random.Source) json.Number {
+	if i, err := n.Int64(); err == nil {
+		if r.IntN(2) == 0 {
+			return json.Number(strconv.FormatInt(i-1, 10))
+		}
+		return json.Number(strconv.FormatInt(i+1, 10))
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	delta := math.Abs(f) / 100
+	if delta == 0 {
+		delta = 0.01
+	}
+	return json.Number(strconv.FormatFloat(f+(r.Float64()*2-1)*delta, 'f', -1, 64))
+}
@@ -0,0 +1,168 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisorder(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("disorder", `{"id": {{counter "emitter:id" 1 1}}, "name": "abc"}`, emitter.Ticker{Num: 500})
+	cfg.Disorder = &emitter.Disorder{
+		Reorder:       0.2,
+		Window:        5,
+		Late:          0.1,
+		Lateness:      emitter.Delay{Mean: 5 * time.Millisecond},
+		Duplicate:     0.1,
+		NearDuplicate: 0.1,
+	}
+	runLoop(t, cfg)
+
+	records := producer.produced()
+	ids := make(map[int]int)
+	anomalies := make(map[string]int)
+	var lastOriginal record
+	for i, rec := range records {
+		var value struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(rec.value), &value); err != nil {
+			t.Fatal(err, rec.value)
+		}
+		anomaly := rec.headers[loop.AnomalyHeader]
+		anomalies[anomaly]++
+		switch anomaly {
+		case "":
+			ids[value.ID]++
+			lastOriginal = rec
+		case loop.ReorderedAnomaly:
+			ids[value.ID]++
+			// a reordered object is produced after at most Window of the next objects
+			after := 0
+			for _, prev := range records[:i] {
+				var v struct {
+					ID int `json:"id"`
+				}
+				_ = json.Unmarshal([]byte(prev.value), &v)
+				if prev.headers[loop.AnomalyHeader] == "" && v.ID > value.ID {
+					after++
+				}
+			}
+			assert.LessOrEqual(t, after, 5, rec.value)
+		case loop.LateAnomaly:
+			ids[value.ID]++
+		case loop.DuplicateAnomaly:
+			// an exact duplicate follows its object
+			assert.Equal(t, records[i-1].value, rec.value)
+			assert.Equal(t, records[i-1].key, rec.key)
+		case loop.NearDuplicateAnomaly:
+			// a near duplicate changes one field of its object
+			if value.ID == 0 {
+				t.Fatal(rec.value)
+			}
+			var original struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal([]byte(lastOriginal.value), &original); err != nil {
+				t.Fatal(err)
+			}
+			changed := 0
+			if original.ID != value.ID {
+				assert.InDelta(t, original.ID, value.ID, 1)
+				changed++
+			}
+			if original.Name != value.Name {
+				assert.Equal(t, "Abc", value.Name)
+				changed++
+			}
+			assert.Equal(t, 1, changed, "%s %s", lastOriginal.value, rec.value)
+		default:
+			t.Fatal("unknown anomaly", anomaly)
+		}
+	}
+	// every object is produced once, and the copies are added
+	assert.Len(t, ids, 500)
+	for id, n := range ids {
+		assert.Equal(t, 1, n, id)
+	}
+	for _, anomaly := range []string{loop.ReorderedAnomaly, loop.LateAnomaly, loop.DuplicateAnomaly, loop.NearDuplicateAnomaly} {
+		assert.Positive(t, anomalies[anomaly], anomaly)
+	}
+	assert.InDelta(t, 0.2*500, anomalies[loop.ReorderedAnomaly], 40)
+	assert.InDelta(t, 0.1*500, anomalies[loop.LateAnomaly], 30)
+}
+
+func TestSteppedLateObjects(t *testing.T) {
+	producer.reset()
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, start.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig("late", clockTemplate, emitter.Ticker{Num: 1, Frequency: time.Minute})
+	cfg.Disorder = &emitter.Disorder{
+		Late:     0.3,
+		Lateness: emitter.Delay{Mean: 90 * time.Second},
+	}
+	runClock(t, clock, cfg)
+
+	records := producer.produced()
+	times := make([]time.Time, len(records))
+	for i, rec := range records {
+		if times[i], err = time.Parse(time.RFC3339, rec.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	late := 0
+	var last time.Time
+	for i, rec := range records {
+		if rec.headers[loop.AnomalyHeader] != loop.LateAnomaly {
+			// the objects on time keep the order of the clock
+			assert.True(t, times[i].After(last), "%s after %s", times[i], last)
+			last = times[i]
+			continue
+		}
+		late++
+		// a late object keeps the time it was generated at, and it is produced 90 seconds later,
+		// after the object generated one minute later and before the one generated two minutes later
+		for _, other := range times[:i] {
+			assert.False(t, other.After(times[i].Add(time.Minute)), "%s produced before %s", other, times[i])
+		}
+		for j := i + 1; j < len(records); j++ {
+			if records[j].headers[loop.AnomalyHeader] == "" {
+				assert.False(t, times[j].Before(times[i].Add(2*time.Minute)), "%s produced after %s", times[j], times[i])
+			}
+		}
+	}
+	assert.Positive(t, late)
+	assert.GreaterOrEqual(t, len(records), 58)
+	assert.LessOrEqual(t, len(records), 59)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+func TestKeyDistribution(t *testing.T) {
+	producer.reset()
+	hot := newConfig("hot", `{"key": "{{.Key}}"}`, emitter.Ticker{Num: 2000})
+	hot.Keys = &emitter.KeyDistribution{Distribution: emitter.HotSetKeys, Keys: 20, Prefix: "user-", HotKeys: 1, HotShare: 0.6}
+	sessions := newConfig("sessions", sessionTemplate, emitter.Ticker{Num: 20})
+	sessions.Keys = &emitter.KeyDistribution{Distribution: emitter.ZipfKeys, Keys: 5, Prefix: "user-", Exponent: 1}
+	sessions.Sessions = &emitter.Sessions{Events: emitter.Count{Mean: 3}}
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("test", []emitter.Config{hot, sessions})
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, loop.WithReport(path), loop.WithKeyReport(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the templates read the key drawn for the object, and the events of a session keep the key of the first one
+	sessionKeys := make(map[string]string)
+	for _, rec := range producer.produced() {
+		assert.True(t, strings.HasPrefix(rec.key, "user-"), rec.key)
+		var v struct {
+			Key     string `json:"key"`
+			Session string `json:"session"`
+		}
+		if err := json.Unmarshal([]byte(rec.value), &v); err != nil {
+			t.Fatal(err, rec.value)
+		}
+		if v.Session == "" {
+			assert.Equal(t, rec.key, v.Key)
+			continue
+		}
+		if k, ok := sessionKeys[v.Session]; ok {
+			assert.Equal(t, k, rec.key, v.Session)
+		}
+		sessionKeys[v.Session] = rec.key
+	}
+	assert.Len(t, sessionKeys, 20)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report loop.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	keys := report.Emitters[0].Keys
+	if keys == nil {
+		t.Fatal("no key report")
+	}
+	assert.LessOrEqual(t, keys.Distinct, 20)
+	assert.Len(t, keys.Top, 3)
+	assert.Equal(t, "user-0", keys.Top[0].Key)
+	assert.InDelta(t, 0.6, keys.Top[0].Share, 0.05)
+	assert.InDelta(t, 0.6*float64(keys.Distinct), keys.MaxToMean, 1.5)
+	var top uint64
+	for i, f := range keys.Top {
+		if i > 0 {
+			assert.LessOrEqual(t, f.Count, keys.Top[i-1].Count)
+		}
+		top += f.Count
+	}
+	assert.InDelta(t, float64(top)/2000, keys.TopShare, 1e-9)
+	assert.Equal(t, uint64(60), report.Emitters[1].Objects)
+	assert.Equal(t, "user-0", report.Emitters[1].Keys.Top[0].Key)
+}
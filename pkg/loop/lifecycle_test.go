@@ -0,0 +1,151 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/config"
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	LifecyclePluginName = "loop_test_lifecycle"
+)
+
+var lifecycle = &lifecycleProducer{}
+
+func init() {
+	plugin.RegisterLocalPlugin(LifecyclePluginName, &plugin.Plugin{
+		Name:     LifecyclePluginName,
+		Producer: lifecycle,
+	})
+}
+
+// lifecycleProducer records the lifecycle calls of the loop
+type lifecycleProducer struct {
+	recordingProducer
+	lock       sync.Mutex
+	configured map[string]string
+	flushed    []string
+	closes     int
+}
+
+func (l *lifecycleProducer) Configure(_ context.Context, configParams map[string]string, config []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.configured[configParams["emitter.name"]] = string(config)
+	return nil
+}
+
+func (l *lifecycleProducer) HealthCheck(_ context.Context) error {
+	return nil
+}
+
+func (l *lifecycleProducer) Flush(_ context.Context, configParams map[string]string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.flushed = append(l.flushed, configParams["emitter.name"])
+	return nil
+}
+
+func (l *lifecycleProducer) Close(_ context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.closes++
+	return nil
+}
+
+func (l *lifecycleProducer) reset() {
+	l.recordingProducer.reset()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.configured = make(map[string]string)
+	l.flushed = nil
+	l.closes = 0
+}
+
+func TestLifecycle(t *testing.T) {
+	lifecycle.reset()
+	userDir := config.JrUserDir
+	defer func() { config.JrUserDir = userDir }()
+	config.JrUserDir = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(config.JrUserDir, "plugins"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	conf := `{"url": "localhost"}`
+	if err := os.WriteFile(filepath.Join(config.JrUserDir, "plugins", "jr-"+LifecyclePluginName+".conf.json"), []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	first := newConfig("first", "value", emitter.Ticker{Num: 2})
+	first.Output = LifecyclePluginName
+	second := newConfig("second", "value", emitter.Ticker{Num: 1})
+	second.Output = LifecyclePluginName
+	assert.NoError(t, runOutputs(first, second))
+
+	assert.Equal(t, map[string]string{"first": conf, "second": conf}, lifecycle.configured)
+	assert.ElementsMatch(t, []string{"first", "second"}, lifecycle.flushed)
+	// the plugin is shared by the emitters and closed once
+	assert.Equal(t, 1, lifecycle.closes)
+	assert.Equal(t, 3, len(lifecycle.produced()))
+}
+
+func TestFlushScenarioStates(t *testing.T) {
+	lifecycle.reset()
+	cfg := newConfig("orders", "value", emitter.Ticker{Num: 1})
+	cfg.Output = LifecyclePluginName
+	cfg.Scenario = &emitter.Scenario{
+		Initial: "created",
+		States: map[string]*emitter.ScenarioState{
+			"created":   {Transitions: []emitter.Transition{{To: "completed", Probability: 1}}},
+			"completed": {ValueTemplate: "completed"},
+		},
+	}
+	assert.NoError(t, runOutputs(cfg))
+
+	// the states without their own output are flushed with their parameters too
+	assert.ElementsMatch(t, []string{"orders", "orders.completed"}, lifecycle.flushed)
+}
+
+func TestHealthCheck(t *testing.T) {
+	controller := loop.NewController(context.Background(), map[string][]emitter.Config{
+		"health": {newConfig("once", "value", emitter.Ticker{Num: 1})},
+	}, nil, PluginName, 0)
+	defer controller.Close()
+	server := httptest.NewServer(controller.Handler())
+	defer server.Close()
+
+	assert.NoError(t, controller.Start("health", ""))
+	controller.Wait()
+	var unhealthy map[string]string
+	assert.Equal(t, http.StatusOK, request(t, server, http.MethodGet, "/health", "", &unhealthy))
+	assert.Empty(t, unhealthy)
+}
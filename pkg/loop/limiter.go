@@ -0,0 +1,156 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket refilled with rate tokens per second, starting from its first use.
+// When the cost of an object is known only after producing it, the bucket
+// can go in debt: waiting callers are released when the debt is repaid,
+// keeping the actual rate at the target one.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+func newLimiter(rate float64) *limiter {
+	return &limiter{
+		rate:  rate,
+		burst: max(rate, 1),
+	}
+}
+
+func (l *limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// take reserves n tokens, then blocks until they are available or ctx is done
+func (l *limiter) take(ctx context.Context, n float64) error {
+	l.lock.Lock()
+	l.refill(time.Now())
+	l.tokens -= n
+	debt := -l.tokens
+	l.lock.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+	return sleep(ctx, time.Duration(debt/l.rate*float64(time.Second)))
+}
+
+// wait blocks until the bucket is out of debt or ctx is done
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		l.lock.Lock()
+		l.refill(time.Now())
+		debt := -l.tokens
+		l.lock.Unlock()
+
+		if debt <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, time.Duration(debt/l.rate*float64(time.Second))); err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// consume takes n tokens from the bucket
+func (l *limiter) consume(n float64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refill(time.Now())
+	l.tokens -= n
+}
+
+// rateLimit limits the produced bytes and/or objects per second. A nil limiter means no limit.
+// Objects are reserved before producing them, bytes are accounted after.
+type rateLimit struct {
+	bytes   *limiter
+	objects *limiter
+}
+
+func newRateLimit(throughput float64, objectRate float64) *rateLimit {
+	if throughput <= 0 && objectRate <= 0 {
+		return nil
+	}
+	r := &rateLimit{}
+	if throughput > 0 {
+		r.bytes = newLimiter(throughput)
+	}
+	if objectRate > 0 {
+		r.objects = newLimiter(objectRate)
+	}
+	return r
+}
+
+// rateLimits are the limits applied to an emitter, usually its own and the global one
+type rateLimits []*rateLimit
+
+// wait blocks until all the limits allow to produce an object
+func (rl rateLimits) wait(ctx context.Context) error {
+	for _, r := range rl {
+		if r == nil {
+			continue
+		}
+		if r.objects != nil {
+			if err := r.objects.take(ctx, 1); err != nil {
+				return err
+			}
+		}
+		if r.bytes != nil {
+			if err := r.bytes.wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// produced accounts for the bytes of a produced object
+func (rl rateLimits) produced(bytes uint64) {
+	for _, r := range rl {
+		if r != nil && r.bytes != nil {
+			r.bytes.consume(float64(bytes))
+		}
+	}
+}
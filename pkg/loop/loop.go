@@ -2,13 +2,17 @@ package loop
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
-	"github.com/jrnd-io/jrv2/pkg/jrpc"
 	"github.com/jrnd-io/jrv2/pkg/state"
 
 	"github.com/jrnd-io/jrv2/pkg/emitter"
@@ -17,182 +21,931 @@ import (
 	orderedmap "github.com/wk8/go-ordered-map/v2"
 )
 
+// Option configures the whole run of the loop
+type Option func(*options)
+
+type options struct {
+	throughput    emitter.Throughput
+	recordRate    float64
+	statsInterval time.Duration
+	summary       bool
+	report        string
+	topKeys       int
+	metrics       string
+	batching      plugin.Batching
+	clock         *state.Clock
+
+	checkpoint         string
+	checkpointInterval time.Duration
+	resume             string
+
+	watch        bool
+	watchConfigs Configs
+	watchPaths   []string
+}
+
+// WithThroughput limits the bytes per second produced by all the emitters together
+func WithThroughput(t emitter.Throughput) Option {
+	return func(o *options) {
+		o.throughput = t
+	}
+}
+
+// WithRecordRate limits the objects per second produced by all the emitters together
+func WithRecordRate(r float64) Option {
+	return func(o *options) {
+		o.recordRate = r
+	}
+}
+
+// WithBatching groups the objects produced to the remote plugins supporting it
+func WithBatching(size int, linger time.Duration) Option {
+	return func(o *options) {
+		o.batching = plugin.Batching{Size: size, Linger: linger}
+	}
+}
+
+// WithStats writes the statistics of the run to stderr at every interval
+func WithStats(interval time.Duration) Option {
+	return func(o *options) {
+		o.statsInterval = interval
+	}
+}
+
+// WithSummary writes a summary table of the run to stderr at the end of the run
+func WithSummary() Option {
+	return func(o *options) {
+		o.summary = true
+	}
+}
+
+// WithReport writes the Report of the run as JSON to the file at path at the end of the run
+func WithReport(path string) Option {
+	return func(o *options) {
+		o.report = path
+	}
+}
+
+// WithKeyReport adds to the summary and to the Report of the run the top most frequent keys of
+// every emitter, to check the skew of their distribution
+func WithKeyReport(top int) Option {
+	return func(o *options) {
+		o.topKeys = top
+	}
+}
+
+// WithMetrics exposes the metrics of the run on /metrics at address, i.e. :7482
+func WithMetrics(address string) Option {
+	return func(o *options) {
+		o.metrics = address
+	}
+}
+
+// WithClock runs the emitters on a simulated clock, seen by the templates and by the tickers
+func WithClock(c *state.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithCheckpoint writes a checkpoint of the state of the templates to the file at path at every
+// interval, if positive, and at the end of the run
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(o *options) {
+		o.checkpoint = path
+		o.checkpointInterval = interval
+	}
+}
+
+// WithResume restores the state of the templates from the checkpoint at path before starting the
+// emitters, which skip their preload as the preloaded lists are restored too
+func WithResume(path string) Option {
+	return func(o *options) {
+		o.resume = path
+	}
+}
+
 func DoLoop(ctx context.Context,
 	emitters *orderedmap.OrderedMap[string, []emitter.Config],
 	configParams map[string]string,
 	pluginName string,
-	pluginLogLevel hclog.Level) error {
+	pluginLogLevel hclog.Level,
+	opts ...Option) error {
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	global := newRateLimit(float64(o.throughput), o.recordRate)
+	runStats := newStats(o.topKeys)
+	if o.clock != nil {
+		execution := state.GetSharedState().Execution
+		execution.SetClock(o.clock)
+		defer execution.SetClock(nil)
+	}
+	if o.resume != "" {
+		c, err := state.ReadCheckpoint(o.resume)
+		if err != nil {
+			return fmt.Errorf("cannot resume: %w", err)
+		}
+		if err := state.GetSharedState().Restore(c); err != nil {
+			return fmt.Errorf("cannot resume from %s: %w", o.resume, err)
+		}
+		log.Info().Str("checkpoint", o.resume).Time("time", c.Time).Msg("resuming run")
+	}
 
 	// emitter slice
 	es := make([]*emitter.Emitter, 0)
+	var w *watcher
+	if o.watch {
+		w = newWatcher(o.watchConfigs, o.watchPaths, os.Stderr)
+	}
 
 	//  ctrl-c signal
-	controlC, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	controlC, stop := signal.NotifyContext(ctx, os.Interrupt)
 	defer stop()
 
 	// wait group to synchronize tickers end
 	var wg sync.WaitGroup
 
-	pluginMap := make(map[string]*plugin.Plugin)
-	defer func() {
-		for _, _p := range pluginMap {
-			err := _p.Close()
-			if err != nil {
-				log.Warn().Err(err).Str("plugin", _p.Name).Msg("error in closing plugin")
-			}
-		}
-	}()
+	outputs := newPlugins(pluginName, pluginLogLevel, plugin.WithBatching(o.batching))
+	defer outputs.close()
 
-	// starting loop
+	// creating emitters and their plugins
 	for e := emitters.Oldest(); e != nil; e = e.Next() {
 		log.Debug().
 			Str("emitter", e.Key).
 			Int("len", len(e.Value)).
-			Msg("Starting loop for emitters")
+			Msg("Creating emitters")
 
 		for i, cfg := range e.Value {
 
 			log.Debug().
 				Int("emitter", i).
 				Interface("config", cfg).
-				Msg("Running emitter")
+				Msg("Creating emitter")
+			cfg.Group = e.Key
 			em, err := emitter.NewFromConfig(cfg)
 			if err != nil {
 				return err
 			}
-
-			es = append(es, em) //nolint
-			// choosing output either from emitter or from passed value
-			output := em.Config.Output
-			if pluginName != "" {
-				output = pluginName
-			}
-
-			// setting plugin or get it from map
-			var _plugin *plugin.Plugin
-			if pluginMap[output] == nil {
-				log.Debug().
-					Str("output", output).
-					Msg("creating emitter output")
-				_plugin, err = plugin.New(output, pluginLogLevel)
-				if err != nil {
-					return err
-				}
-
-				pluginMap[output] = _plugin
-			} else {
-				log.Debug().
-					Str("output", output).
-					Msg("reusing emitter output")
-				_plugin = pluginMap[output]
+			em.SetScope(state.GetSharedState().EmitterScope(e.Key, cfg.Name))
+			if err := outputs.set(em); err != nil {
+				return err
 			}
-			log.Debug().
-				Str("emitter", em.Config.Name).
-				Str("plugin", _plugin.Name).Msg("setting emitter plugin")
-			em.SetPlugin(_plugin)
-
-			wg.Add(1)
-			go func(e *emitter.Emitter) {
-				defer wg.Done()
-
-				frequency := e.Config.Tick.Frequency
-				if frequency > 0 {
-					log.Debug().
-						Dur("frequency", frequency).
-						Str("emitter", e.Config.Name).
-						Msg("Starting ticker")
-					//					ticker := time.NewTicker(frequency)
-					//					defer ticker.Stop()
-					e.StartTicker()
-
-					for {
-						select {
-						case <-controlC.Done():
-							stop()
-							return
-						case <-e.Ticker.C:
-							doTemplate(ctx, e, configParams)
-						case <-e.StopChannel:
-							return
-						}
-
-					}
-				} else {
-					log.Debug().
-						Str("Emitter: %e", e.Config.Name).
-						Msg("Exec do Template")
-					doTemplate(ctx, e, configParams)
-				}
-			}(es[i])
+			if w != nil {
+				w.add(e.Key, em)
+			}
+			es = append(es, em) //nolint
+		}
+	}
+
+	// starting emitters once their dependencies are preloaded
+	graph, err := newStartupGraph(es)
+	if err != nil {
+		return err
+	}
+
+	var runMetrics *metrics
+	if o.metrics != "" {
+		runMetrics = newMetrics()
+		if err := runMetrics.serve(controlC, o.metrics); err != nil {
+			return fmt.Errorf("cannot serve metrics on %s: %w", o.metrics, err)
+		}
+	}
 
+	// the abort error policy cancels the whole run
+	runCtx, abort := context.WithCancelCause(controlC)
+	defer abort(nil)
+
+	if w != nil {
+		if err := w.run(runCtx); err != nil {
+			return fmt.Errorf("cannot watch templates: %w", err)
 		}
 	}
 
+	// errors of the emitters stopped by their error policy
+	var failures []error
+	var failuresLock sync.Mutex
+
+	// on a stepped clock, no emitter goes past the time of the others
+	if o.clock.IsStepped() {
+		for _, em := range es {
+			o.clock.Join(em, o.clock.Start())
+		}
+	}
+
+	for i, em := range es {
+		deadLetter, err := outputs.deadLetter(em)
+		if err != nil {
+			return fmt.Errorf("emitter %s: %w", em.Config.Name, err)
+		}
+		stateOutputs, err := outputs.stateOutputs(em)
+		if err != nil {
+			return fmt.Errorf("emitter %s: %w", em.Config.Name, err)
+		}
+		r := &runner{
+			emitter:      em,
+			configParams: configParams,
+			limits:       rateLimits{newRateLimit(float64(em.Config.Tick.Throughput), em.Config.Tick.RecordRate), global},
+			counters:     runStats.newCounters(em.Config.Group, em.Config.Name),
+			metrics:      runMetrics.register(em.Config.Group, em.Config.Name, em.Plugin().Name, func() *emitter.Emitter { return em }),
+			deadLetter:   deadLetter,
+			abort:        abort,
+			resumed:      o.resume != "",
+			stateOutputs: stateOutputs,
+			outputs:      outputs,
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if o.clock.IsStepped() {
+				defer o.clock.Leave(em)
+			}
+			defer graph.setPreloaded(i)
+			if !graph.waitDependencies(runCtx, i) {
+				return
+			}
+			if err := r.run(runCtx, func() { graph.setPreloaded(i) }); err != nil {
+				failuresLock.Lock()
+				failures = append(failures, err)
+				failuresLock.Unlock()
+			}
+		}(i)
+	}
+
+	statsCtx, stopStats := context.WithCancel(controlC)
+	if o.statsInterval > 0 {
+		go runStats.run(statsCtx, os.Stderr, o.statsInterval)
+	}
+	if o.checkpoint != "" && o.checkpointInterval > 0 {
+		go writeCheckpoints(statsCtx, o.checkpoint, o.checkpointInterval)
+	}
+
 	wg.Wait()
+	stopStats()
+
+	if o.checkpoint != "" {
+		if err := state.GetSharedState().WriteCheckpoint(o.checkpoint); err != nil {
+			failures = append(failures, fmt.Errorf("error in writing checkpoint %s: %w", o.checkpoint, err))
+		}
+	}
+
+	report := runStats.report()
+	if o.summary {
+		if err := writeSummary(os.Stderr, report); err != nil {
+			log.Warn().Err(err).Msg("error in writing summary")
+		}
+	}
+	if o.report != "" {
+		if err := writeReport(o.report, report); err != nil {
+			failures = append(failures, fmt.Errorf("error in writing report %s: %w", o.report, err))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// writeCheckpoints writes a checkpoint of the state to the file at path at every interval until ctx is done
+func writeCheckpoints(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := state.GetSharedState().WriteCheckpoint(path); err != nil {
+				log.Warn().Err(err).Str("checkpoint", path).Msg("error in writing checkpoint")
+			}
+		}
+	}
+}
+
+// plugins creates the plugins of the emitters, reusing them among the emitters with the same output
+type plugins struct {
+	name     string
+	logLevel hclog.Level
+	options  []plugin.Option
+	byOutput map[string]*plugin.Plugin
+	lock     sync.Mutex
+}
+
+// newPlugins returns the plugins for the emitters, all using pluginName if not empty
+func newPlugins(pluginName string, logLevel hclog.Level, options ...plugin.Option) *plugins {
+	return &plugins{
+		name:     pluginName,
+		logLevel: logLevel,
+		options:  options,
+		byOutput: make(map[string]*plugin.Plugin),
+	}
+}
+
+// set sets the plugin of em, creating it if needed
+func (p *plugins) set(em *emitter.Emitter) error {
+	_plugin, err := p.forOutput(em.Config.Output)
+	if err != nil {
+		return err
+	}
+	log.Debug().
+		Str("emitter", em.Config.Name).
+		Str("plugin", _plugin.Name).Msg("setting emitter plugin")
+	em.SetPlugin(_plugin)
 	return nil
 }
 
-func doTemplate(ctx context.Context, em *emitter.Emitter, configParams map[string]string) { //nolint
+// forOutput returns the plugin of output, or of the one passed to the loop if any
+func (p *plugins) forOutput(output string) (*plugin.Plugin, error) {
+	if p.name != "" {
+		output = p.name
+	}
+	return p.get(output)
+}
 
-	var err error
+// get returns the plugin of output, creating it if needed
+func (p *plugins) get(output string) (*plugin.Plugin, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
-	localState := state.NewState()
-	for i := 0; i < em.Config.Tick.Num; i++ {
-		state.GetSharedState().Execution.CurrentIterationLoopIndex++
+	// setting plugin or get it from map
+	_plugin := p.byOutput[output]
+	if _plugin == nil {
+		log.Debug().
+			Str("output", output).
+			Msg("creating emitter output")
+		var err error
+		_plugin, err = plugin.New(output, p.logLevel, p.options...)
+		if err != nil {
+			return nil, err
+		}
+		p.byOutput[output] = _plugin
+	} else {
+		log.Debug().
+			Str("output", output).
+			Msg("reusing emitter output")
+	}
+	return _plugin, nil
+}
+
+// deadLetter returns the dead letter output of em, if its error policy has one
+func (p *plugins) deadLetter(em *emitter.Emitter) (*plugin.Plugin, error) {
+	if em.Config.OnError.Action != emitter.DeadLetterOnError {
+		return nil, nil
+	}
+	return p.get(em.Config.OnError.DeadLetter)
+}
+
+// healthCheck checks the plugins created so far, returning the error of every unhealthy plugin by name
+func (p *plugins) healthCheck(ctx context.Context) map[string]error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	unhealthy := make(map[string]error)
+	for _, _p := range p.byOutput {
+		if err := _p.HealthCheck(ctx); err != nil {
+			unhealthy[_p.Name] = err
+		}
+	}
+	return unhealthy
+}
+
+func (p *plugins) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, _p := range p.byOutput {
+		err := _p.Close()
+		if err != nil {
+			log.Warn().Err(err).Str("plugin", _p.Name).Msg("error in closing plugin")
+		}
+	}
+}
+
+// runner runs an emitter within the loop
+type runner struct {
+	emitter      *emitter.Emitter
+	configParams map[string]string
+	// limits are waited before producing every object after the preload
+	limits   rateLimits
+	counters *counters
+	metrics  *emitterMetrics
+	// deadLetter is the output of the failed objects with the deadletter error policy
+	deadLetter *plugin.Plugin
+	// abort stops all the emitters with the abort error policy
+	abort             func(error)
+	consecutiveErrors atomic.Int64
+	// resumed runs skip the preload
+	resumed bool
+	// stateOutputs are the outputs of the states of the scenario with their own output, got from outputs
+	stateOutputs map[string]*plugin.Plugin
+	outputs      *plugins
+	lifecycle    *lifecycle
+	disorder     *disorder
+	chaos        *chaos
+}
+
+// run executes the preload phase of the emitter and calls preloaded, then generates Tick.Num objects
+// at every tick until the Tick.Duration is elapsed, the emitter is stopped or ctx is done.
+// One shot emitters, with a simple ticker and no frequency, generate the objects just once.
+// The error stopping the emitter, as configured in its error policy, is returned.
+func (r *runner) run(ctx context.Context, preloaded func()) error {
+	e := r.emitter
+
+	// stopping the emitter also interrupts the objects being produced
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-e.StopChannel:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := r.configure(ctx); err != nil {
+		return err
+	}
+	defer r.flush()
+	callers := max(e.Config.Workers, 1)
+	e.Plugin().AddCallers(callers)
+	defer e.Plugin().AddCallers(-callers)
+	clock := state.GetSharedState().Execution.Clock()
+	r.lifecycle = newLifecycle(e)
+	r.disorder = newDisorder(e)
+	r.chaos = newChaos(e, clock.Now())
+
+	if e.Config.Preload > 0 && !r.resumed {
+		log.Debug().
+			Int("preload", e.Config.Preload).
+			Str("emitter", e.Config.Name).
+			Msg("Preloading")
+		if err := r.doTemplate(ctx, e.Config.Preload, nil); err != nil {
+			return err
+		}
+	}
+	preloaded()
+
+	if e.IsOneShot() {
+		log.Debug().
+			Str("emitter", e.Config.Name).
+			Msg("Exec do Template")
+		if err := r.doTemplate(ctx, e.Tick().Num, r.limits); err != nil {
+			return err
+		}
+		return r.drain(ctx, clock, clock.End())
+	}
+
+	if clock.IsStepped() {
+		return r.step(ctx, clock)
+	}
+
+	tick := e.Tick()
+	log.Debug().
+		Str("type", tick.Type).
+		Dur("frequency", tick.Frequency).
+		Float64("throughput", float64(tick.Throughput)).
+		Float64("recordRate", tick.RecordRate).
+		Dur("duration", tick.Duration).
+		Bool("immediate", tick.ImmediateStart).
+		Str("emitter", e.Config.Name).
+		Msg("Starting ticker")
+	e.StartTicker()
+	defer e.StopTicker()
+
+	duration := tick.Duration
+	if end := clock.End(); !end.IsZero() {
+		remaining := end.Sub(clock.Now())
+		if remaining <= 0 {
+			return nil
+		}
+		if duration <= 0 || remaining < duration {
+			duration = remaining
+		}
+	}
+	var elapsed <-chan time.Time
+	if duration > 0 {
+		timer := time.NewTimer(clock.Real(duration))
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+	// the transitions of the entities of the scenario and the late objects are due between the ticks
+	dueTimer := time.NewTimer(time.Hour)
+	defer dueTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-elapsed:
+			log.Debug().
+				Str("emitter", e.Config.Name).
+				Msg("Duration elapsed, stopping ticker")
+			return r.drain(ctx, clock, clock.End())
+		case <-r.due(dueTimer, clock):
+			if err := r.doDue(ctx, clock.Now()); err != nil {
+				return err
+			}
+		case <-e.Ticks():
+			if err := r.swapTemplates(ctx); err != nil {
+				return err
+			}
+			if err := r.doTemplate(ctx, e.Tick().Num, r.limits); err != nil {
+				return err
+			}
+		case <-e.StopChannel:
+			return nil
+		}
+	}
+}
 
-		keyText := ""
-		valueText := ""
+// step generates Tick.Num objects at every tick of the emitter on a stepped clock, without waiting
+// for them in real time, until the end of the clock or the Tick.Duration.
+func (r *runner) step(ctx context.Context, clock *state.Clock) error {
+	e := r.emitter
+	tick := e.Tick()
+	start := clock.Start()
+	end := clock.End()
+	if tick.Duration > 0 && (end.IsZero() || start.Add(tick.Duration).Before(end)) {
+		end = start.Add(tick.Duration)
+	}
+	log.Debug().
+		Time("start", start).
+		Time("end", end).
+		Str("emitter", e.Config.Name).
+		Msg("Starting stepped ticker")
 
-		if em.ValueTemplate != nil {
-			valueText = em.ValueTemplate.ExecuteWith(localState)
-			if em.Config.Oneline {
-				valueText = strings.ReplaceAll(valueText, "\n", "")
+	var elapsed time.Duration
+	due := tick.ImmediateStart
+	for ctx.Err() == nil {
+		if due {
+			if ok, err := r.stepUntil(ctx, clock, start.Add(elapsed)); !ok || err != nil {
+				return err
+			}
+			if !clock.Advance(ctx, e, start.Add(elapsed)) {
+				return nil
+			}
+			if err := r.swapTemplates(ctx); err != nil {
+				return err
+			}
+			if err := r.doTemplate(ctx, e.Tick().Num, r.limits); err != nil {
+				return err
 			}
 		}
-		if em.KeyTemplate != nil {
-			keyText = em.KeyTemplate.Execute()
-			log.Debug().Str("key", keyText).Msg("key generated with template")
-		} else {
-			keyText = localState.Key
-			log.Debug().Str("key", keyText).Msg("key generated within localState")
+		wait, ok := e.Step(elapsed)
+		if wait <= 0 {
+			return fmt.Errorf("emitter %s: a positive frequency is needed to tick on a stepped clock", e.Config.Name)
+		}
+		elapsed += wait
+		due = ok
+		if !end.IsZero() && !start.Add(elapsed).Before(end) {
+			return r.drain(ctx, clock, end)
 		}
+	}
+	return nil
+}
 
-		// building emitter configuration map
-		cfgParams := make(map[string]string)
-		for k, v := range em.Config.ConfigParameters {
-			cfgParams[k] = v
+// configure configures the outputs of the emitter with its configuration parameters
+func (r *runner) configure(ctx context.Context) error {
+	e := r.emitter
+	if err := e.Plugin().Configure(ctx, r.configParameters()); err != nil {
+		return fmt.Errorf("error in configuring output of emitter %s: %w", e.Config.Name, err)
+	}
+	if r.deadLetter != nil {
+		if err := r.deadLetter.Configure(ctx, r.deadLetterParameters()); err != nil {
+			return fmt.Errorf("error in configuring dead letter output of emitter %s: %w", e.Config.Name, err)
 		}
-		cfgParams["emitter.name"] = em.Config.Name
-		for k, v := range configParams {
-			ks := strings.Split(k, ".")
-			if len(ks) == 1 {
-				cfgParams[k] = v
-			} else if ks[0] == em.Config.Name {
-				log.Debug().
-					Str("key", ks[1]).
-					Str("value", v).
-					Str("name", em.Config.Name).
-					Msg("adding configuration parameter")
-				wholeKey := strings.Join(ks[1:], ".")
-				cfgParams[wholeKey] = v
+	}
+	for name, p := range r.stateOutputs {
+		if err := p.Configure(ctx, r.stateParameters(name)); err != nil {
+			return fmt.Errorf("error in configuring output of state %s of emitter %s: %w", name, e.Config.Name, err)
+		}
+	}
+	return nil
+}
+
+// flush waits for the objects of the emitter to be written by its outputs
+func (r *runner) flush() {
+	e := r.emitter
+	flush := func(p *plugin.Plugin, configParams map[string]string) {
+		if p == nil {
+			return
+		}
+		if err := p.Flush(context.Background(), configParams); err != nil {
+			log.Warn().Err(err).Str("emitter", e.Config.Name).Str("plugin", p.Name).Msg("error in flushing output")
+		}
+	}
+	flush(e.Plugin(), r.configParameters())
+	flush(r.deadLetter, r.deadLetterParameters())
+	// the states without their own output produce to the output of the emitter with their parameters
+	if sc := e.Config.Scenario; sc != nil {
+		for name := range sc.States {
+			if name == sc.Initial {
+				continue
+			}
+			p, ok := r.stateOutputs[name]
+			if !ok {
+				p = e.Plugin()
 			}
+			flush(p, r.stateParameters(name))
 		}
+	}
+}
 
-		log.Debug().
-			Str("name", em.Config.Name).
-			Interface("cfgParams", cfgParams).Msg("configuration parameters")
+// doTemplate generates and produces num objects, waiting limits before each of them.
+// The errors are handled with the error policy of the emitter, and an error is returned
+// only if the emitter must stop.
+func (r *runner) doTemplate(ctx context.Context, num int, limits rateLimits) error {
+	if r.emitter.Config.Workers > 1 {
+		return r.doParallel(ctx, num, limits)
+	}
+
+	for i := 0; i < num; i++ {
+		if ctx.Err() != nil || limits.wait(ctx) != nil {
+			return nil
+		}
+		if err := r.emit(ctx, r.prepare(r.generate()), limits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		var resp *jrpc.ProduceResponse
-		resp, err = em.Produce(ctx, []byte(keyText), []byte(valueText), localState.Header, cfgParams)
+// object is an object generated by the templates of an emitter, with the error of the templates
+type object struct {
+	key     []byte
+	value   []byte
+	headers map[string]string
+	err     error
+	// entity is the entity of the scenario moved to a new state by the object, or its session, if any
+	entity *entity
+}
+
+// generate executes the templates of the emitter for the next object, the first event of a new
+// session if the emitter has Sessions
+func (r *runner) generate() object {
+	t, drifted := r.templates()
+	var obj object
+	if s := r.emitter.Config.Sessions; s != nil {
+		obj = r.sessionEvent(t, r.lifecycle.startSession(s, state.GetSharedState().Execution.Now()))
+	} else {
+		obj = r.generateWith(t, nil)
+	}
+	if drifted {
+		obj = withAnomaly(obj, SchemaDriftAnomaly)
+	}
+	return obj
+}
+
+// templates returns the templates of the emitter for the next object, and true if they are the
+// ones of the schema drift of its Chaos
+func (r *runner) templates() (*emitter.Templates, bool) {
+	em := r.emitter
+	if em.DriftTemplates != nil && r.chaos.drift(em.Config.Name, em.Config.Chaos.Drift, state.GetSharedState().Execution.Now()) {
+		return em.DriftTemplates, true
+	}
+	return &emitter.Templates{Key: em.KeyTemplate, Value: em.ValueTemplate, Header: em.HeaderTemplate}, false
+}
+
+// generateWith executes the templates t for the next object, with the fields and the session of ent if any
+func (r *runner) generateWith(t *emitter.Templates, ent *entity) object {
+	state.GetSharedState().Execution.NextIteration()
+
+	localState := state.NewState()
+	if ent != nil {
+		localState.Entity = ent.fields
+		localState.Session = ent.session
+	}
+	// the key and the templates draw from the stream of the emitter, so that seeded runs are
+	// reproducible whatever the interleaving of the emitters
+	if k := r.emitter.Config.Keys; k != nil && (ent == nil || ent.session != nil && ent.session.First()) {
+		// the entities keep the key of the object which created them
+		localState.Key = k.Next(r.emitter.Scope.Random())
+	}
+	keyText, valueText, err := r.render(t, localState)
+	if err != nil {
+		err = fmt.Errorf("template error: %w", err)
+	}
+	return object{
+		key:     []byte(keyText),
+		value:   []byte(valueText),
+		headers: localState.Header,
+		err:     err,
+	}
+}
+
+// emission is an object of an emitter with the anomalies injected by its chaos and its disorder
+type emission struct {
+	obj object
+	// held is true if the disorder holds obj back, to produce it later
+	held bool
+	// copies are the duplicates of obj, produced after it
+	copies []object
+	// released are the objects held back before, produced after obj
+	released []object
+	// next is the entity of the scenario or the session scheduled once obj is produced
+	next *entity
+}
+
+// prepare injects the anomalies of the chaos and the disorder of the emitter in obj, and plans the next
+// step of its entity. It must be called in the order of the objects, which are then produced
+// concurrently, so that seeded runs draw from the streams of the emitter in the same order.
+func (r *runner) prepare(obj object) emission {
+	if obj.err != nil {
+		return emission{obj: obj}
+	}
+	now := state.GetSharedState().Execution.Now()
+	obj = r.chaos.corrupt(r.emitter.Config.Chaos, obj)
+	if obj.err != nil {
+		return emission{obj: obj}
+	}
+	next := r.lifecycle.plan(r.emitter.Config, obj, now)
+	if r.disorder.hold(obj, now) {
+		// the entity moves on from the time the object was generated at
+		r.lifecycle.schedule(next)
+		return emission{obj: obj, held: true}
+	}
+	return emission{
+		obj:      obj,
+		copies:   r.disorder.copies(obj),
+		released: r.disorder.released(),
+		next:     next,
+	}
+}
+
+// emit produces the object of e with its copies and the objects released after it, applying the
+// error policy of the emitter if it can't be generated or produced.
+// It returns an error if the emitter must stop.
+func (r *runner) emit(ctx context.Context, e emission, limits rateLimits) error {
+	if e.held {
+		return nil
+	}
+	produced, err := r.deliver(ctx, e.obj, limits)
+	if err != nil {
+		return err
+	}
+	var next []object
+	if produced {
+		r.lifecycle.schedule(e.next)
+		next = e.copies
+	}
+	for _, o := range append(next, e.released...) {
+		if _, err := r.deliver(ctx, o, limits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver produces obj, applying the error policy of the emitter if it can't be generated or produced.
+// It returns false if obj was not produced, and an error if the emitter must stop.
+func (r *runner) deliver(ctx context.Context, obj object, limits rateLimits) (bool, error) {
+	err := obj.err
+	if err == nil {
+		err = r.produce(ctx, obj, limits)
+	}
+	if err != nil {
+		r.counters.failed()
+		return false, r.failed(ctx, obj.key, obj.value, obj.headers, err)
+	}
+	r.consecutiveErrors.Store(0)
+	log.Debug().Str("name", r.emitter.Config.Name).Msg("object produced")
+	return true, nil
+}
+
+// render executes the templates t of the emitter, returning the key and the value and
+// adding the generated headers to localState
+func (r *runner) render(t *emitter.Templates, localState *state.State) (string, string, error) {
+	em := r.emitter
+	keyText := ""
+	valueText := ""
+	var err error
+
+	if t.Value != nil {
+		if valueText, err = t.Value.ExecuteWith(localState); err != nil {
+			return "", "", err
+		}
+		if em.Config.Oneline {
+			valueText = strings.ReplaceAll(valueText, "\n", "")
+		}
+	}
+	if t.Key != nil {
+		if keyText, err = t.Key.ExecuteWith(localState); err != nil {
+			return "", valueText, err
+		}
+		log.Debug().Str("key", keyText).Msg("key generated with template")
+	} else {
+		keyText = localState.Key
+		log.Debug().Str("key", keyText).Msg("key generated within localState")
+	}
+	if t.Header != nil {
+		headerText, err := t.Header.ExecuteWith(localState)
 		if err != nil {
+			return keyText, valueText, err
+		}
+		if err = mergeHeaders(localState.Header, headerText); err != nil {
 			log.Warn().
 				Err(err).
 				Str("name", em.Config.Name).
-				Msg("error in emission")
-		} else {
-			state.GetSharedState().Execution.GeneratedObjects++
-			state.GetSharedState().Execution.GeneratedBytes += resp.Bytes
+				Str("header", headerText).
+				Msg("header template must generate a JSON object, ignoring it")
 		}
 	}
+	return keyText, valueText, nil
+}
+
+// configParameters returns the configuration parameters of the emitter, overridden by
+// the ones passed to the loop in the form <emitter name>.<parameter>
+func (r *runner) configParameters() map[string]string {
+	em := r.emitter
+
+	// building emitter configuration map
+	cfgParams := make(map[string]string)
+	if em.Config.Topic != "" {
+		cfgParams["topic"] = em.Config.Topic
+	}
+	for k, v := range em.Config.ConfigParameters {
+		cfgParams[k] = v
+	}
+	cfgParams["emitter.name"] = em.Config.Name
+	if em.Config.Group != "" {
+		cfgParams["emitter.group"] = em.Config.Group
+	}
+	for k, v := range r.configParams {
+		ks := strings.Split(k, ".")
+		if len(ks) == 1 {
+			cfgParams[k] = v
+		} else if ks[0] == em.Config.Name {
+			log.Debug().
+				Str("key", ks[1]).
+				Str("value", v).
+				Str("name", em.Config.Name).
+				Msg("adding configuration parameter")
+			wholeKey := strings.Join(ks[1:], ".")
+			cfgParams[wholeKey] = v
+		}
+	}
+
+	log.Debug().
+		Str("name", em.Config.Name).
+		Interface("cfgParams", cfgParams).Msg("configuration parameters")
+	return cfgParams
+}
 
+// produce produces an object, retrying as configured in the error policy of the emitter.
+// Only the last failed attempt counts as an error, the previous ones count as retries.
+func (r *runner) produce(ctx context.Context, obj object, limits rateLimits) error {
+	em := r.emitter
+	policy := em.Config.OnError
+	backoff := policy.Backoff
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := r.send(ctx, obj)
+		elapsed := time.Since(start)
+		if err == nil {
+			state.GetSharedState().Execution.AddGenerated(resp.Bytes)
+			limits.produced(resp.Bytes)
+			r.counters.produced(obj.key, resp.Bytes)
+			r.metrics.produced(resp.Bytes, elapsed)
+			return nil
+		}
+		retry := attempt < policy.Retries && ctx.Err() == nil
+		if retry {
+			log.Debug().
+				Err(err).
+				Str("name", em.Config.Name).
+				Int("attempt", attempt+1).
+				Dur("backoff", backoff).
+				Msg("retrying emission")
+			retry = sleep(ctx, backoff) == nil
+		}
+		if !retry {
+			r.metrics.failed(elapsed)
+			return err
+		}
+		r.metrics.retried(elapsed)
+		backoff = min(2*backoff, policy.MaxBackoff)
+	}
+}
+
+// mergeHeaders adds to headers the key/values of the JSON object generated by the header template
+func mergeHeaders(headers map[string]string, headerText string) error {
+	if strings.TrimSpace(headerText) == "" {
+		return nil
+	}
+
+	var generated map[string]any
+	decoder := json.NewDecoder(strings.NewReader(headerText))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generated); err != nil {
+		return err
+	}
+	for k, v := range generated {
+		switch hv := v.(type) {
+		case nil:
+			headers[k] = ""
+		case string:
+			headers[k] = hv
+		default:
+			headers[k] = fmt.Sprint(hv)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,408 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+const (
+	PluginName = "loop_test"
+)
+
+var producer = &recordingProducer{}
+
+func init() {
+	random.SetRandom(0)
+	plugin.RegisterLocalPlugin(PluginName, &plugin.Plugin{
+		Name:     PluginName,
+		Producer: producer,
+	})
+}
+
+type record struct {
+	key     string
+	value   string
+	headers map[string]string
+	params  map[string]string
+}
+
+// recordingProducer keeps every produced record
+type recordingProducer struct {
+	lock    sync.Mutex
+	records []record
+}
+
+func (r *recordingProducer) Produce(_ context.Context,
+	key []byte,
+	value []byte,
+	headers map[string]string,
+	configParams map[string]string) (*jrpc.ProduceResponse, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record{
+		key:     string(key),
+		value:   string(value),
+		headers: headers,
+		params:  configParams,
+	})
+	return &jrpc.ProduceResponse{Bytes: uint64(len(value))}, nil
+}
+
+func (r *recordingProducer) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = nil
+}
+
+func (r *recordingProducer) produced() []record {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]record(nil), r.records...)
+}
+
+func (r *recordingProducer) count(name string) int {
+	n := 0
+	for _, rec := range r.produced() {
+		if rec.params["emitter.name"] == name {
+			n++
+		}
+	}
+	return n
+}
+
+func newConfig(name string, valueTemplate string, tick emitter.Ticker) emitter.Config {
+	return emitter.Config{
+		Name:          name,
+		Tick:          tick,
+		ValueTemplate: valueTemplate,
+		Embedded:      true,
+		Output:        PluginName,
+	}
+}
+
+func runLoop(t *testing.T, configs ...emitter.Config) {
+	t.Helper()
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("test", configs)
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("preload", "value", emitter.Ticker{Num: 0})
+	cfg.Preload = 5
+	runLoop(t, cfg)
+	assert.Equal(t, 5, producer.count("preload"))
+}
+
+func TestDuration(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("duration", "value", emitter.Ticker{
+		Num:       1,
+		Frequency: 10 * time.Millisecond,
+		Duration:  200 * time.Millisecond,
+	})
+
+	start := time.Now()
+	runLoop(t, cfg)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	n := producer.count("duration")
+	assert.Greater(t, n, 5)
+	assert.LessOrEqual(t, n, 21)
+}
+
+func TestImmediateStart(t *testing.T) {
+	t.Run("immediate", func(t *testing.T) {
+		producer.reset()
+		runLoop(t, newConfig("immediate", "value", emitter.Ticker{
+			Num:            2,
+			Frequency:      time.Hour,
+			Duration:       100 * time.Millisecond,
+			ImmediateStart: true,
+		}))
+		assert.Equal(t, 2, producer.count("immediate"))
+	})
+
+	t.Run("not immediate", func(t *testing.T) {
+		producer.reset()
+		runLoop(t, newConfig("not_immediate", "value", emitter.Ticker{
+			Num:       2,
+			Frequency: time.Hour,
+			Duration:  100 * time.Millisecond,
+		}))
+		assert.Equal(t, 0, producer.count("not_immediate"))
+	})
+}
+
+func TestKeyAndHeaderTemplates(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("key_header", `{{.SetKey "internal"}}{{.AddHeader "from_value" "v"}}value`, emitter.Ticker{Num: 3})
+	cfg.KeyTemplate = `{{.Key}}-{{counter "key_header_counter" 0 1}}`
+	cfg.HeaderTemplate = `{"from_header": "{{.Key}}", "number": 42}`
+	runLoop(t, cfg)
+
+	records := producer.produced()
+	if !assert.Len(t, records, 3) {
+		t.FailNow()
+	}
+	for i, rec := range records {
+		assert.Equal(t, "value", rec.value)
+		assert.Equal(t, fmt.Sprintf("internal-%d", i), rec.key)
+		assert.Equal(t, map[string]string{
+			"from_value":  "v",
+			"from_header": "internal",
+			"number":      "42",
+		}, rec.headers)
+	}
+}
+
+func TestInvalidHeaderTemplate(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("invalid_header", `value`, emitter.Ticker{Num: 1})
+	cfg.HeaderTemplate = `not a json object`
+	runLoop(t, cfg)
+
+	records := producer.produced()
+	if !assert.Len(t, records, 1) {
+		t.FailNow()
+	}
+	assert.Empty(t, records[0].headers)
+}
+
+func TestDependsOn(t *testing.T) {
+	t.Run("dependencies are preloaded first", func(t *testing.T) {
+		producer.reset()
+		consumer := newConfig("consumer", `{{random_v_from_list "depends_on_list"}}`, emitter.Ticker{Num: 1})
+		consumer.DependsOn = []string{"producer"}
+		preloaded := newConfig("producer", `{{add_v_to_list "depends_on_list" "preloaded"}}`, emitter.Ticker{
+			Num:       1,
+			Frequency: 10 * time.Millisecond,
+			Duration:  50 * time.Millisecond,
+		})
+		preloaded.Preload = 10
+		runLoop(t, consumer, preloaded)
+
+		for _, rec := range producer.produced() {
+			if rec.params["emitter.name"] == "consumer" {
+				assert.Equal(t, "preloaded", rec.value)
+			}
+		}
+		assert.Equal(t, 1, producer.count("consumer"))
+	})
+
+	t.Run("unknown dependency", func(t *testing.T) {
+		cfg := newConfig("unknown", "value", emitter.Ticker{Num: 1})
+		cfg.DependsOn = []string{"missing"}
+		emitters := orderedmap.New[string, []emitter.Config](1)
+		emitters.Set("test", []emitter.Config{cfg})
+		err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0)
+		assert.ErrorContains(t, err, "missing")
+	})
+
+	t.Run("cyclic dependency", func(t *testing.T) {
+		producer.reset()
+		a := newConfig("a", "value", emitter.Ticker{Num: 1})
+		a.DependsOn = []string{"b"}
+		b := newConfig("b", "value", emitter.Ticker{Num: 1})
+		b.DependsOn = []string{"c"}
+		c := newConfig("c", "value", emitter.Ticker{Num: 1})
+		c.DependsOn = []string{"a"}
+		emitters := orderedmap.New[string, []emitter.Config](1)
+		emitters.Set("test", []emitter.Config{a, b, c})
+		err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0)
+		assert.ErrorContains(t, err, "a -> b -> c -> a")
+		assert.Empty(t, producer.produced())
+	})
+}
+
+func TestProfile(t *testing.T) {
+	producer.reset()
+	runLoop(t, newConfig("profile", "value", emitter.Ticker{
+		Type:       emitter.RampProfile,
+		Num:        1,
+		Duration:   300 * time.Millisecond,
+		Parameters: map[string]any{"from": 0, "to": 200, "over": "300ms"},
+	}))
+
+	// a ramp from 0 to 200 objects/s lasting 300ms generates about 30 objects
+	n := producer.count("profile")
+	assert.Greater(t, n, 5)
+	assert.Less(t, n, 40)
+}
+
+// assertRate checks that count objects were produced at rate per second
+// within at least duration and the elapsed time
+func assertRate(t *testing.T, count int, rate float64, duration time.Duration, elapsed time.Duration) {
+	t.Helper()
+	assert.GreaterOrEqual(t, float64(count), rate*duration.Seconds()-2)
+	assert.LessOrEqual(t, float64(count), rate*elapsed.Seconds()+2)
+}
+
+func TestRateLimits(t *testing.T) {
+	duration := 500 * time.Millisecond
+
+	// limited emitters ignore the frequency and produce as fast as the limits allow
+	t.Run("record rate", func(t *testing.T) {
+		producer.reset()
+		start := time.Now()
+		runLoop(t, newConfig("records", "value", emitter.Ticker{
+			Num:        1,
+			Frequency:  time.Hour,
+			Duration:   duration,
+			RecordRate: 20,
+		}))
+		assertRate(t, producer.count("records"), 20, duration, time.Since(start))
+	})
+
+	t.Run("throughput", func(t *testing.T) {
+		producer.reset()
+		start := time.Now()
+		runLoop(t, newConfig("bytes", "0123456789", emitter.Ticker{
+			Num:        1,
+			Frequency:  time.Hour,
+			Duration:   duration,
+			Throughput: 200,
+		}))
+		assertRate(t, producer.count("bytes"), 20, duration, time.Since(start))
+	})
+
+	t.Run("global", func(t *testing.T) {
+		producer.reset()
+		tick := emitter.Ticker{Num: 1, Frequency: time.Millisecond, Duration: duration}
+		emitters := orderedmap.New[string, []emitter.Config](1)
+		emitters.Set("test", []emitter.Config{newConfig("first", "value", tick), newConfig("second", "value", tick)})
+		start := time.Now()
+		err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, loop.WithRecordRate(20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertRate(t, producer.count("first")+producer.count("second"), 20, duration, time.Since(start))
+	})
+}
+
+func TestReport(t *testing.T) {
+	producer.reset()
+	first := newConfig("first", "value", emitter.Ticker{Num: 3})
+	first.Preload = 2
+	second := newConfig("second", "0123456789", emitter.Ticker{Num: 1})
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("test", []emitter.Config{first, second})
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, loop.WithReport(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report loop.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(6), report.Objects)
+	assert.Equal(t, uint64(35), report.Bytes)
+	assert.Equal(t, uint64(0), report.Errors)
+	assert.Equal(t, []loop.EmitterReport{
+		{Group: "test", Name: "first", Objects: 5, Bytes: 25},
+		{Group: "test", Name: "second", Objects: 1, Bytes: 10},
+	}, report.Emitters)
+}
+
+func TestMetrics(t *testing.T) {
+	producer.reset()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	scraped := make(chan string, 1)
+	go func() {
+		defer close(scraped)
+		for range 50 {
+			time.Sleep(20 * time.Millisecond)
+			req, _ := http.NewRequest(http.MethodGet, "http://"+address+"/metrics", nil)
+			req.Header.Set("Accept", "application/openmetrics-text")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				continue
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if strings.Contains(string(body), `jr_produced_objects_total{emitter="metrics",group="other",plugin="jr-loop_test"}`) {
+				scraped <- string(body)
+				return
+			}
+		}
+	}()
+
+	// the emitters with the same name in different groups have their own series
+	emitters := orderedmap.New[string, []emitter.Config](2)
+	for _, group := range []string{"test", "other"} {
+		emitters.Set(group, []emitter.Config{newConfig("metrics", "value", emitter.Ticker{
+			Num:       1,
+			Frequency: 10 * time.Millisecond,
+			Duration:  time.Second,
+		})})
+	}
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, loop.WithMetrics(address)); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-scraped
+	for _, group := range []string{"test", "other"} {
+		labels := `emitter="metrics",group="` + group + `"`
+		assert.Contains(t, body, `jr_produced_objects_total{`+labels+`,plugin="jr-loop_test"}`)
+		assert.Contains(t, body, `jr_produce_errors_total{`+labels+`,plugin="jr-loop_test"} 0`)
+		assert.Contains(t, body, `jr_produce_retries_total{`+labels+`,plugin="jr-loop_test"} 0`)
+		assert.Contains(t, body, `jr_produce_duration_seconds_count{`+labels+`,plugin="jr-loop_test"}`)
+		assert.Contains(t, body, `jr_target_objects_per_second{`+labels+`} 100`)
+	}
+	assert.Contains(t, body, "# EOF")
+}
@@ -0,0 +1,193 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const metricsNamespace = "jr"
+
+// metrics exposes the counters of the emitters in the OpenMetrics format
+type metrics struct {
+	registry *prometheus.Registry
+	objects  *prometheus.CounterVec
+	bytes    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	labels := []string{"group", "emitter", "plugin"}
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		objects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "produced_objects_total",
+			Help:      "Objects produced by the emitters.",
+		}, labels),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "produced_bytes_total",
+			Help:      "Bytes produced by the emitters, as returned by the plugins.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "produce_errors_total",
+			Help:      "Objects which the plugins failed to produce, after the retries.",
+		}, labels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "produce_retries_total",
+			Help:      "Failed attempts to produce an object which were retried.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "produce_duration_seconds",
+			Help:      "Time taken by the plugins to produce an object.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, labels),
+	}
+	m.registry.MustRegister(m.objects, m.bytes, m.errors, m.retries, m.latency)
+	return m
+}
+
+// register returns the metrics of the named emitter of group, adding the gauges of the target rates
+// of the current emitter with that group and name, if any
+func (m *metrics) register(group string, name string, pluginName string, current func() *emitter.Emitter) *emitterMetrics {
+	if m == nil {
+		return nil
+	}
+
+	objectsRate := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "target_objects_per_second",
+		Help:        "Objects per second the emitter is aiming at, 0 if unknown.",
+		ConstLabels: prometheus.Labels{"group": group, "emitter": name},
+	}, func() float64 {
+		if em := current(); em != nil {
+			return em.TargetRate()
+		}
+		return 0
+	})
+	bytesRate := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "target_bytes_per_second",
+		Help:        "Bytes per second the emitter is aiming at, 0 if unknown.",
+		ConstLabels: prometheus.Labels{"group": group, "emitter": name},
+	}, func() float64 {
+		if em := current(); em != nil {
+			return max(float64(em.Tick().Throughput), 0)
+		}
+		return 0
+	})
+	for _, c := range []prometheus.Collector{objectsRate, bytesRate} {
+		if err := m.registry.Register(c); err != nil {
+			log.Warn().Err(err).Str("group", group).Str("emitter", name).Msg("cannot register target rate metric")
+		}
+	}
+
+	return &emitterMetrics{
+		objects: m.objects.WithLabelValues(group, name, pluginName),
+		bytes:   m.bytes.WithLabelValues(group, name, pluginName),
+		errors:  m.errors.WithLabelValues(group, name, pluginName),
+		retries: m.retries.WithLabelValues(group, name, pluginName),
+		latency: m.latency.WithLabelValues(group, name, pluginName),
+	}
+}
+
+// handler returns the handler of the metrics in the OpenMetrics format
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// serve exposes the metrics on /metrics at address until ctx is done
+func (m *metrics) serve(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.handler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Close(); err != nil {
+			log.Warn().Err(err).Msg("error in closing metrics server")
+		}
+	}()
+	go func() {
+		log.Debug().Str("address", listener.Addr().String()).Msg("serving metrics")
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("error in serving metrics")
+		}
+	}()
+	return nil
+}
+
+// emitterMetrics are the metrics of an emitter. A nil emitterMetrics records nothing.
+type emitterMetrics struct {
+	objects prometheus.Counter
+	bytes   prometheus.Counter
+	errors  prometheus.Counter
+	retries prometheus.Counter
+	latency prometheus.Observer
+}
+
+func (m *emitterMetrics) produced(bytes uint64, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.objects.Inc()
+	m.bytes.Add(float64(bytes))
+	m.latency.Observe(elapsed.Seconds())
+}
+
+func (m *emitterMetrics) failed(elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.errors.Inc()
+	m.latency.Observe(elapsed.Seconds())
+}
+
+func (m *emitterMetrics) retried(elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.retries.Inc()
+	m.latency.Observe(elapsed.Seconds())
+}
@@ -0,0 +1,112 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/tpl"
+	"github.com/rs/zerolog/log"
+)
+
+// Headers added to the objects sent to the dead letter output
+const (
+	DeadLetterErrorHeader   = "jr.error"
+	DeadLetterEmitterHeader = "jr.emitter"
+)
+
+// failed applies the error policy of the emitter to an object which can't be generated or produced.
+// It returns an error if the emitter must stop.
+func (r *runner) failed(ctx context.Context, key []byte, value []byte, headers map[string]string, err error) error {
+	em := r.emitter
+	policy := em.Config.OnError
+	consecutiveErrors := r.consecutiveErrors.Add(1)
+
+	event := log.Warn().
+		Err(err).
+		Str("name", em.Config.Name).
+		Str("policy", policy.Action).
+		Int64("consecutiveErrors", consecutiveErrors)
+	var tplErr *tpl.Error
+	if errors.As(err, &tplErr) {
+		event = event.
+			Str("template", tplErr.Template).
+			Int("line", tplErr.Line).
+			Int("column", tplErr.Column).
+			Str("function", tplErr.Function)
+	}
+	event.Msg("error in emission")
+
+	if policy.Action == emitter.DeadLetterOnError {
+		r.sendToDeadLetter(ctx, key, value, headers, err)
+	}
+
+	if !policy.Stops() || consecutiveErrors < int64(policy.MaxErrors) {
+		return nil
+	}
+	stopErr := fmt.Errorf("emitter %s stopped after %d consecutive errors: %w", em.Config.Name, consecutiveErrors, err)
+	if policy.Action == emitter.AbortOnError && r.abort != nil {
+		r.abort(stopErr)
+	}
+	return stopErr
+}
+
+// sendToDeadLetter produces the failed object to the dead letter output, adding the error to its headers
+func (r *runner) sendToDeadLetter(ctx context.Context, key []byte, value []byte, headers map[string]string, err error) {
+	em := r.emitter
+	if r.deadLetter == nil {
+		log.Error().Str("name", em.Config.Name).Msg("dead letter output not initialized")
+		return
+	}
+
+	dlHeaders := maps.Clone(headers)
+	if dlHeaders == nil {
+		dlHeaders = make(map[string]string)
+	}
+	dlHeaders[DeadLetterErrorHeader] = err.Error()
+	dlHeaders[DeadLetterEmitterHeader] = em.Config.Name
+
+	if _, dlErr := r.deadLetter.Produce(ctx, key, value, dlHeaders, r.deadLetterParameters()); dlErr != nil {
+		log.Error().
+			Err(dlErr).
+			Str("name", em.Config.Name).
+			Str("deadLetter", r.deadLetter.Name).
+			Msg("error in sending to the dead letter output")
+	}
+}
+
+// deadLetterParameters returns the configuration parameters of the dead letter output of the emitter
+func (r *runner) deadLetterParameters() map[string]string {
+	em := r.emitter
+	dlParams := maps.Clone(em.Config.OnError.DeadLetterParameters)
+	if dlParams == nil {
+		dlParams = make(map[string]string)
+	}
+	dlParams["emitter.name"] = em.Config.Name + ".deadletter"
+	if em.Config.Group != "" {
+		dlParams["emitter.group"] = em.Config.Group
+	}
+	return dlParams
+}
@@ -0,0 +1,207 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/jrnd-io/jrv2/pkg/tpl"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+const (
+	FailingPluginName = "loop_test_failing"
+)
+
+var failing = &failingProducer{}
+
+func init() {
+	plugin.RegisterLocalPlugin(FailingPluginName, &plugin.Plugin{
+		Name:     FailingPluginName,
+		Producer: failing,
+	})
+}
+
+// failingProducer fails every produce, counting the attempts
+type failingProducer struct {
+	attempts atomic.Int64
+}
+
+func (f *failingProducer) Produce(context.Context, []byte, []byte, map[string]string, map[string]string) (*jrpc.ProduceResponse, error) {
+	f.attempts.Add(1)
+	return nil, errors.New("broken output")
+}
+
+func newFailingConfig(name string, tick emitter.Ticker, policy emitter.ErrorPolicy) emitter.Config {
+	cfg := newConfig(name, "value", tick)
+	cfg.Output = FailingPluginName
+	cfg.OnError = policy
+	return cfg
+}
+
+// runOutputs runs the configs on their own outputs, returning the error of the loop
+func runOutputs(configs ...emitter.Config) error {
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("test", configs)
+	return loop.DoLoop(context.Background(), emitters, nil, "", 0)
+}
+
+func TestSkipOnError(t *testing.T) {
+	producer.reset()
+	failing.attempts.Store(0)
+
+	err := runOutputs(
+		newFailingConfig("bad", emitter.Ticker{Num: 3}, emitter.ErrorPolicy{}),
+		newConfig("good", "value", emitter.Ticker{Num: 3}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), failing.attempts.Load())
+	assert.Equal(t, 3, producer.count("good"))
+}
+
+func TestRetryOnError(t *testing.T) {
+	failing.attempts.Store(0)
+
+	err := runOutputs(newFailingConfig("retry", emitter.Ticker{Num: 2}, emitter.ErrorPolicy{
+		Action:  emitter.RetryOnError,
+		Retries: 2,
+		Backoff: time.Millisecond,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), failing.attempts.Load())
+}
+
+func TestRetriesCountOneError(t *testing.T) {
+	failing.attempts.Store(0)
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("test", []emitter.Config{newFailingConfig("retry", emitter.Ticker{Num: 2}, emitter.ErrorPolicy{
+		Action:  emitter.RetryOnError,
+		Retries: 2,
+		Backoff: time.Millisecond,
+	})})
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := loop.DoLoop(context.Background(), emitters, nil, "", 0, loop.WithReport(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report loop.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(6), failing.attempts.Load())
+	// every object fails after 3 attempts, counting as a single error
+	assert.Equal(t, uint64(2), report.Errors)
+}
+
+func TestDeadLetterOnError(t *testing.T) {
+	producer.reset()
+
+	err := runOutputs(newFailingConfig("deadletter", emitter.Ticker{Num: 2}, emitter.ErrorPolicy{
+		Action:               emitter.DeadLetterOnError,
+		DeadLetter:           PluginName,
+		DeadLetterParameters: map[string]string{"topic": "dlq"},
+	}))
+	assert.NoError(t, err)
+
+	records := producer.produced()
+	assert.Len(t, records, 2)
+	for _, rec := range records {
+		assert.Equal(t, "value", rec.value)
+		assert.Equal(t, "broken output", rec.headers[loop.DeadLetterErrorHeader])
+		assert.Equal(t, "deadletter", rec.headers[loop.DeadLetterEmitterHeader])
+		assert.Equal(t, "deadletter.deadletter", rec.params["emitter.name"])
+		assert.Equal(t, "dlq", rec.params["topic"])
+	}
+}
+
+func TestFailOnError(t *testing.T) {
+	producer.reset()
+	failing.attempts.Store(0)
+
+	tick := emitter.Ticker{Num: 1, Frequency: 10 * time.Millisecond, Duration: 300 * time.Millisecond}
+	err := runOutputs(
+		newFailingConfig("fail", tick, emitter.ErrorPolicy{Action: emitter.FailOnError, MaxErrors: 2}),
+		newConfig("good", "value", tick),
+	)
+	assert.ErrorContains(t, err, "emitter fail stopped after 2 consecutive errors")
+	assert.Equal(t, int64(2), failing.attempts.Load())
+	// the other emitter goes on until its duration is elapsed
+	assert.Greater(t, producer.count("good"), 10)
+}
+
+func TestAbortOnError(t *testing.T) {
+	producer.reset()
+
+	start := time.Now()
+	err := runOutputs(
+		newFailingConfig("abort", emitter.Ticker{Num: 1, Frequency: 10 * time.Millisecond, Duration: 10 * time.Second},
+			emitter.ErrorPolicy{Action: emitter.AbortOnError}),
+		newConfig("good", "value", emitter.Ticker{Num: 1, Frequency: 10 * time.Millisecond, Duration: 10 * time.Second}),
+	)
+	assert.ErrorContains(t, err, "emitter abort stopped after 1 consecutive errors")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestTemplateError(t *testing.T) {
+	producer.reset()
+
+	// the template is valid but its execution fails
+	bad := newConfig("bad", "{{.Missing}}", emitter.Ticker{Num: 2})
+	err := runOutputs(bad, newConfig("good", "value", emitter.Ticker{Num: 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, producer.count("bad"))
+	assert.Equal(t, 2, producer.count("good"))
+}
+
+func TestTemplateErrorLocation(t *testing.T) {
+	producer.reset()
+
+	// a missing value fails the object, reporting where
+	bad := newConfig("missing", "{\n  \"id\": \"{{get_v \"missing_id\"}}\"\n}", emitter.Ticker{Num: 1})
+	bad.OnError = emitter.ErrorPolicy{Action: emitter.FailOnError, MaxErrors: 1}
+	err := runOutputs(bad)
+	var tplErr *tpl.Error
+	if !errors.As(err, &tplErr) {
+		t.Fatalf("expected a template error, got %v", err)
+	}
+	assert.Equal(t, "value", tplErr.Template)
+	assert.Equal(t, 2, tplErr.Line)
+	assert.Equal(t, "get_v", tplErr.Function)
+	assert.ErrorContains(t, err, `value:2:11: get_v: no value for key "missing_id"`)
+	assert.Equal(t, 0, producer.count("missing"))
+}
@@ -0,0 +1,111 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/state"
+)
+
+// nextDue returns when the next transition of an entity or late object is due, false if there is none
+func (r *runner) nextDue() (time.Time, bool) {
+	due, ok := r.lifecycle.next()
+	if late, lateOk := r.disorder.next(); lateOk && (!ok || late.Before(due)) {
+		return late, true
+	}
+	return due, ok
+}
+
+// due returns a channel receiving when the next transition or late object is due, resetting timer,
+// or nil if there is none
+func (r *runner) due(timer *time.Timer, clock *state.Clock) <-chan time.Time {
+	due, ok := r.nextDue()
+	if !ok {
+		timer.Stop()
+		return nil
+	}
+	timer.Reset(clock.Real(due.Sub(clock.Now())))
+	return timer.C
+}
+
+// doDue produces the late objects and moves the entities due at now
+func (r *runner) doDue(ctx context.Context, now time.Time) error {
+	for ctx.Err() == nil {
+		obj, ok := r.disorder.popDue(now)
+		if !ok {
+			break
+		}
+		if _, err := r.deliver(ctx, obj, r.limits); err != nil {
+			return err
+		}
+	}
+	return r.transitDue(ctx, now)
+}
+
+// stepUntil does what is due before until on a stepped clock, advancing it to the due times.
+// It returns false if ctx is done.
+func (r *runner) stepUntil(ctx context.Context, clock *state.Clock, until time.Time) (bool, error) {
+	for {
+		due, ok := r.nextDue()
+		if !ok || (!until.IsZero() && !due.Before(until)) {
+			return true, nil
+		}
+		if !clock.Advance(ctx, r.emitter, due) {
+			return false, nil
+		}
+		if err := r.doDue(ctx, due); err != nil {
+			return false, err
+		}
+	}
+}
+
+// drain produces the objects held back, then moves the pending entities and produces the late objects
+// after the last tick, until there are none or until end
+func (r *runner) drain(ctx context.Context, clock *state.Clock, end time.Time) error {
+	for _, obj := range r.disorder.flush() {
+		if _, err := r.deliver(ctx, obj, r.limits); err != nil {
+			return err
+		}
+	}
+	if clock.IsStepped() {
+		_, err := r.stepUntil(ctx, clock, end)
+		return err
+	}
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		due, ok := r.nextDue()
+		if !ok || (!end.IsZero() && !due.Before(end)) {
+			return nil
+		}
+		timer.Reset(clock.Real(due.Sub(clock.Now())))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			if err := r.doDue(ctx, clock.Now()); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/rs/zerolog/log"
+)
+
+// entity is an entity of the Scenario of an emitter, or a session of its Sessions
+type entity struct {
+	state   string
+	session *state.Session
+	key     []byte
+	fields  map[string]any
+	// next is the state of the next transition, due at the time of the clock of the run
+	next string
+	due  time.Time
+	// seq keeps the entities due at the same time in the order they are scheduled
+	seq uint64
+}
+
+// entities is a heap of the entities waiting for a transition, by due time
+type entities []*entity
+
+func (e entities) Len() int { return len(e) }
+func (e entities) Less(i, j int) bool {
+	if e[i].due.Equal(e[j].due) {
+		return e[i].seq < e[j].seq
+	}
+	return e[i].due.Before(e[j].due)
+}
+func (e entities) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e *entities) Push(x any)   { *e = append(*e, x.(*entity)) }
+func (e *entities) Pop() any {
+	old := *e
+	n := len(old)
+	x := old[n-1]
+	*e = old[:n-1]
+	return x
+}
+
+// lifecycle moves the entities of the Scenario of an emitter through its states,
+// and generates the events of its Sessions
+type lifecycle struct {
+	random  random.Source
+	lock    sync.Mutex
+	pending entities
+	seq     uint64
+}
+
+func newLifecycle(e *emitter.Emitter) *lifecycle {
+	l := &lifecycle{random: random.Random}
+	name := ""
+	switch {
+	case e.Config.Scenario != nil:
+		name = e.Config.ID() + "/scenario"
+	case e.Config.Sessions != nil:
+		name = e.Config.ID() + "/sessions"
+	}
+	if name != "" {
+		if stream := random.NewStream(name); stream != nil {
+			l.random = stream
+		}
+	}
+	return l
+}
+
+// plan creates an entity from an object of an emitter with a Scenario, and draws the next transition
+// of the entity, or the next event of the session of the object. It returns the entity to schedule
+// once the object is produced, nil if there is none.
+func (l *lifecycle) plan(cfg *emitter.Config, obj object, now time.Time) *entity {
+	if l == nil {
+		return nil
+	}
+	ent := obj.entity
+	switch {
+	case ent != nil && ent.session != nil:
+		if cfg.Sessions == nil || ent.session.Last() {
+			return nil
+		}
+		ent.due = now.Add(cfg.Sessions.ThinkTime.Next(l.random))
+	case cfg.Scenario != nil:
+		s := cfg.Scenario
+		if ent == nil {
+			ent = &entity{state: s.Initial, key: obj.key, fields: make(map[string]any)}
+			mergeFields(ent.fields, obj.value)
+		}
+		t, ok := s.States[ent.state].Next(l.random)
+		if !ok {
+			return nil
+		}
+		ent.next = t.To
+		ent.due = now.Add(t.Delay.Next(l.random))
+	default:
+		return nil
+	}
+	// the entities due at the same time are ordered as their objects were generated
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.seq++
+	ent.seq = l.seq
+	return ent
+}
+
+// schedule adds ent, planned when its object was generated, to the pending entities
+func (l *lifecycle) schedule(ent *entity) {
+	if l == nil || ent == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	heap.Push(&l.pending, ent)
+}
+
+// next returns when the next entity is due, false if there is none
+func (l *lifecycle) next() (time.Time, bool) {
+	if l == nil {
+		return time.Time{}, false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.pending) == 0 {
+		return time.Time{}, false
+	}
+	return l.pending[0].due, true
+}
+
+// popDue removes and returns the next entity if it is due at now, nil otherwise
+func (l *lifecycle) popDue(now time.Time) *entity {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.pending) == 0 || l.pending[0].due.After(now) {
+		return nil
+	}
+	return heap.Pop(&l.pending).(*entity)
+}
+
+// mergeFields adds to fields the ones of value, if it is a JSON object
+func mergeFields(fields map[string]any, value []byte) {
+	var generated map[string]any
+	decoder := json.NewDecoder(strings.NewReader(string(value)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generated); err != nil {
+		return
+	}
+	maps.Copy(fields, generated)
+}
+
+// transitDue moves the entities due at now to their next state
+func (r *runner) transitDue(ctx context.Context, now time.Time) error {
+	for ctx.Err() == nil {
+		ent := r.lifecycle.popDue(now)
+		if ent == nil {
+			return nil
+		}
+		if err := r.emit(ctx, r.prepare(r.transit(ent)), r.limits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transit moves ent to its next state, rendering the templates of the state with the fields of ent,
+// or generates the next event of its session
+func (r *runner) transit(ent *entity) object {
+	if ent.session != nil {
+		ent.session.Next(state.GetSharedState().Execution.Now())
+		t, drifted := r.templates()
+		obj := r.sessionEvent(t, ent)
+		if drifted {
+			obj = withAnomaly(obj, SchemaDriftAnomaly)
+		}
+		return obj
+	}
+	ent.state = ent.next
+	t := r.emitter.StateTemplates[ent.state]
+	if t == nil {
+		return object{key: ent.key, entity: ent, err: fmt.Errorf("no templates for state %s", ent.state)}
+	}
+	obj := r.generateWith(t, ent)
+	if t.Key == nil && len(obj.key) == 0 {
+		obj.key = ent.key
+	}
+	mergeFields(ent.fields, obj.value)
+	obj.entity = ent
+	return obj
+}
+
+// send produces obj to the output of the emitter, or to the one of the state of its entity
+func (r *runner) send(ctx context.Context, obj object) (*jrpc.ProduceResponse, error) {
+	em := r.emitter
+	if obj.entity != nil && obj.entity.session == nil {
+		p, ok := r.stateOutputs[obj.entity.state]
+		if !ok {
+			p = em.Plugin()
+		}
+		return em.ProduceTo(ctx, p, obj.key, obj.value, obj.headers, r.stateParameters(obj.entity.state))
+	}
+	return em.Produce(ctx, obj.key, obj.value, obj.headers, r.configParameters())
+}
+
+// stateParameters returns the configuration parameters of the output of a state of the Scenario
+func (r *runner) stateParameters(name string) map[string]string {
+	em := r.emitter
+	params := r.configParameters()
+	if s := em.Config.Scenario; s != nil && s.States[name] != nil {
+		maps.Copy(params, s.States[name].ConfigParameters)
+	}
+	params["emitter.name"] = em.Config.Name + "." + name
+	return params
+}
+
+// stateOutputs returns the outputs of the states of the Scenario of em with their own output
+func (p *plugins) stateOutputs(em *emitter.Emitter) (map[string]*plugin.Plugin, error) {
+	s := em.Config.Scenario
+	if s == nil {
+		return nil, nil
+	}
+	outputs := make(map[string]*plugin.Plugin)
+	for name, st := range s.States {
+		if st == nil || name == s.Initial || st.Output == "" {
+			continue
+		}
+		out, err := p.forOutput(st.Output)
+		if err != nil {
+			return nil, fmt.Errorf("state %s: %w", name, err)
+		}
+		log.Debug().Str("emitter", em.Config.Name).Str("state", name).Str("plugin", out.Name).Msg("setting state plugin")
+		outputs[name] = out
+	}
+	return outputs, nil
+}
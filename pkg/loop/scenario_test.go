@@ -0,0 +1,151 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Time   string `json:"time"`
+}
+
+func parseOrder(t *testing.T, rec record) order {
+	t.Helper()
+	var o order
+	if err := json.Unmarshal([]byte(rec.value), &o); err != nil {
+		t.Fatal(err, rec.value)
+	}
+	return o
+}
+
+func TestScenario(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("orders", `{"id": {{counter "emitter:order" 1 1}}, "status": "created"}`, emitter.Ticker{Num: 20})
+	cfg.KeyTemplate = `{{counter "emitter:key" 1 1}}`
+	cfg.Scenario = &emitter.Scenario{
+		Initial: "created",
+		States: map[string]*emitter.ScenarioState{
+			"created": {
+				Transitions: []emitter.Transition{
+					{To: "preparing", Probability: 1, Delay: emitter.Delay{Mean: 10 * time.Millisecond}},
+				},
+			},
+			"preparing": {
+				ValueTemplate: `{"status": "preparing"}`,
+				Transitions: []emitter.Transition{
+					{To: "completed", Probability: 0.8, Delay: emitter.Delay{Distribution: emitter.UniformDelay, Min: time.Millisecond, Max: 20 * time.Millisecond}},
+					{To: "cancelled", Probability: 0.2, Delay: emitter.Delay{Distribution: emitter.ExponentialDelay, Mean: 5 * time.Millisecond}},
+				},
+			},
+			"completed": {
+				ValueTemplate:    `{"id": {{.Entity.id}}, "status": "completed"}`,
+				ConfigParameters: map[string]string{"topic": "completed"},
+			},
+			"cancelled": {
+				ValueTemplate: `{"id": {{.Entity.id}}, "status": "cancelled"}`,
+				KeyTemplate:   `cancelled-{{.Entity.id}}`,
+			},
+		},
+	}
+	runLoop(t, cfg)
+
+	assert.Equal(t, 20, producer.count("orders"))
+	assert.Equal(t, 20, producer.count("orders.preparing"))
+	assert.Equal(t, 20, producer.count("orders.completed")+producer.count("orders.cancelled"))
+
+	// every entity goes through its states in order, keeping its key and its fields
+	statuses := make(map[string][]string)
+	for _, rec := range producer.produced() {
+		o := parseOrder(t, rec)
+		key := rec.key
+		switch rec.params["emitter.name"] {
+		case "orders.completed":
+			assert.Equal(t, "completed", rec.params["topic"])
+		case "orders.cancelled":
+			assert.True(t, strings.HasPrefix(key, "cancelled-"), key)
+			key = strings.TrimPrefix(key, "cancelled-")
+		}
+		if o.ID != 0 {
+			assert.Equal(t, key, strconv.Itoa(o.ID))
+		}
+		statuses[key] = append(statuses[key], o.Status)
+	}
+	assert.Len(t, statuses, 20)
+	for key, s := range statuses {
+		assert.Len(t, s, 3, key)
+		assert.Equal(t, []string{"created", "preparing"}, s[:2], key)
+		assert.Contains(t, []string{"completed", "cancelled"}, s[2], key)
+	}
+}
+
+func TestSteppedScenario(t *testing.T) {
+	producer.reset()
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, start.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := newConfig("stepped_orders", `{"id": {{counter "emitter:order" 1 1}}, "time": "`+clockTemplate+`"}`,
+		emitter.Ticker{Num: 1, Frequency: 10 * time.Minute})
+	cfg.Scenario = &emitter.Scenario{
+		Initial: "created",
+		States: map[string]*emitter.ScenarioState{
+			"created": {
+				Transitions: []emitter.Transition{
+					{To: "completed", Probability: 1, Delay: emitter.Delay{Mean: 15 * time.Minute}},
+				},
+			},
+			"completed": {ValueTemplate: `{"id": {{.Entity.id}}, "status": "completed", "time": "` + clockTemplate + `"}`},
+		},
+	}
+	runClock(t, clock, cfg)
+
+	// the orders are created every 10 minutes, and completed 15 minutes later until the end of the clock
+	assert.Equal(t, 5, producer.count("stepped_orders"))
+	assert.Equal(t, 4, producer.count("stepped_orders.completed"))
+	created := make(map[int]time.Time)
+	var last time.Time
+	for _, rec := range producer.produced() {
+		o := parseOrder(t, rec)
+		now, err := time.Parse(time.RFC3339, o.Time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, now.Before(last), "%s before %s", now, last)
+		last = now
+		if o.Status == "completed" {
+			assert.Equal(t, created[o.ID].Add(15*time.Minute), now)
+		} else {
+			created[o.ID] = now
+		}
+	}
+}
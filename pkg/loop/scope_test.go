@@ -0,0 +1,80 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// runGroups runs the emitters in groups and returns the sorted values produced by every group
+func runGroups(t *testing.T, groups map[string][]emitter.Config) map[string][]string {
+	t.Helper()
+	producer.reset()
+	emitters := orderedmap.New[string, []emitter.Config](len(groups))
+	group := make(map[string]string)
+	for name, configs := range groups {
+		emitters.Set(name, configs)
+		for _, cfg := range configs {
+			group[cfg.Name] = name
+		}
+	}
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0); err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string][]string)
+	for name, v := range valuesOf() {
+		values[group[name]] = append(values[group[name]], v...)
+	}
+	for _, v := range values {
+		slices.Sort(v)
+	}
+	return values
+}
+
+func TestScopes(t *testing.T) {
+	counter := `{{counter "scope_id" 1 1}}`
+	values := runGroups(t, map[string][]emitter.Config{
+		"scope_a": {newConfig("scope_a1", counter, emitter.Ticker{Num: 3})},
+		"scope_b": {newConfig("scope_b1", counter, emitter.Ticker{Num: 3})},
+		"scope_c": {
+			newConfig("scope_c1", counter, emitter.Ticker{Num: 2}),
+			newConfig("scope_c2", counter, emitter.Ticker{Num: 2}),
+		},
+	})
+	// every group has its own counter, shared by its emitters
+	assert.Equal(t, []string{"1", "2", "3"}, values["scope_a"])
+	assert.Equal(t, []string{"1", "2", "3"}, values["scope_b"])
+	assert.Equal(t, []string{"1", "2", "3", "4"}, values["scope_c"])
+
+	global := `{{counter "global:scope_id" 1 1}}`
+	values = runGroups(t, map[string][]emitter.Config{
+		"scope_d": {newConfig("scope_d1", global, emitter.Ticker{Num: 2})},
+		"scope_e": {newConfig("scope_e1", global, emitter.Ticker{Num: 2})},
+	})
+	assert.Equal(t, []string{"1", "2", "3", "4"}, slices.Sorted(slices.Values(append(values["scope_d"], values["scope_e"]...))))
+}
@@ -0,0 +1,62 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/state"
+)
+
+// startSession returns the entity of a new session of s starting at now
+func (l *lifecycle) startSession(s *emitter.Sessions, now time.Time) *entity {
+	return &entity{
+		session: state.NewSession(l.newID(), now, s.Events.Next(l.random)),
+		fields:  make(map[string]any),
+	}
+}
+
+// newID returns the id of a new session, drawn from the stream of the lifecycle if it has one
+func (l *lifecycle) newID() string {
+	if r, ok := l.random.(io.Reader); ok {
+		if id, err := uuid.NewRandomFromReader(r); err == nil {
+			return id.String()
+		}
+	}
+	return uuid.NewString()
+}
+
+// sessionEvent generates the current event of the session of ent with the templates t.
+// Without a key template the events keep the key of the first one.
+func (r *runner) sessionEvent(t *emitter.Templates, ent *entity) object {
+	obj := r.generateWith(t, ent)
+	if ent.session.First() {
+		ent.key = obj.key
+	} else if t.Key == nil && len(obj.key) == 0 {
+		obj.key = ent.key
+	}
+	mergeFields(ent.fields, obj.value)
+	obj.entity = ent
+	return obj
+}
@@ -0,0 +1,126 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+const sessionTemplate = `{"session": "{{.Session.ID}}", "seq": {{.Session.Seq}}, "elapsed": {{.Session.Elapsed.Milliseconds}}, ` +
+	`"user": {{with .Entity}}{{.user}}{{else}}{{counter "emitter:user" 1 1}}{{end}}}`
+
+type event struct {
+	Session string `json:"session"`
+	Seq     int    `json:"seq"`
+	Elapsed int64  `json:"elapsed"`
+	User    int    `json:"user"`
+}
+
+// sessionsOf returns the events of the records of the emitter name by session
+func sessionsOf(t *testing.T, name string) map[string][]event {
+	t.Helper()
+	sessions := make(map[string][]event)
+	for _, rec := range producer.produced() {
+		if rec.params["emitter.name"] != name {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(rec.value), &e); err != nil {
+			t.Fatal(err, rec.value)
+		}
+		sessions[e.Session] = append(sessions[e.Session], e)
+	}
+	return sessions
+}
+
+func TestSessions(t *testing.T) {
+	producer.reset()
+	cfg := newConfig("sessions", sessionTemplate, emitter.Ticker{Num: 10})
+	cfg.Sessions = &emitter.Sessions{
+		Events:    emitter.Count{Distribution: emitter.UniformDelay, Min: 2, Max: 5},
+		ThinkTime: emitter.Delay{Distribution: emitter.UniformDelay, Min: time.Millisecond, Max: 5 * time.Millisecond},
+	}
+	runLoop(t, cfg)
+
+	sessions := sessionsOf(t, "sessions")
+	assert.Len(t, sessions, 10)
+	users := make(map[int]bool)
+	for id, events := range sessions {
+		assert.GreaterOrEqual(t, len(events), 2, id)
+		assert.LessOrEqual(t, len(events), 5, id)
+		// the events of a session are ordered, by the same user
+		for i, e := range events {
+			assert.Equal(t, i+1, e.Seq, id)
+			assert.Equal(t, events[0].User, e.User, id)
+			if i > 0 {
+				assert.Greater(t, e.Elapsed, events[i-1].Elapsed, id)
+			}
+		}
+		users[events[0].User] = true
+	}
+	assert.Len(t, users, 10)
+}
+
+func TestSteppedSessions(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	run := func() map[string][]event {
+		producer.reset()
+		clock, err := state.NewClock(start, start.Add(time.Hour), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := newConfig("stepped_sessions", sessionTemplate, emitter.Ticker{Num: 2, Frequency: 10 * time.Minute})
+		cfg.Sessions = &emitter.Sessions{
+			Events:    emitter.Count{Mean: 4},
+			ThinkTime: emitter.Delay{Mean: 30 * time.Second},
+		}
+		runClock(t, clock, cfg)
+		return sessionsOf(t, "stepped_sessions")
+	}
+
+	sessions := run()
+	// 2 sessions every 10 minutes, with an event every 30 seconds
+	assert.Len(t, sessions, 10)
+	for id, events := range sessions {
+		assert.Len(t, events, 4, id)
+		for i, e := range events {
+			assert.Equal(t, int64(i)*(30*time.Second).Milliseconds(), e.Elapsed, id)
+		}
+	}
+
+	// the same seed generates the same sessions
+	again := run()
+	assert.Equal(t, keysOf(sessions), keysOf(again))
+}
+
+func keysOf(sessions map[string][]event) map[string]int {
+	keys := make(map[string]int, len(sessions))
+	for id, events := range sessions {
+		keys[id] = len(events)
+	}
+	return keys
+}
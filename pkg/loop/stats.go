@@ -0,0 +1,306 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// Report summarizes a run of the loop
+type Report struct {
+	Start            time.Time       `json:"start"`
+	End              time.Time       `json:"end"`
+	ElapsedSeconds   float64         `json:"elapsedSeconds"`
+	Objects          uint64          `json:"objects"`
+	Bytes            uint64          `json:"bytes"`
+	Errors           uint64          `json:"errors"`
+	ObjectsPerSecond float64         `json:"objectsPerSecond"`
+	BytesPerSecond   float64         `json:"bytesPerSecond"`
+	Emitters         []EmitterReport `json:"emitters"`
+}
+
+// EmitterReport summarizes the objects produced by an emitter
+type EmitterReport struct {
+	Group   string     `json:"group"`
+	Name    string     `json:"name"`
+	Objects uint64     `json:"objects"`
+	Bytes   uint64     `json:"bytes"`
+	Errors  uint64     `json:"errors"`
+	Keys    *KeyReport `json:"keys,omitempty"`
+}
+
+// KeyReport summarizes the frequencies of the keys of the objects produced by an emitter, to check
+// the skew of their distribution
+type KeyReport struct {
+	// Distinct is the number of distinct keys
+	Distinct int `json:"distinct"`
+	// Untracked counts the objects whose key was not tracked, once maxTrackedKeys distinct keys were seen
+	Untracked uint64 `json:"untracked,omitempty"`
+	// MaxToMean is the count of the most frequent key over the mean count of the keys, 1 without skew
+	MaxToMean float64 `json:"maxToMean"`
+	// TopShare is the share of the objects with one of the Top keys
+	TopShare float64 `json:"topShare"`
+	// Top are the most frequent keys, the most frequent first
+	Top []KeyFrequency `json:"top"`
+}
+
+// KeyFrequency is the count of the objects with a key, and their share of the objects of the emitter
+type KeyFrequency struct {
+	Key   string  `json:"key"`
+	Count uint64  `json:"count"`
+	Share float64 `json:"share"`
+}
+
+// maxTrackedKeys bounds the memory of the key frequencies of an emitter, i.e. with uuid keys
+const maxTrackedKeys = 100000
+
+// counters of the objects produced by an emitter
+type counters struct {
+	group   string
+	name    string
+	objects atomic.Uint64
+	bytes   atomic.Uint64
+	errors  atomic.Uint64
+	// keys counts the objects by key, if the key frequencies are reported
+	keys *keyCounts
+}
+
+func (c *counters) produced(key []byte, bytes uint64) {
+	c.objects.Add(1)
+	c.bytes.Add(bytes)
+	if c.keys != nil {
+		c.keys.add(key)
+	}
+}
+
+func (c *counters) failed() {
+	c.errors.Add(1)
+}
+
+// keyCounts counts the objects by key
+type keyCounts struct {
+	lock      sync.Mutex
+	counts    map[string]uint64
+	untracked uint64
+}
+
+func (k *keyCounts) add(key []byte) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if _, ok := k.counts[string(key)]; !ok && len(k.counts) >= maxTrackedKeys {
+		k.untracked++
+		return
+	}
+	k.counts[string(key)]++
+}
+
+// report returns the KeyReport of the top most frequent keys
+func (k *keyCounts) report(top int) *KeyReport {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	r := &KeyReport{Distinct: len(k.counts), Untracked: k.untracked, Top: make([]KeyFrequency, 0, top)}
+	var total uint64
+	frequencies := make([]KeyFrequency, 0, len(k.counts))
+	for key, count := range k.counts {
+		frequencies = append(frequencies, KeyFrequency{Key: key, Count: count})
+		total += count
+	}
+	if total == 0 {
+		return r
+	}
+	slices.SortFunc(frequencies, func(a, b KeyFrequency) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.Key, b.Key))
+	})
+	r.MaxToMean = float64(frequencies[0].Count) * float64(len(frequencies)) / float64(total)
+	total += k.untracked
+	for _, f := range frequencies[:min(top, len(frequencies))] {
+		f.Share = float64(f.Count) / float64(total)
+		r.TopShare += f.Share
+		r.Top = append(r.Top, f)
+	}
+	return r
+}
+
+// stats collects the counters of all the emitters of a run
+type stats struct {
+	start    time.Time
+	emitters []*counters
+	// topKeys is the number of most frequent keys reported for every emitter, none if 0
+	topKeys int
+}
+
+func newStats(topKeys int) *stats {
+	return &stats{start: time.Now(), topKeys: topKeys}
+}
+
+func (s *stats) newCounters(group string, name string) *counters {
+	c := &counters{group: group, name: name}
+	if s.topKeys > 0 {
+		c.keys = &keyCounts{counts: make(map[string]uint64)}
+	}
+	s.emitters = append(s.emitters, c)
+	return c
+}
+
+// report returns the current Report
+func (s *stats) report() Report {
+	r := Report{
+		Start:    s.start,
+		End:      time.Now(),
+		Emitters: make([]EmitterReport, 0, len(s.emitters)),
+	}
+	for _, c := range s.emitters {
+		er := EmitterReport{
+			Group:   c.group,
+			Name:    c.name,
+			Objects: c.objects.Load(),
+			Bytes:   c.bytes.Load(),
+			Errors:  c.errors.Load(),
+		}
+		if c.keys != nil {
+			er.Keys = c.keys.report(s.topKeys)
+		}
+		r.Objects += er.Objects
+		r.Bytes += er.Bytes
+		r.Errors += er.Errors
+		r.Emitters = append(r.Emitters, er)
+	}
+	r.ElapsedSeconds = r.End.Sub(r.Start).Seconds()
+	if r.ElapsedSeconds > 0 {
+		r.ObjectsPerSecond = float64(r.Objects) / r.ElapsedSeconds
+		r.BytesPerSecond = float64(r.Bytes) / r.ElapsedSeconds
+	}
+	return r
+}
+
+// run writes the stats to w at every interval until ctx is done.
+// The rates are computed over the last interval.
+func (s *stats) run(ctx context.Context, w io.Writer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := s.report()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := s.report()
+			seconds := current.End.Sub(last.End).Seconds()
+
+			var b strings.Builder
+			fmt.Fprintf(&b, "[%s] %d objects (%.1f/s), %s (%s/s), %d errors",
+				time.Duration(current.ElapsedSeconds*float64(time.Second)).Round(time.Second),
+				current.Objects,
+				float64(current.Objects-last.Objects)/seconds,
+				formatBytes(float64(current.Bytes)),
+				formatBytes(float64(current.Bytes-last.Bytes)/seconds),
+				current.Errors)
+			for _, e := range current.Emitters {
+				fmt.Fprintf(&b, " | %s/%s: %d objects, %s, %d errors", e.Group, e.Name, e.Objects, formatBytes(float64(e.Bytes)), e.Errors)
+			}
+			fmt.Fprintln(w, b.String())
+			last = current
+		}
+	}
+}
+
+// writeSummary writes the Report as a table
+func writeSummary(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "GROUP\tEMITTER\tOBJECTS\tBYTES\tERRORS\tOBJECTS/S\tBYTES/S\t")
+	for _, e := range r.Emitters {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%.1f\t%s\t\n",
+			e.Group, e.Name, e.Objects, formatBytes(float64(e.Bytes)), e.Errors,
+			perSecond(float64(e.Objects), r.ElapsedSeconds), formatBytes(perSecond(float64(e.Bytes), r.ElapsedSeconds)))
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d\t%s\t%d\t%.1f\t%s\t\n",
+		r.Objects, formatBytes(float64(r.Bytes)), r.Errors, r.ObjectsPerSecond, formatBytes(r.BytesPerSecond))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "elapsed %s\n", time.Duration(r.ElapsedSeconds*float64(time.Second)).Round(time.Millisecond)); err != nil {
+		return err
+	}
+	return writeKeySummary(w, r)
+}
+
+// writeKeySummary writes the most frequent keys of every emitter as a table, if they are reported
+func writeKeySummary(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := false
+	for _, e := range r.Emitters {
+		if e.Keys == nil {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(tw, "\nGROUP\tEMITTER\tKEY\tCOUNT\tSHARE\t")
+			header = true
+		}
+		for _, f := range e.Keys.Top {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.2f%%\t\n", e.Group, e.Name, f.Key, f.Count, 100*f.Share)
+		}
+		fmt.Fprintf(tw, "%s\t%s\ttop %d of %d keys, max/mean %.1f\t%d\t%.2f%%\t\n",
+			e.Group, e.Name, len(e.Keys.Top), e.Keys.Distinct, e.Keys.MaxToMean, e.Objects, 100*e.Keys.TopShare)
+	}
+	return tw.Flush()
+}
+
+// writeReport writes the Report as JSON to the file at path
+func writeReport(path string, r Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+func perSecond(v float64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return v / seconds
+}
+
+// formatBytes formats bytes with binary units, i.e. 1.5 KiB
+func formatBytes(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", b, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", b, units[i])
+}
@@ -0,0 +1,95 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+const streamTemplate = `{{integer 0 1000000}} {{uuid}} {{random_string 5 10}}`
+
+// valuesOf returns the sorted values produced by every emitter, as the workers produce them in any order
+func valuesOf() map[string][]string {
+	values := make(map[string][]string)
+	for _, rec := range producer.produced() {
+		name := rec.params["emitter.name"]
+		values[name] = append(values[name], rec.value)
+	}
+	for _, v := range values {
+		slices.Sort(v)
+	}
+	return values
+}
+
+func TestEmitterStreams(t *testing.T) {
+	defer random.SetRandom(0)
+
+	run := func(seed int64, configs ...emitter.Config) map[string][]string {
+		random.SetRandom(seed)
+		producer.reset()
+		runLoop(t, configs...)
+		return valuesOf()
+	}
+	first := newConfig("first", streamTemplate, emitter.Ticker{Num: 50})
+	second := newConfig("second", streamTemplate, emitter.Ticker{Num: 50})
+	second.Workers = 4
+
+	both := run(42, first, second)
+	assert.Len(t, both["first"], 50)
+	assert.Len(t, both["second"], 50)
+	assert.NotEqual(t, both["first"], both["second"])
+	assert.Equal(t, both, run(42, first, second))
+
+	// the values of an emitter don't depend on the other emitters
+	assert.Equal(t, both["first"], run(42, first)["first"])
+	assert.NotEqual(t, both["first"], run(43, first)["first"])
+}
+
+func TestGroupStreams(t *testing.T) {
+	random.SetRandom(42)
+	defer random.SetRandom(0)
+	producer.reset()
+
+	// emitters with the same name in different groups draw from different streams
+	emitters := orderedmap.New[string, []emitter.Config](2)
+	emitters.Set("first_group", []emitter.Config{newConfig("same_name", streamTemplate, emitter.Ticker{Num: 20})})
+	emitters.Set("second_group", []emitter.Config{newConfig("same_name", streamTemplate, emitter.Ticker{Num: 20})})
+	if err := loop.DoLoop(context.Background(), emitters, nil, PluginName, 0); err != nil {
+		t.Fatal(err)
+	}
+	values := valuesOf()["same_name"]
+	assert.Len(t, values, 40)
+	assert.Len(t, slices.Compact(values), 40)
+}
+
+func TestUnseededStreams(t *testing.T) {
+	random.SetRandom(-1)
+	defer random.SetRandom(0)
+	assert.Nil(t, random.NewStream("first"))
+}
@@ -0,0 +1,244 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/jrnd-io/jrv2/pkg/tpl"
+	"github.com/rs/zerolog/log"
+)
+
+// Configs returns the configurations of the emitters by group
+type Configs func() (map[string][]emitter.Config, error)
+
+// WithWatch reloads the templates of the running emitters when the files in the templates dirs change,
+// and their configuration, returned by configs if not nil, when one of the files at paths changes.
+// The reloaded templates are swapped in at the next tick, and the ones which don't parse are rejected,
+// keeping the current ones, as the configuration changes which need a restart, see Config.Unswappable.
+// The reloads are reported to stderr.
+func WithWatch(configs Configs, paths ...string) Option {
+	return func(o *options) {
+		o.watch = true
+		o.watchConfigs = configs
+		o.watchPaths = paths
+	}
+}
+
+// debounce is the time waited for the changes of a file to settle, as the editors write it more than once
+const debounce = 100 * time.Millisecond
+
+// watcher reloads the emitters when their templates or their configurations change
+type watcher struct {
+	emitters []watched
+	configs  Configs
+	// paths of the configuration files, templates dirs and partials dirs
+	paths    map[string]bool
+	dirs     map[string]bool
+	partials map[string]bool
+	out      io.Writer
+}
+
+// watched is an emitter with the configuration of its last reload
+type watched struct {
+	group   string
+	emitter *emitter.Emitter
+	config  emitter.Config
+}
+
+func newWatcher(configs Configs, paths []string, out io.Writer) *watcher {
+	w := &watcher{
+		configs:  configs,
+		paths:    make(map[string]bool),
+		dirs:     make(map[string]bool),
+		partials: make(map[string]bool),
+		out:      out,
+	}
+	for _, p := range paths {
+		if p != "" {
+			w.paths[filepath.Clean(p)] = true
+		}
+	}
+	for _, d := range tpl.Dirs() {
+		w.dirs[filepath.Clean(d)] = true
+	}
+	for _, d := range tpl.PartialDirs() {
+		w.partials[filepath.Clean(d)] = true
+	}
+	return w
+}
+
+// add watches em of group. It must be called before em runs.
+func (w *watcher) add(group string, em *emitter.Emitter) {
+	w.emitters = append(w.emitters, watched{group: group, emitter: em, config: *em.Config})
+}
+
+// run watches the files until ctx is done
+func (w *watcher) run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// the dirs are watched, as the editors often replace the files
+	dirs := make(map[string]bool)
+	for d := range w.dirs {
+		dirs[d] = true
+	}
+	for d := range w.partials {
+		dirs[d] = true
+	}
+	for p := range w.paths {
+		dirs[filepath.Dir(p)] = true
+	}
+	for d := range dirs {
+		if err := fw.Add(d); err != nil {
+			log.Debug().Err(err).Str("dir", d).Msg("cannot watch dir")
+		}
+	}
+
+	go func() {
+		defer fw.Close()
+		var templatesChanged, partialsChanged, configChanged bool
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case err, ok := <-fw.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("error in watching files")
+			case event, ok := <-fw.Events:
+				if !ok {
+					return
+				}
+				path := filepath.Clean(event.Name)
+				switch {
+				case w.paths[path]:
+					configChanged = true
+				case w.dirs[filepath.Dir(path)] && strings.HasSuffix(path, ".tpl"):
+					templatesChanged = true
+				case w.partials[filepath.Dir(path)] && strings.HasSuffix(path, ".tpl"):
+					partialsChanged = true
+				default:
+					continue
+				}
+				log.Debug().Str("file", event.Name).Str("op", event.Op.String()).Msg("watched file changed")
+				timer.Reset(debounce)
+			case <-timer.C:
+				w.reload(templatesChanged, partialsChanged, configChanged)
+				templatesChanged, partialsChanged, configChanged = false, false, false
+			}
+		}
+	}()
+	return nil
+}
+
+// reload compiles the templates of the emitters which changed, to be swapped in at their next tick.
+// The partials are included also by the embedded templates.
+func (w *watcher) reload(templatesChanged bool, partialsChanged bool, configChanged bool) {
+	if partialsChanged {
+		tpl.InvalidatePartials()
+	}
+	var configs map[string][]emitter.Config
+	if configChanged && w.configs != nil {
+		var err error
+		if configs, err = w.configs(); err != nil {
+			fmt.Fprintf(w.out, "configuration rejected, keeping the current one: %v\n", err)
+			configs = nil
+		}
+	}
+
+	for i := range w.emitters {
+		we := &w.emitters[i]
+		cfg := we.config
+		changed := templatesChanged && !cfg.Embedded || partialsChanged
+		for _, c := range configs[we.group] {
+			c.Group = we.group
+			if c.Name != cfg.Name || reflect.DeepEqual(c, cfg) {
+				continue
+			}
+			if settings := cfg.Unswappable(c); len(settings) > 0 {
+				fmt.Fprintf(w.out, "configuration of emitter %s rejected, restart it to change %s\n", cfg.Name, strings.Join(settings, ", "))
+				continue
+			}
+			cfg = c
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := we.emitter.Reload(cfg); err != nil {
+			fmt.Fprintf(w.out, "templates rejected, keeping the current ones: %v\n", err)
+			continue
+		}
+		we.config = cfg
+		fmt.Fprintf(w.out, "emitter %s reloaded\n", cfg.Name)
+	}
+}
+
+// swapTemplates swaps in the templates reloaded while the emitter runs, rebuilding the lifecycle, the chaos
+// and the state outputs of the emitter if their configuration changed
+func (r *runner) swapTemplates(ctx context.Context) error {
+	e := r.emitter
+	scenario, sessions, chaos := e.Config.Scenario, e.Config.Sessions, e.Config.Chaos
+	if !e.SwapTemplates() {
+		return nil
+	}
+	log.Debug().Str("emitter", e.Config.Name).Msg("reloaded templates swapped in")
+
+	// the entities waiting for a transition are dropped only switching between a Scenario and Sessions
+	if (scenario == nil) != (e.Config.Scenario == nil) || (sessions == nil) != (e.Config.Sessions == nil) {
+		r.lifecycle = newLifecycle(e)
+	}
+	if !reflect.DeepEqual(chaos, e.Config.Chaos) {
+		r.chaos = newChaos(e, state.GetSharedState().Execution.Now())
+	}
+	if reflect.DeepEqual(scenario, e.Config.Scenario) {
+		return nil
+	}
+	stateOutputs, err := r.outputs.stateOutputs(e)
+	if err != nil {
+		return fmt.Errorf("emitter %s: %w", e.Config.Name, err)
+	}
+	for name, p := range stateOutputs {
+		if r.stateOutputs[name] == p {
+			continue
+		}
+		if err := p.Configure(ctx, r.stateParameters(name)); err != nil {
+			return fmt.Errorf("error in configuring output of state %s of emitter %s: %w", name, e.Config.Name, err)
+		}
+	}
+	r.stateOutputs = stateOutputs
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/config"
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/tpl"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// watchLoop runs cfg with the watch option, calling change while it runs, and returns the produced values
+func watchLoop(t *testing.T, cfg emitter.Config, change func(), options ...loop.Option) []string {
+	t.Helper()
+	producer.reset()
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("watch", []emitter.Config{cfg})
+	done := make(chan error)
+	go func() {
+		done <- loop.DoLoop(context.Background(), emitters, nil, PluginName, 0, options...)
+	}()
+	change()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for _, rec := range producer.produced() {
+		values = append(values, rec.value)
+	}
+	return values
+}
+
+// compacted returns values without the consecutive duplicates
+func compacted(values []string) []string {
+	var c []string
+	for _, v := range values {
+		if len(c) == 0 || c[len(c)-1] != v {
+			c = append(c, v)
+		}
+	}
+	return c
+}
+
+func write(t *testing.T, path string, text string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchTemplates(t *testing.T) {
+	userDir := config.JrUserDir
+	defer func() { config.JrUserDir = userDir }()
+	config.JrUserDir = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(config.JrUserDir, "templates"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(config.JrUserDir, "templates", "watched.tpl")
+	write(t, path, "v1")
+
+	cfg := newConfig("watched", "watched", emitter.Ticker{Num: 1, Frequency: 20 * time.Millisecond, Duration: 1500 * time.Millisecond})
+	cfg.Embedded = false
+	values := watchLoop(t, cfg, func() {
+		time.Sleep(400 * time.Millisecond)
+		write(t, path, "v2")
+		time.Sleep(400 * time.Millisecond)
+		// the templates which don't parse are rejected
+		write(t, path, "{{v3")
+	}, loop.WithWatch(nil))
+
+	assert.Equal(t, []string{"v1", "v2"}, compacted(values))
+}
+
+func TestWatchPartials(t *testing.T) {
+	userDir := config.JrUserDir
+	defer func() { config.JrUserDir = userDir }()
+	config.JrUserDir = t.TempDir()
+	dir := filepath.Join(config.JrUserDir, "templates", tpl.PartialsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "greeting.tpl")
+	write(t, path, "p1")
+
+	// the embedded templates are reloaded too when a partial changes
+	cfg := newConfig("partial", `{{template "greeting" .}}`, emitter.Ticker{Num: 1, Frequency: 20 * time.Millisecond, Duration: time.Second})
+	values := watchLoop(t, cfg, func() {
+		time.Sleep(400 * time.Millisecond)
+		write(t, path, "p2")
+	}, loop.WithWatch(nil))
+
+	assert.Equal(t, []string{"p1", "p2"}, compacted(values))
+}
+
+func TestWatchConfigs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jrconfig.json")
+	write(t, path, "{}")
+
+	cfg := newConfig("configured", "c1", emitter.Ticker{Num: 1, Frequency: 20 * time.Millisecond, Duration: time.Second})
+	reloaded := cfg
+	reloaded.ValueTemplate = "c2"
+	configs := func() (map[string][]emitter.Config, error) {
+		return map[string][]emitter.Config{"watch": {reloaded}}, nil
+	}
+	values := watchLoop(t, cfg, func() {
+		time.Sleep(400 * time.Millisecond)
+		write(t, path, `{"changed": true}`)
+	}, loop.WithWatch(configs, path))
+
+	assert.Equal(t, []string{"c1", "c2"}, compacted(values))
+}
+
+func TestWatchRejectedConfigs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jrconfig.json")
+	write(t, path, "{}")
+
+	cfg := newConfig("rejected", "c1", emitter.Ticker{Num: 1, Frequency: 20 * time.Millisecond, Duration: time.Second})
+	reloaded := cfg
+	reloaded.ValueTemplate = "c2"
+	reloaded.Workers = 2
+	configs := func() (map[string][]emitter.Config, error) {
+		return map[string][]emitter.Config{"watch": {reloaded}}, nil
+	}
+	values := watchLoop(t, cfg, func() {
+		time.Sleep(400 * time.Millisecond)
+		write(t, path, `{"changed": true}`)
+	}, loop.WithWatch(configs, path))
+
+	// the workers can't be changed while the emitter runs, so the whole configuration is kept
+	assert.Equal(t, []string{"c1"}, compacted(values))
+}
+
+func TestWatchStateOutputs(t *testing.T) {
+	lifecycle.reset()
+	path := filepath.Join(t.TempDir(), "jrconfig.json")
+	write(t, path, "{}")
+
+	cfg := newConfig("shipping", `{"id": 1}`, emitter.Ticker{Num: 1, Frequency: 20 * time.Millisecond, Duration: time.Second})
+	cfg.Scenario = &emitter.Scenario{
+		Initial: "created",
+		States: map[string]*emitter.ScenarioState{
+			"created": {Transitions: []emitter.Transition{{To: "shipped", Probability: 1, Delay: emitter.Delay{Mean: time.Millisecond}}}},
+			"shipped": {ValueTemplate: `{"status": "shipped"}`},
+		},
+	}
+	reloaded := cfg
+	reloaded.Scenario = &emitter.Scenario{
+		Initial: "created",
+		States: map[string]*emitter.ScenarioState{
+			"created": {Transitions: []emitter.Transition{{To: "shipped", Probability: 1, Delay: emitter.Delay{Mean: time.Millisecond}}}},
+			"shipped": {ValueTemplate: `{"status": "shipped"}`, Output: LifecyclePluginName},
+		},
+	}
+	configs := func() (map[string][]emitter.Config, error) {
+		return map[string][]emitter.Config{"watch": {reloaded}}, nil
+	}
+
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("watch", []emitter.Config{cfg})
+	done := make(chan error)
+	go func() {
+		done <- loop.DoLoop(context.Background(), emitters, nil, "", 0, loop.WithWatch(configs, path))
+	}()
+	time.Sleep(400 * time.Millisecond)
+	write(t, path, `{"changed": true}`)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the output of the state added by the reload is configured before the state produces to it
+	assert.Contains(t, lifecycle.configured, "shipping.shipped")
+	assert.NotEmpty(t, lifecycle.produced())
+}
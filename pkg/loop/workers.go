@@ -0,0 +1,167 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// doParallel generates and produces num objects with Config.Workers goroutines.
+// Without a seed and ordering, every worker generates and produces its own objects.
+// Otherwise the objects are generated in order, by the workers or sequentially with a seed to
+// keep them reproducible, their anomalies are injected in the same order, then they are produced
+// by the workers: with Config.Ordered, the objects with the same key are always produced by the
+// same worker.
+func (r *runner) doParallel(ctx context.Context, num int, limits rateLimits) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the first error stopping the emitter stops all the workers
+	var stopErr error
+	var stopOnce sync.Once
+	emit := func(e emission) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.emit(ctx, e, limits); err != nil {
+			stopOnce.Do(func() {
+				stopErr = err
+				cancel()
+			})
+		}
+	}
+
+	workers := r.emitter.Config.Workers
+	seeded := r.emitter.Random != nil
+	tickets := r.tickets(ctx, num, limits)
+
+	var wg sync.WaitGroup
+	if !seeded && !r.emitter.Config.Ordered {
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range tickets {
+					emit(r.prepare(r.generate()))
+				}
+			}()
+		}
+		wg.Wait()
+		return stopErr
+	}
+
+	lanes := make([]chan emission, workers)
+	for i := range lanes {
+		lanes[i] = make(chan emission, workers)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range lanes[i] {
+				emit(e)
+			}
+		}()
+	}
+
+	i := 0
+	for obj := range r.generateInOrder(tickets, workers, seeded) {
+		lane := i % workers
+		if r.emitter.Config.Ordered {
+			lane = laneOf(obj.key, workers)
+		}
+		lanes[lane] <- r.prepare(obj)
+		i++
+	}
+	for _, lane := range lanes {
+		close(lane)
+	}
+	wg.Wait()
+	return stopErr
+}
+
+// tickets sends one ticket for each of the num objects to generate, waiting limits before each of them
+func (r *runner) tickets(ctx context.Context, num int, limits rateLimits) <-chan struct{} {
+	tickets := make(chan struct{})
+	go func() {
+		defer close(tickets)
+		for range num {
+			if ctx.Err() != nil || limits.wait(ctx) != nil {
+				return
+			}
+			select {
+			case tickets <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return tickets
+}
+
+// generateInOrder generates an object for every ticket, returning them in the order of the tickets.
+// The objects are generated by the workers, or sequentially if seeded.
+func (r *runner) generateInOrder(tickets <-chan struct{}, workers int, seeded bool) <-chan object {
+	objects := make(chan object, workers)
+	if seeded {
+		go func() {
+			defer close(objects)
+			for range tickets {
+				objects <- r.generate()
+			}
+		}()
+		return objects
+	}
+
+	// every pending object has its own channel, queued in the order of the tickets
+	jobs := make(chan chan object, workers)
+	pending := make(chan chan object, workers)
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		for range tickets {
+			job := make(chan object, 1)
+			pending <- job
+			jobs <- job
+		}
+	}()
+	for range workers {
+		go func() {
+			for job := range jobs {
+				job <- r.generate()
+			}
+		}()
+	}
+	go func() {
+		defer close(objects)
+		for job := range pending {
+			objects <- <-job
+		}
+	}()
+	return objects
+}
+
+// laneOf returns the worker producing the objects with key
+func laneOf(key []byte, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(workers)) //nolint workers is positive
+}
@@ -0,0 +1,126 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loop_test
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+// orderedTemplate generates increasing values, with keys from 0 to 3
+const orderedTemplate = `{{$c := counter "workers" 0 1}}{{.SetKey (itoa (mod $c 4))}}{{$c}}`
+
+func newWorkersConfig(name string, valueTemplate string, num int, ordered bool) emitter.Config {
+	cfg := newConfig(name, valueTemplate, emitter.Ticker{Num: num})
+	cfg.Workers = 8
+	cfg.Ordered = ordered
+	return cfg
+}
+
+// assertOrdered checks that the values of every key are produced in increasing order
+func assertOrdered(t *testing.T, name string) {
+	t.Helper()
+	last := make(map[string]int)
+	for _, rec := range producer.produced() {
+		if rec.params["emitter.name"] != name {
+			continue
+		}
+		v, err := strconv.Atoi(rec.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous, ok := last[rec.key]; ok {
+			assert.Greater(t, v, previous, "key %s", rec.key)
+		}
+		last[rec.key] = v
+	}
+	assert.Len(t, last, 4)
+}
+
+func TestWorkers(t *testing.T) {
+	random.SetRandom(-1)
+	defer random.SetRandom(0)
+
+	t.Run("unordered", func(t *testing.T) {
+		producer.reset()
+		runLoop(t, newWorkersConfig("unordered", "{{integer 0 100}}", 500, false))
+		assert.Equal(t, 500, producer.count("unordered"))
+	})
+
+	t.Run("ordered", func(t *testing.T) {
+		producer.reset()
+		runLoop(t, newWorkersConfig("ordered", "{{integer 0 100}}", 500, true))
+		assert.Equal(t, 500, producer.count("ordered"))
+	})
+}
+
+func TestSeededWorkers(t *testing.T) {
+	defer random.SetRandom(0)
+
+	values := func() []string {
+		random.SetRandom(42)
+		producer.reset()
+		runLoop(t, newWorkersConfig("seeded", "{{integer 0 1000000}}", 200, false))
+		var values []string
+		for _, rec := range producer.produced() {
+			values = append(values, rec.value)
+		}
+		slices.Sort(values)
+		return values
+	}
+	first := values()
+	assert.Len(t, first, 200)
+	assert.Equal(t, first, values())
+
+	producer.reset()
+	runLoop(t, newWorkersConfig("keys", orderedTemplate, 400, true))
+	assert.Equal(t, 400, producer.count("keys"))
+	assertOrdered(t, "keys")
+}
+
+func TestSeededWorkersAnomalies(t *testing.T) {
+	defer random.SetRandom(0)
+
+	// the workers produce the objects in any order, but the anomalies of every object are the same
+	values := func() []string {
+		random.SetRandom(42)
+		producer.reset()
+		cfg := newWorkersConfig("seeded_anomalies", `{"id": {{integer 0 1000000}}, "name": "abc", "price": 1.5}`, 300, false)
+		cfg.Chaos = &emitter.Chaos{DropField: 0.2, Null: 0.2, Truncate: 0.1}
+		cfg.Disorder = &emitter.Disorder{Duplicate: 0.1, NearDuplicate: 0.1}
+		runLoop(t, cfg)
+		var values []string
+		for _, rec := range producer.produced() {
+			values = append(values, rec.headers[loop.AnomalyHeader]+" "+rec.value)
+		}
+		slices.Sort(values)
+		return values
+	}
+	first := values()
+	assert.Greater(t, len(first), 300)
+	assert.Equal(t, first, values())
+}
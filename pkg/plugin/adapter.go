@@ -24,23 +24,98 @@ import (
 	"context"
 
 	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/rs/zerolog/log"
 )
 
+// BatchClient is implemented by the clients of the plugins which can produce many objects with a single call
+type BatchClient interface {
+	Capabilities() *jrpc.CapabilitiesResponse
+	jrpc.BatchProducer
+}
+
 type Adapter struct {
 	plugin jrpc.Producer
 	Producer
+	// batcher groups the objects for the plugins supporting it, nil otherwise
+	batcher *batcher
 }
 
-func NewAdapter(jrpcProducer jrpc.Producer) *Adapter {
-	return &Adapter{
+// NewAdapter adapts a jrpc.Producer to a Producer. If batching is enabled and the plugin
+// supports it, the objects are grouped and produced with a single call, otherwise one by one.
+func NewAdapter(jrpcProducer jrpc.Producer, batching Batching) *Adapter {
+	a := &Adapter{
 		plugin: jrpcProducer,
 	}
+	if !batching.Enabled() {
+		return a
+	}
+	client, ok := jrpcProducer.(BatchClient)
+	if !ok {
+		return a
+	}
+	capabilities := client.Capabilities()
+	if !capabilities.Batch && !capabilities.Stream {
+		log.Debug().Msg("plugin does not support batches, producing objects one by one")
+		return a
+	}
+	log.Debug().
+		Int("size", batching.Size).
+		Dur("linger", batching.Linger).
+		Bool("batch", capabilities.Batch).
+		Bool("stream", capabilities.Stream).
+		Msg("producing objects in batches")
+	a.batcher = newBatcher(client, batching)
+	return a
 }
 
-func (a *Adapter) Produce(_ context.Context,
+func (a *Adapter) Produce(ctx context.Context,
 	key []byte,
 	v []byte,
 	headers map[string]string,
 	configParams map[string]string) (*jrpc.ProduceResponse, error) {
+	if a.batcher != nil {
+		return a.batcher.produce(ctx, &jrpc.ProduceRequest{Key: key, Value: v, Headers: headers, ConfigParams: configParams})
+	}
 	return a.plugin.Produce(key, v, headers, configParams)
 }
+
+// AddCallers declares n more goroutines producing to the plugin, or -n less, so that the batches don't
+// wait the linger time with a single one
+func (a *Adapter) AddCallers(n int) {
+	if a.batcher != nil {
+		a.batcher.callers.Add(int64(n))
+	}
+}
+
+func (a *Adapter) Configure(_ context.Context, configParams map[string]string, config []byte) error {
+	if lc, ok := a.plugin.(jrpc.Lifecycle); ok {
+		return lc.Configure(configParams, config)
+	}
+	return nil
+}
+
+func (a *Adapter) HealthCheck(_ context.Context) error {
+	if lc, ok := a.plugin.(jrpc.Lifecycle); ok {
+		return lc.HealthCheck()
+	}
+	return nil
+}
+
+// Flush waits for the objects of the emitter in configParams produced so far to be written by the plugin
+func (a *Adapter) Flush(_ context.Context, configParams map[string]string) error {
+	if lc, ok := a.plugin.(jrpc.Lifecycle); ok {
+		return lc.Flush(configParams)
+	}
+	return nil
+}
+
+// Close produces the pending objects, then lets the plugin drain its buffers before exiting
+func (a *Adapter) Close(_ context.Context) error {
+	if a.batcher != nil {
+		a.batcher.close()
+	}
+	if lc, ok := a.plugin.(jrpc.Lifecycle); ok {
+		return lc.Close()
+	}
+	return nil
+}
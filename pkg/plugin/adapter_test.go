@@ -0,0 +1,135 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchClient counts the calls, failing the objects with value "bad"
+type batchClient struct {
+	capabilities *jrpc.CapabilitiesResponse
+	calls        atomic.Int64
+	batches      atomic.Int64
+	largest      atomic.Int64
+}
+
+func (c *batchClient) Produce(_ []byte, value []byte, _ map[string]string, _ map[string]string) (*jrpc.ProduceResponse, error) {
+	c.calls.Add(1)
+	return &jrpc.ProduceResponse{Bytes: uint64(len(value))}, nil
+}
+
+func (c *batchClient) Capabilities() *jrpc.CapabilitiesResponse {
+	return c.capabilities
+}
+
+func (c *batchClient) ProduceBatch(requests []*jrpc.ProduceRequest) ([]*jrpc.ProduceResponse, error) {
+	c.batches.Add(1)
+	if n := int64(len(requests)); n > c.largest.Load() {
+		c.largest.Store(n)
+	}
+	responses := make([]*jrpc.ProduceResponse, len(requests))
+	for i, req := range requests {
+		responses[i] = &jrpc.ProduceResponse{Bytes: uint64(len(req.Value))}
+		if string(req.Value) == "bad" {
+			responses[i] = &jrpc.ProduceResponse{Error: "bad value"}
+		}
+	}
+	return responses, nil
+}
+
+// produceConcurrently produces n objects from n goroutines, returning the number of errors
+func produceConcurrently(a *plugin.Adapter, n int, value string) int64 {
+	var errs atomic.Int64
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.Produce(context.Background(), nil, []byte(value), nil, nil); err != nil {
+				errs.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return errs.Load()
+}
+
+func TestAdapterBatching(t *testing.T) {
+	client := &batchClient{capabilities: &jrpc.CapabilitiesResponse{Batch: true}}
+	a := plugin.NewAdapter(client, plugin.Batching{Size: 10, Linger: 50 * time.Millisecond})
+	defer func() { _ = a.Close(context.Background()) }()
+
+	assert.Equal(t, int64(0), produceConcurrently(a, 100, "value"))
+	assert.Equal(t, int64(0), client.calls.Load())
+	assert.Equal(t, int64(10), client.largest.Load())
+	assert.LessOrEqual(t, client.batches.Load(), int64(20))
+
+	resp, err := a.Produce(context.Background(), nil, []byte("value"), nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), resp.Bytes)
+
+	assert.Equal(t, int64(5), produceConcurrently(a, 5, "bad"))
+}
+
+func TestAdapterSequentialLinger(t *testing.T) {
+	client := &batchClient{capabilities: &jrpc.CapabilitiesResponse{Batch: true}}
+	linger := 500 * time.Millisecond
+	a := plugin.NewAdapter(client, plugin.Batching{Size: 10, Linger: linger})
+	defer func() { _ = a.Close(context.Background()) }()
+	a.AddCallers(1)
+
+	// a single caller never waits linger, as no other object can be added to its batch
+	start := time.Now()
+	for range 20 {
+		_, err := a.Produce(context.Background(), nil, []byte("value"), nil, nil)
+		assert.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), linger)
+	assert.Equal(t, int64(20), client.batches.Load())
+}
+
+func TestAdapterFallback(t *testing.T) {
+	client := &batchClient{capabilities: &jrpc.CapabilitiesResponse{}}
+	a := plugin.NewAdapter(client, plugin.Batching{Size: 10})
+
+	assert.Equal(t, int64(0), produceConcurrently(a, 20, "value"))
+	assert.Equal(t, int64(20), client.calls.Load())
+	assert.Equal(t, int64(0), client.batches.Load())
+}
+
+func TestAdapterClose(t *testing.T) {
+	client := &batchClient{capabilities: &jrpc.CapabilitiesResponse{Stream: true}}
+	a := plugin.NewAdapter(client, plugin.Batching{Size: 10})
+	assert.NoError(t, a.Close(context.Background()))
+
+	_, err := a.Produce(context.Background(), nil, []byte("value"), nil, nil)
+	assert.True(t, errors.Is(err, plugin.ErrClosed))
+}
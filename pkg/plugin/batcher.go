@@ -0,0 +1,195 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrClosed is returned when producing to a closed plugin
+var ErrClosed = errors.New("plugin closed")
+
+// Batching groups the objects produced to a remote plugin: a batch is sent when it has Size objects
+// or Linger is elapsed since its first object. With no Linger, a batch is sent as soon as no other
+// objects are waiting, so only the objects produced concurrently are grouped.
+// Linger is not waited while a single caller is declared producing one object after the other, as no other
+// object may be added to its batch, see Adapter.AddCallers.
+type Batching struct {
+	Size   int
+	Linger time.Duration
+}
+
+func (b Batching) Enabled() bool {
+	return b.Size > 1
+}
+
+// pending is an object waiting for its batch to be produced
+type pending struct {
+	request *jrpc.ProduceRequest
+	done    chan result
+}
+
+type result struct {
+	response *jrpc.ProduceResponse
+	err      error
+}
+
+// batcher groups the objects produced concurrently and sends them with a single call
+type batcher struct {
+	producer jrpc.BatchProducer
+	batching Batching
+	pending  chan *pending
+	// callers are the goroutines declared producing, 0 if unknown
+	callers atomic.Int64
+	warned  sync.Once
+	// closed is closed to stop the batcher, stopped when it is stopped
+	closed  chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newBatcher(producer jrpc.BatchProducer, batching Batching) *batcher {
+	b := &batcher{
+		producer: producer,
+		batching: batching,
+		pending:  make(chan *pending, batching.Size),
+		closed:   make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// produce adds the request to the next batch, waiting for its response
+func (b *batcher) produce(ctx context.Context, request *jrpc.ProduceRequest) (*jrpc.ProduceResponse, error) {
+	p := &pending{request: request, done: make(chan result, 1)}
+	select {
+	case b.pending <- p:
+	case <-b.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case r := <-p.done:
+		return r.response, r.err
+	case <-b.stopped:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.stopped)
+	for {
+		select {
+		case first := <-b.pending:
+			b.send(b.fill([]*pending{first}))
+		case <-b.closed:
+			// producing the objects added before closing
+			for {
+				select {
+				case first := <-b.pending:
+					b.send(b.fill([]*pending{first}))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// fill adds the waiting objects to batch, until it is full or the linger time is elapsed
+func (b *batcher) fill(batch []*pending) []*pending {
+	var linger <-chan time.Time
+	if b.batching.Linger > 0 {
+		timer := time.NewTimer(b.batching.Linger)
+		defer timer.Stop()
+		linger = timer.C
+	}
+
+	for len(batch) < b.batching.Size {
+		if linger == nil {
+			select {
+			case p := <-b.pending:
+				batch = append(batch, p)
+			default:
+				return batch
+			}
+			continue
+		}
+		if b.callers.Load() == 1 {
+			b.warned.Do(func() {
+				log.Warn().
+					Dur("linger", b.batching.Linger).
+					Msg("a single caller is producing, ignoring linger: run more workers to produce batches")
+			})
+			return batch
+		}
+		select {
+		case p := <-b.pending:
+			batch = append(batch, p)
+		case <-linger:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (b *batcher) send(batch []*pending) {
+	requests := make([]*jrpc.ProduceRequest, len(batch))
+	for i, p := range batch {
+		requests[i] = p.request
+	}
+
+	responses, err := b.producer.ProduceBatch(requests)
+	if err == nil && len(responses) != len(batch) {
+		err = fmt.Errorf("%d responses received for a batch of %d objects", len(responses), len(batch))
+	}
+	for i, p := range batch {
+		switch {
+		case err != nil:
+			p.done <- result{err: err}
+		case responses[i].Error != "":
+			p.done <- result{err: errors.New(responses[i].Error)}
+		default:
+			p.done <- result{response: responses[i]}
+		}
+	}
+}
+
+// close stops the batcher after producing the pending objects
+func (b *batcher) close() {
+	b.once.Do(func() {
+		close(b.closed)
+	})
+	<-b.stopped
+}
@@ -53,6 +53,19 @@ func (p *Producer) Produce(_ context.Context, _ []byte, v []byte, _ map[string]s
 
 }
 
+func (p *Producer) Configure(_ context.Context, _ map[string]string, _ []byte) error {
+	return nil
+}
+
+func (p *Producer) HealthCheck(_ context.Context) error {
+	return nil
+}
+
+// Flush does nothing, the objects are written to stdout unbuffered
+func (p *Producer) Flush(_ context.Context, _ map[string]string) error {
+	return nil
+}
+
 func (p *Producer) Close(_ context.Context) error {
 	return nil
 }
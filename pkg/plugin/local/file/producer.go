@@ -20,12 +20,16 @@
 package console
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
+
 	"github.com/jrnd-io/jrv2/pkg/jrpc"
 	"github.com/jrnd-io/jrv2/pkg/plugin"
 	"github.com/rs/zerolog/log"
-	"os"
 )
 
 const (
@@ -42,34 +46,46 @@ func init() {
 	})
 }
 
+// Producer writes the objects of every emitter to its own file, keeping it open and buffered
+// until the producer is closed. A closed producer opens the files again only when it is configured.
 type Producer struct {
+	files  map[string]*file
+	closed bool
+	lock   sync.Mutex
 }
 
-func (p *Producer) Produce(_ context.Context, _ []byte, v []byte, _ map[string]string, configParams map[string]string) (*jrpc.ProduceResponse, error) {
+type file struct {
+	path   string
+	f      *os.File
+	writer *bufio.Writer
+}
 
-	outputDir := "."
-	if configParams[OutputDir] != "" {
-		outputDir = configParams[OutputDir]
-	}
+// Configure opens the file of the emitter
+func (p *Producer) Configure(_ context.Context, configParams map[string]string, _ []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 
-	fileName := configParams["emitter.name"]
-	if configParams[FileName] != "" {
-		fileName = configParams[FileName]
-	}
+	p.closed = false
+	_, err := p.fileFor(configParams)
+	return err
+}
 
-	filePath := fmt.Sprintf("%s%c%s", outputDir, os.PathSeparator, fileName)
-	log.Debug().Str("file", filePath).Msg("writing to file")
-	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+func (p *Producer) Produce(_ context.Context, _ []byte, v []byte, _ map[string]string, configParams map[string]string) (*jrpc.ProduceResponse, error) {
+
+	// the file can't be closed between its lookup and the write
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return nil, plugin.ErrClosed
+	}
+	f, err := p.fileFor(configParams)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		_ = f.Close()
-	}()
 
-	nWritten, err := f.Write(v)
+	nWritten, err := f.writer.Write(v)
 	if err != nil {
-		log.Warn().Str("file", fileName).Err(err).Msg("failed to write to file")
+		log.Warn().Str("file", f.path).Err(err).Msg("failed to write to file")
 	}
 
 	return &jrpc.ProduceResponse{
@@ -79,6 +95,79 @@ func (p *Producer) Produce(_ context.Context, _ []byte, v []byte, _ map[string]s
 
 }
 
+// HealthCheck checks that all the files are still there
+func (p *Producer) HealthCheck(_ context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var errs []error
+	for _, f := range p.files {
+		if _, err := f.f.Stat(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush writes the buffered objects to the file of the emitter
+func (p *Producer) Flush(_ context.Context, configParams map[string]string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	f, ok := p.files[filePath(configParams)]
+	if !ok {
+		return nil
+	}
+	return f.writer.Flush()
+}
+
+// Close writes the buffered objects and closes the files
 func (p *Producer) Close(_ context.Context) error {
-	return nil
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var errs []error
+	for _, f := range p.files {
+		log.Debug().Str("file", f.path).Msg("closing file")
+		errs = append(errs, f.writer.Flush(), f.f.Close())
+	}
+	p.files = nil
+	p.closed = true
+	return errors.Join(errs...)
+}
+
+// fileFor returns the file of the emitter in configParams, opening it if needed.
+// p.lock must be held.
+func (p *Producer) fileFor(configParams map[string]string) (*file, error) {
+	filePath := filePath(configParams)
+
+	if f, ok := p.files[filePath]; ok {
+		return f, nil
+	}
+
+	log.Debug().Str("file", filePath).Msg("opening file")
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if p.files == nil {
+		p.files = make(map[string]*file)
+	}
+	p.files[filePath] = &file{path: filePath, f: f, writer: bufio.NewWriter(f)}
+	return p.files[filePath], nil
+}
+
+// filePath returns the path of the file of the emitter in configParams
+func filePath(configParams map[string]string) string {
+	outputDir := "."
+	if configParams[OutputDir] != "" {
+		outputDir = configParams[OutputDir]
+	}
+
+	fileName := configParams["emitter.name"]
+	if configParams[FileName] != "" {
+		fileName = configParams[FileName]
+	}
+
+	return fmt.Sprintf("%s%c%s", outputDir, os.PathSeparator, fileName)
 }
@@ -0,0 +1,81 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package console_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/plugin"
+	file "github.com/jrnd-io/jrv2/pkg/plugin/local/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	params := map[string]string{"emitter.name": "lifecycle", file.OutputDir: dir}
+	path := filepath.Join(dir, "lifecycle")
+	p := &file.Producer{}
+
+	assert.NoError(t, p.Configure(ctx, params, nil))
+	assert.FileExists(t, path)
+
+	for _, v := range []string{"one\n", "two\n"} {
+		resp, err := p.Produce(ctx, nil, []byte(v), nil, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(len(v)), resp.Bytes)
+	}
+	assert.NoError(t, p.HealthCheck(ctx))
+
+	assert.NoError(t, p.Flush(ctx, params))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "one\ntwo\n", string(data))
+
+	_, err = p.Produce(ctx, nil, []byte("three\n"), nil, params)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close(ctx))
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "one\ntwo\nthree\n", string(data))
+
+	// a closed producer doesn't open the file again until it is configured
+	_, err = p.Produce(ctx, nil, []byte("four\n"), nil, params)
+	assert.ErrorIs(t, err, plugin.ErrClosed)
+	assert.NoError(t, p.Configure(ctx, params, nil))
+	_, err = p.Produce(ctx, nil, []byte("four\n"), nil, params)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close(ctx))
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "one\ntwo\nthree\nfour\n", string(data))
+}
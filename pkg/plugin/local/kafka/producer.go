@@ -24,12 +24,14 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/jrnd-io/jrv2/pkg/jrpc"
-	"github.com/jrnd-io/jrv2/pkg/plugin"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -37,6 +39,9 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde/avrov2"
 	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry/serde/jsonschema"
+	"github.com/jrnd-io/jrv2/pkg/config"
+	"github.com/jrnd-io/jrv2/pkg/jrpc"
+	"github.com/jrnd-io/jrv2/pkg/plugin"
 	"github.com/jrnd-io/jrv2/pkg/types"
 
 	"github.com/rs/zerolog/log"
@@ -44,6 +49,20 @@ import (
 
 const (
 	PluginName = "kafka"
+
+	// configuration parameters read from the emitter configParams
+	KafkaConfig    = "kafkaConfig"
+	RegistryConfig = "registryConfig"
+	SchemaRegistry = "schemaRegistry"
+	Serializer     = "serializer"
+	TemplateType   = "templateType"
+	Topic          = "topic"
+	AutoCreate     = "autoCreate"
+	EmitterName    = "emitter.name"
+	EmitterGroup   = "emitter.group"
+
+	flushTimeoutMs       = 15 * 1000
+	healthCheckTimeoutMs = 5 * 1000
 )
 
 func init() {
@@ -54,52 +73,201 @@ func init() {
 	})
 }
 
+// Producer keeps a Manager for every emitter writing to Kafka, by group and name,
+// creating it on the first Produce call from the emitter configParams.
 type Producer struct {
+	managers map[string]*Manager
+	lock     sync.Mutex
 }
 
-func (p *Producer) Produce(_ context.Context, _ []byte, v []byte, _ map[string]string, _ map[string]string) (*jrpc.ProduceResponse, error) {
+func (p *Producer) Produce(ctx context.Context, key []byte, v []byte, headers map[string]string, configParams map[string]string) (*jrpc.ProduceResponse, error) {
 
-	writtenBytes := len(v)
-	fmt.Println(string(v))
+	k, err := p.managerFor(ctx, configParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = k.Produce(ctx, key, v, headers); err != nil {
+		return nil, err
+	}
 	return &jrpc.ProduceResponse{
-		Bytes:   uint64(writtenBytes),
+		Bytes:   uint64(len(v)),
 		Message: "",
 	}, nil
 
 }
 
-func (p *Producer) Close(_ context.Context) error {
+// Configure creates the Manager of the emitter, failing early if Kafka can't be configured
+func (p *Producer) Configure(ctx context.Context, configParams map[string]string, _ []byte) error {
+	_, err := p.managerFor(ctx, configParams)
+	return err
+}
+
+// HealthCheck checks that the brokers of every emitter are reachable.
+// The brokers are called without holding the lock, so that Produce isn't blocked.
+func (p *Producer) HealthCheck(_ context.Context) error {
+	p.lock.Lock()
+	managers := make(map[string]*Manager, len(p.managers))
+	for name, k := range p.managers {
+		managers[name] = k
+	}
+	p.lock.Unlock()
+
+	var errs []error
+	for name, k := range managers {
+		if _, err := k.admin.GetMetadata(&k.Topic, false, healthCheckTimeoutMs); err != nil {
+			errs = append(errs, fmt.Errorf("emitter %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush waits for the delivery of the messages of the emitter in configParams
+func (p *Producer) Flush(_ context.Context, configParams map[string]string) error {
+	name := emitterID(configParams)
+	p.lock.Lock()
+	k, ok := p.managers[name]
+	p.lock.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if remaining := k.producer.Flush(flushTimeoutMs); remaining > 0 {
+		return fmt.Errorf("emitter %s: %d messages still in flight after flush", name, remaining)
+	}
 	return nil
 }
 
+func (p *Producer) Close(ctx context.Context) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var errs []error
+	for name, k := range p.managers {
+		log.Debug().Str("emitter", name).Str("topic", k.Topic).Msg("closing kafka manager")
+		errs = append(errs, k.Close(ctx))
+	}
+	p.managers = nil
+	return errors.Join(errs...)
+}
+
+func (p *Producer) managerFor(ctx context.Context, configParams map[string]string) (*Manager, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	name := emitterID(configParams)
+	if k, ok := p.managers[name]; ok {
+		return k, nil
+	}
+
+	k, err := NewManager(ctx, configParams)
+	if err != nil {
+		return nil, err
+	}
+	if p.managers == nil {
+		p.managers = make(map[string]*Manager)
+	}
+	p.managers[name] = k
+	return k, nil
+}
+
+// emitterID returns the name of the emitter in configParams qualified by its group, if any
+func emitterID(configParams map[string]string) string {
+	if group := configParams[EmitterGroup]; group != "" {
+		return group + "/" + configParams[EmitterName]
+	}
+	return configParams[EmitterName]
+}
+
 type Manager struct {
 	producer       *kafka.Producer
 	admin          *kafka.AdminClient
 	schema         schemaregistry.Client
+	serializer     serde.Serializer
 	schemaRegistry bool
 	Topic          string
 	Serializer     string
 	TemplateType   string
 	fleEnabled     bool
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	events    sync.WaitGroup
 }
 
-func (k *Manager) Initialize(configFile string) {
+// NewManager creates a Manager from the emitter configParams: the producer and admin
+// client are configured with the kafkaConfig properties file and, when schemaRegistry
+// is enabled, values are serialized with the registryConfig schema registry.
+func NewManager(ctx context.Context, configParams map[string]string) (*Manager, error) {
+
+	k := &Manager{
+		Topic:        configParams[Topic],
+		Serializer:   configParams[Serializer],
+		TemplateType: configParams[TemplateType],
+	}
+	if k.Topic == "" {
+		k.Topic = config.DefaultTopic
+	}
+
+	configFile := configParams[KafkaConfig]
+	if configFile == "" {
+		configFile = config.KafkaConfig
+	}
+	if err := k.Initialize(configFile); err != nil {
+		return nil, err
+	}
+
+	if useRegistry, _ := strconv.ParseBool(configParams[SchemaRegistry]); useRegistry {
+		if err := k.InitializeSchemaRegistry(configParams[RegistryConfig]); err != nil {
+			_ = k.Close(ctx)
+			return nil, err
+		}
+	}
+
+	if autoCreate, _ := strconv.ParseBool(configParams[AutoCreate]); autoCreate {
+		k.CreateTopic(ctx, k.Topic)
+	}
+
+	log.Debug().
+		Str("emitter", configParams[EmitterName]).
+		Str("topic", k.Topic).
+		Str("config", configFile).
+		Bool("schemaRegistry", k.schemaRegistry).
+		Msg("kafka manager initialized")
+	return k, nil
+}
 
-	var err error
-	conf := convertInKafkaConfig(readConfig(configFile))
+func (k *Manager) Initialize(configFile string) error {
+
+	props, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+	conf := convertInKafkaConfig(props)
 	k.admin, err = kafka.NewAdminClient(&conf)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create admin client")
+		return fmt.Errorf("failed to create admin client: %w", err)
 	}
 	k.producer, err = kafka.NewProducer(&conf)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create producer")
+		k.admin.Close()
+		return fmt.Errorf("failed to create producer: %w", err)
 	}
+
+	k.events.Add(1)
+	go func() {
+		defer k.events.Done()
+		k.listenToEvents()
+	}()
+	return nil
 }
 
-func (k *Manager) InitializeSchemaRegistry(configFile string) {
-	var err error
-	conf := readConfig(configFile)
+func (k *Manager) InitializeSchemaRegistry(configFile string) error {
+
+	conf, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
 
 	k.schema, err = schemaregistry.NewClient(schemaregistry.NewConfigWithAuthentication(
 		conf["schemaRegistryURL"],
@@ -107,7 +275,7 @@ func (k *Manager) InitializeSchemaRegistry(configFile string) {
 		conf["schemaRegistryPassword"]))
 
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to create schema registry client")
+		return fmt.Errorf("failed to create schema registry client: %w", err)
 	}
 
 	/*
@@ -115,7 +283,28 @@ func (k *Manager) InitializeSchemaRegistry(configFile string) {
 			verifyCSFLE(conf, k)
 		}
 	*/
+
+	switch k.Serializer {
+	case "avro", "avro-generic":
+		serConfig := avrov2.NewSerializerConfig()
+		if k.fleEnabled {
+			serConfig.AutoRegisterSchemas = false
+			serConfig.UseLatestVersion = true
+		}
+		k.serializer, err = avrov2.NewSerializer(k.schema, serde.ValueSerde, serConfig)
+	case "json-schema":
+		k.serializer, err = jsonschema.NewSerializer(k.schema, serde.ValueSerde, jsonschema.NewSerializerConfig())
+	case "protobuf":
+		return errors.New("protobuf serializer not yet implemented")
+	default:
+		return fmt.Errorf("serializer %q not supported", k.Serializer)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating serializer: %w", err)
+	}
+
 	k.schemaRegistry = true
+	return nil
 }
 
 /*
@@ -206,83 +395,80 @@ func registerProviders() {
 }
 */
 
+// Close waits for the outstanding delivery reports, then closes the producer and the admin client.
 func (k *Manager) Close(_ context.Context) error {
-	k.admin.Close()
-	k.producer.Flush(15 * 1000)
+	if k.admin != nil {
+		k.admin.Close()
+	}
+	if k.producer == nil {
+		return nil
+	}
+
+	remaining := k.producer.Flush(flushTimeoutMs)
 	k.producer.Close()
+	k.events.Wait()
+
+	delivered := k.delivered.Load()
+	failed := k.failed.Load()
+	log.Debug().
+		Str("topic", k.Topic).
+		Uint64("delivered", delivered).
+		Uint64("failed", failed).
+		Int("undelivered", remaining).
+		Msg("kafka producer closed")
+
+	if failed > 0 || remaining > 0 {
+		return fmt.Errorf("topic %s: %d messages failed and %d were still in flight on close", k.Topic, failed, remaining)
+	}
 	return nil
 }
 
-func (k *Manager) Produce(_ context.Context, key []byte, data []byte, _ any) {
-
-	go listenToEventsFrom(k.producer, k.Topic)
-
-	var ser serde.Serializer
+func (k *Manager) Produce(ctx context.Context, key []byte, data []byte, headers map[string]string) error {
 
 	if k.schemaRegistry {
-		var err error
-
-		switch k.Serializer {
-		case "avro", "avro-generic":
-			serConfig := avrov2.NewSerializerConfig()
-			if k.fleEnabled {
-				serConfig.AutoRegisterSchemas = false
-				serConfig.UseLatestVersion = true
-			}
-			ser, err = avrov2.NewSerializer(k.schema, serde.ValueSerde, serConfig)
-		case "protobuf":
-			log.Fatal().Msg("Protobuf not yet implemented")
-		case "json-schema":
-			ser, err = jsonschema.NewSerializer(k.schema, serde.ValueSerde, jsonschema.NewSerializerConfig())
-		default:
-			log.Fatal().Str("serializer", k.Serializer).Msg("Serializer not supported")
+		t := types.GetType(k.TemplateType)
+		if err := json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("failed to unmarshal data: %w", err)
 		}
-		if err != nil {
-			log.Fatal().Err(err).Msg("Error creating serializer")
-		} else {
-
-			t := types.GetType(k.TemplateType)
-			err := json.Unmarshal(data, &t)
-
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed to unmarshal data")
-			}
-
-			payload, err := ser.Serialize(k.Topic, t)
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed to serialize payload")
-			} else {
-				data = payload
-			}
 
+		payload, err := k.serializer.Serialize(k.Topic, t)
+		if err != nil {
+			return fmt.Errorf("failed to serialize payload: %w", err)
 		}
+		data = payload
 	}
 
 	if strings.ToLower(string(key)) == "null" {
 		key = nil
 	}
 
-	err := k.producer.Produce(&kafka.Message{
+	msg := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &k.Topic, Partition: kafka.PartitionAny},
 		Key:            key,
 		Value:          data,
-		// Headers:        []kafka.Header{{Key: "myTestHeader", Value: []byte("header values are binary")}},
-	}, nil)
+		Headers:        convertInKafkaHeaders(headers),
+	}
 
-	if err != nil {
-		if err.(kafka.Error).Code() == kafka.ErrQueueFull { //nolint
-			// Producer queue is full, wait 1s for messages
-			// to be delivered then try again.
-			// time.Sleep(time.Second)
-			// continue
+	for {
+		err := k.producer.Produce(msg, nil)
+		var kErr kafka.Error
+		if err == nil || !errors.As(err, &kErr) || kErr.Code() != kafka.ErrQueueFull {
+			return err
+		}
+		// Producer queue is full, wait for messages to be delivered then try again.
+		log.Debug().Str("topic", k.Topic).Msg("producer queue full, waiting for deliveries")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			k.producer.Flush(100)
 		}
-		log.Error().Err(err).Msg("Failed to produce message")
 	}
 
 }
 
 func (k *Manager) CreateTopic(ctx context.Context, topic string) {
-	k.CreateTopicFull(ctx, topic, 6, 3)
+	k.CreateTopicFull(ctx, topic, config.DefaultPartitions, config.DefaultReplica)
 }
 
 func (k *Manager) CreateTopicFull(ctx context.Context, topic string, partitions int, rf int) {
@@ -319,20 +505,32 @@ func (k *Manager) CreateTopicFull(ctx context.Context, topic string, partitions
 		}
 	}
 
-	k.admin.Close()
+}
+
+// Delivered returns the number of messages acknowledged by the brokers.
+func (k *Manager) Delivered() uint64 {
+	return k.delivered.Load()
+}
 
+// Failed returns the number of messages whose delivery report carried an error.
+func (k *Manager) Failed() uint64 {
+	return k.failed.Load()
 }
 
-func listenToEventsFrom(k *kafka.Producer, topic string) {
+// listenToEvents consumes the producer events until the producer is closed,
+// counting the delivery reports.
+func (k *Manager) listenToEvents() {
 
-	for e := range k.Events() {
+	for e := range k.producer.Events() {
 		switch ev := e.(type) {
 		case *kafka.Message:
 			m := ev
 			if m.TopicPartition.Error != nil {
+				k.failed.Add(1)
 				log.Error().Err(m.TopicPartition.Error).Msg("Delivery failed")
+			} else {
+				k.delivered.Add(1)
 			}
-			// else fmt.Printf("Delivered message to topic %s [%d] at offset %v\n", *m.TopicPartition.Topic, m.TopicPartition.Partition, m.TopicPartition.Offset)
 
 		case kafka.Error:
 			log.Error().Err(ev).Msg("Kafka error")
@@ -341,7 +539,7 @@ func listenToEventsFrom(k *kafka.Producer, topic string) {
 			var stats map[string]interface{}
 			err := json.Unmarshal([]byte(e.String()), &stats)
 			if err != nil {
-				return
+				continue
 			}
 			txbytes := fmt.Sprintf("%9.f", stats["txmsg_bytes"])
 			b, _ := strconv.Atoi(strings.TrimSpace(txbytes))
@@ -349,7 +547,7 @@ func listenToEventsFrom(k *kafka.Producer, topic string) {
 			if b > 0 {
 				log.Info().
 					Str("bytes", txbytes).
-					Str("topic", topic).
+					Str("topic", k.Topic).
 					Msg("Bytes produced to topic")
 			}
 		default:
@@ -359,18 +557,18 @@ func listenToEventsFrom(k *kafka.Producer, topic string) {
 
 }
 
-func readConfig(configFile string) map[string]string {
+func readConfig(configFile string) (map[string]string, error) {
 
 	m := make(map[string]string)
 
 	file, err := os.Open(configFile)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to open configuration file")
+		return nil, fmt.Errorf("failed to open configuration file: %w", err)
 	}
 	defer func(file *os.File) {
 		err := file.Close()
 		if err != nil {
-			log.Fatal().Err(err).Msg("Error in closing file")
+			log.Error().Err(err).Msg("Error in closing file")
 		}
 	}(file)
 
@@ -378,17 +576,15 @@ func readConfig(configFile string) map[string]string {
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if !strings.HasPrefix(line, "#") && len(line) != 0 {
-			kv := strings.Split(line, "=")
-			parameter := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			m[parameter] = value
+			parameter, value, _ := strings.Cut(line, "=")
+			m[strings.TrimSpace(parameter)] = strings.TrimSpace(value)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Error().Err(err).Msg("Failed to read file")
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
 	}
-	return m
+	return m, nil
 }
 
 func convertInKafkaConfig(m map[string]string) kafka.ConfigMap {
@@ -399,6 +595,23 @@ func convertInKafkaConfig(m map[string]string) kafka.ConfigMap {
 	return conf
 }
 
+func convertInKafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kHeaders := make([]kafka.Header, 0, len(keys))
+	for _, k := range keys {
+		kHeaders = append(kHeaders, kafka.Header{Key: k, Value: []byte(headers[k])})
+	}
+	return kHeaders
+}
+
 /*
 func capitalizeFirstLetter(s string) string {
 	if len(s) == 0 {
@@ -0,0 +1,241 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jrnd-io/jrv2/pkg/emitter"
+	"github.com/jrnd-io/jrv2/pkg/loop"
+	jrkafka "github.com/jrnd-io/jrv2/pkg/plugin/local/kafka"
+	"github.com/stretchr/testify/assert"
+	orderedmap "github.com/wk8/go-ordered-map/v2"
+)
+
+// newMockCluster starts a mock cluster, returning it with the path of a kafka configuration file for it
+func newMockCluster(t *testing.T) (*kafka.MockCluster, string) {
+	t.Helper()
+	mc, err := kafka.NewMockCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mc.Close)
+
+	configFile := filepath.Join(t.TempDir(), "config.properties")
+	properties := fmt.Sprintf("# mock cluster\nbootstrap.servers=%s\n", mc.BootstrapServers())
+	if err := os.WriteFile(configFile, []byte(properties), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return mc, configFile
+}
+
+// consume reads up to n messages of topic from the mock cluster, waiting at most 30 seconds
+func consume(t *testing.T, mc *kafka.MockCluster, topic string, n int) []*kafka.Message {
+	t.Helper()
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": mc.BootstrapServers(),
+		"group.id":          "jr_test",
+		"auto.offset.reset": "earliest",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = consumer.Close()
+	}()
+	if err := consumer.Subscribe(topic, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []*kafka.Message
+	deadline := time.Now().Add(30 * time.Second)
+	for len(messages) < n && time.Now().Before(deadline) {
+		msg, err := consumer.ReadMessage(time.Second)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func TestProduceToMockCluster(t *testing.T) {
+
+	mc, configFile := newMockCluster(t)
+
+	configParams := map[string]string{
+		jrkafka.EmitterName: "test_emitter",
+		jrkafka.KafkaConfig: configFile,
+		jrkafka.Topic:       "test_topic",
+	}
+
+	p := &jrkafka.Producer{}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		resp, err := p.Produce(ctx,
+			[]byte(fmt.Sprintf("key%d", i)),
+			[]byte(fmt.Sprintf("value%d", i)),
+			map[string]string{"index": fmt.Sprint(i)},
+			configParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(len("value0")), resp.Bytes)
+	}
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(map[string]*kafka.Message)
+	for _, msg := range consume(t, mc, "test_topic", 3) {
+		received[string(msg.Key)] = msg
+	}
+
+	if !assert.Len(t, received, 3) {
+		t.FailNow()
+	}
+	for i := 0; i < 3; i++ {
+		msg := received[fmt.Sprintf("key%d", i)]
+		if !assert.NotNil(t, msg) {
+			continue
+		}
+		assert.Equal(t, fmt.Sprintf("value%d", i), string(msg.Value))
+		if !assert.Len(t, msg.Headers, 1) {
+			continue
+		}
+		assert.Equal(t, "index", msg.Headers[0].Key)
+		assert.Equal(t, fmt.Sprint(i), string(msg.Headers[0].Value))
+	}
+}
+
+func TestFlushEmitter(t *testing.T) {
+
+	_, configFile := newMockCluster(t)
+
+	params := func(name string) map[string]string {
+		return map[string]string{
+			jrkafka.EmitterName: name,
+			jrkafka.KafkaConfig: configFile,
+			jrkafka.Topic:       name,
+		}
+	}
+
+	p := &jrkafka.Producer{}
+	ctx := context.Background()
+	for _, name := range []string{"first", "second"} {
+		_, err := p.Produce(ctx, nil, []byte("value"), nil, params(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NoError(t, p.Flush(ctx, params("first")))
+	assert.NoError(t, p.Flush(ctx, params("missing")))
+	assert.NoError(t, p.HealthCheck(ctx))
+	assert.NoError(t, p.Close(ctx))
+}
+
+func TestSameNameInGroups(t *testing.T) {
+
+	mc, configFile := newMockCluster(t)
+
+	// emitters with the same name in different groups have their own manager and topic
+	p := &jrkafka.Producer{}
+	ctx := context.Background()
+	for _, group := range []string{"first", "second"} {
+		_, err := p.Produce(ctx, []byte(group), []byte("value"), nil, map[string]string{
+			jrkafka.EmitterName:  "same_name",
+			jrkafka.EmitterGroup: group,
+			jrkafka.KafkaConfig:  configFile,
+			jrkafka.Topic:        group + "_topic",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NoError(t, p.Close(ctx))
+
+	messages := consume(t, mc, "^(first|second)_topic$", 2)
+	assert.Len(t, messages, 2)
+	for _, msg := range messages {
+		assert.Equal(t, string(msg.Key)+"_topic", *msg.TopicPartition.Topic)
+	}
+}
+
+func TestProduceWithMissingConfig(t *testing.T) {
+
+	p := &jrkafka.Producer{}
+	_, err := p.Produce(context.Background(), nil, []byte("value"), nil, map[string]string{
+		jrkafka.EmitterName: "missing",
+		jrkafka.KafkaConfig: filepath.Join(t.TempDir(), "missing.properties"),
+	})
+	assert.Error(t, err)
+	assert.NoError(t, p.Close(context.Background()))
+}
+
+func TestEmitterTopicFromConfigFile(t *testing.T) {
+
+	mc, configFile := newMockCluster(t)
+
+	// the topic is set at the top level of the emitter, as in jrconfig.json
+	jrconfig := fmt.Sprintf(`{
+  "emitters": {
+    "orders": [
+      {
+        "name": "order",
+        "num": 2,
+        "valueTemplate": "order",
+        "embedded": true,
+        "output": "kafka",
+        "keyTemplate": "null",
+        "topic": "orders",
+        "configParameters": {"kafkaConfig": %q}
+      }
+    ]
+  }
+}`, configFile)
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(jrconfig), &raw); err != nil {
+		t.Fatal(err)
+	}
+	configs, err := emitter.DecodeConfigs(raw["emitters"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	emitters := orderedmap.New[string, []emitter.Config](1)
+	emitters.Set("orders", configs["orders"])
+	if err := loop.DoLoop(context.Background(), emitters, nil, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := consume(t, mc, "orders", 2)
+	assert.Len(t, messages, 2)
+	for _, msg := range messages {
+		assert.Equal(t, "orders", *msg.TopicPartition.Topic)
+		assert.Equal(t, "order", string(msg.Value))
+	}
+}
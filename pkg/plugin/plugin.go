@@ -22,6 +22,7 @@ package plugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -51,7 +52,26 @@ type Plugin struct {
 	IsRemote  bool
 }
 
-func New(jrPlugin string, logLevel hclog.Level) (*Plugin, error) {
+// Option configures the plugins created by New
+type Option func(*options)
+
+type options struct {
+	batching Batching
+}
+
+// WithBatching groups the objects produced to the remote plugins supporting it
+func WithBatching(batching Batching) Option {
+	return func(o *options) {
+		o.batching = batching
+	}
+}
+
+func New(jrPlugin string, logLevel hclog.Level, opts ...Option) (*Plugin, error) {
+
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
 
 	var pl *Plugin
 	var command string
@@ -144,7 +164,7 @@ func New(jrPlugin string, logLevel hclog.Level) (*Plugin, error) {
 
 	return &Plugin{
 		Name:     pluginName,
-		Producer: NewAdapter(p),
+		Producer: NewAdapter(p, o.batching),
 		IsRemote: true,
 		Command:  command,
 		client:   client,
@@ -157,16 +177,69 @@ func (c *Plugin) Produce(ctx context.Context, key []byte, value []byte, headers
 
 }
 
+// Configure configures the producer for an emitter, with its configuration parameters and the
+// .conf.json file of the plugin. It must be called before the emitter starts producing.
+func (c *Plugin) Configure(ctx context.Context, configParams map[string]string) error {
+	lc, ok := c.Producer.(Lifecycle)
+	if !ok {
+		return nil
+	}
+
+	var config []byte
+	if configFile := getConfigFileFor(c.Name); configFile != "" {
+		var err error
+		if config, err = os.ReadFile(configFile); err != nil {
+			return fmt.Errorf("error reading configuration of plugin %s: %w", c.Name, err)
+		}
+	}
+	log.Debug().
+		Str("plugin", c.Name).
+		Str("emitter", configParams["emitter.name"]).
+		Msg("configuring producer")
+	return lc.Configure(ctx, configParams, config)
+}
+
+// AddCallers declares n more goroutines producing to the plugin, or -n less, for the batches of the remote plugins
+func (c *Plugin) AddCallers(n int) {
+	if a, ok := c.Producer.(*Adapter); ok {
+		a.AddCallers(n)
+	}
+}
+
+// HealthCheck returns an error if the producer can't produce
+func (c *Plugin) HealthCheck(ctx context.Context) error {
+	if lc, ok := c.Producer.(Lifecycle); ok {
+		return lc.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// Flush returns when all the objects produced so far by the emitter in configParams are written to the output
+func (c *Plugin) Flush(ctx context.Context, configParams map[string]string) error {
+	if lc, ok := c.Producer.(Lifecycle); ok {
+		return lc.Flush(ctx, configParams)
+	}
+	return nil
+}
+
 func (c *Plugin) Close() error {
+	var err error
+	if closer, ok := c.Producer.(Closer); ok {
+		log.Debug().Str("plugin", c.Name).Msg("executing producer close")
+		err = closer.Close(context.Background())
+		if !c.IsRemote {
+			return err
+		}
+	}
 	if c.RPCClient != nil {
 		log.Debug().Str("plugin", c.Name).Msg("executing rpcclient close")
-		return c.RPCClient.Close()
+		return errors.Join(err, c.RPCClient.Close())
 	}
 	if c.client != nil {
 		log.Debug().Str("plugin", c.Name).Msg("executing client kill")
 		c.client.Kill()
 	}
-	return nil
+	return err
 }
 
 func sanitize(c string) string {
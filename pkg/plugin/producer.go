@@ -34,6 +34,22 @@ type Producer interface {
 	Produce(ctx context.Context, key []byte, v []byte, headers map[string]string, configParams map[string]string) (*jrpc.ProduceResponse, error)
 }
 
+// Closer is implemented by local producers holding resources which must be released when the plugin is closed
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// Lifecycle is implemented by the producers which must be configured for every emitter before it starts
+// producing, with its configuration parameters and the .conf.json file of the plugin, checked and flushed.
+// Flush writes only the objects of the emitter in configParams.
+// Close must write the buffered objects before releasing the resources.
+type Lifecycle interface {
+	Configure(ctx context.Context, configParams map[string]string, config []byte) error
+	HealthCheck(ctx context.Context) error
+	Flush(ctx context.Context, configParams map[string]string) error
+	Closer
+}
+
 func RegisterLocalPlugin(name string, plugin *Plugin) {
 	if !strings.HasPrefix(name, "jr-") {
 		name = fmt.Sprintf("jr-%s", name)
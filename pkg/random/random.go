@@ -22,17 +22,24 @@ package random
 
 import (
 	"encoding/binary"
+	"fmt"
+	"hash/fnv"
 	"math/rand/v2"
+	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 var JrSeed int64 = -1
 var ChaCha8 *rand.ChaCha8
 
-var Random randomI
+// Random is the global source of the random values, set by SetRandom.
+// The templates of a seeded emitter draw from its own stream instead, see NewStream.
+var Random Source = baseRandom{}
 
-type randomI interface {
+type Source interface {
 	IntN(n int) int
 	Int64N(n int64) int64
 	Float64() float64
@@ -41,6 +48,51 @@ type randomI interface {
 	Shuffle(n int, swap func(i, j int))
 }
 
+// holder wraps a Source so that it can be stored in an atomic.Pointer
+type holder struct {
+	Source
+}
+
+var (
+	base atomic.Pointer[holder]
+
+	// streams created by NewStream by name, and their positions set by Restore
+	streams     = make(map[string]*lockedRandom)
+	positions   map[string][]byte
+	streamsLock sync.Mutex
+)
+
+func init() {
+	base.Store(&holder{&globalRandom{}})
+}
+
+// baseRandom delegates to the source set by SetRandom
+type baseRandom struct {
+}
+
+func (baseRandom) source() Source {
+	return base.Load().Source
+}
+
+func (r baseRandom) IntN(n int) int {
+	return r.source().IntN(n)
+}
+func (r baseRandom) Int64N(n int64) int64 {
+	return r.source().Int64N(n)
+}
+func (r baseRandom) Float64() float64 {
+	return r.source().Float64()
+}
+func (r baseRandom) Float32() float32 {
+	return r.source().Float32()
+}
+func (r baseRandom) Uint64() uint64 {
+	return r.source().Uint64()
+}
+func (r baseRandom) Shuffle(n int, swap func(i, j int)) {
+	r.source().Shuffle(n, swap)
+}
+
 // global random is a wrapper for the global random gen
 type globalRandom struct {
 }
@@ -67,16 +119,158 @@ func (r *globalRandom) Uint64() uint64 {
 func SetRandom(seed int64) {
 
 	JrSeed = seed //nolint
+	streamsLock.Lock()
+	streams = make(map[string]*lockedRandom)
+	positions = nil
+	streamsLock.Unlock()
 	if seed == -1 {
 		// return a random/v2 object
-		Random = &globalRandom{}
+		base.Store(&holder{&globalRandom{}})
+		uuid.SetRand(nil)
 		return
 	}
 
 	ChaCha8 = rand.NewChaCha8(CreateByteSeed(uint64(JrSeed))) //nolint
-	uuid.SetRand(ChaCha8)
-	Random = rand.New(ChaCha8) //nolint no need for a secure random generator
+	locked := newLockedRandom(ChaCha8)
+	uuid.SetRand(locked)
+	base.Store(&holder{locked})
+
+}
+
+// NewStream returns a random stream derived from the seed and the given name, independent
+// from the streams with other names. Without a seed it returns nil, and the callers fall back to
+// Random.
+func NewStream(name string) Source {
+	if JrSeed == -1 {
+		return nil
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	//nolint no need for a secure random generator
+	s := newLockedRandom(rand.NewChaCha8(CreateByteSeed(uint64(JrSeed) ^ h.Sum64())))
+
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+	if p, ok := positions[name]; ok {
+		if err := s.UnmarshalBinary(p); err != nil {
+			log.Warn().Err(err).Str("stream", name).Msg("error in restoring random stream")
+		}
+	}
+	streams[name] = s
+	return s
+}
 
+// Snapshot returns the positions of the seeded streams by name, the base one with an empty name.
+// Without a seed it returns nil.
+func Snapshot() (map[string][]byte, error) {
+	if JrSeed == -1 {
+		return nil, nil
+	}
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	snapshot := make(map[string][]byte, len(streams)+1)
+	if b, ok := base.Load().Source.(*lockedRandom); ok {
+		p, err := b.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		snapshot[""] = p
+	}
+	for name, s := range streams {
+		p, err := s.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: %w", name, err)
+		}
+		snapshot[name] = p
+	}
+	return snapshot, nil
+}
+
+// Restore moves the seeded streams to the positions of a Snapshot, also the ones created later by
+// NewStream, so that they continue the values of a previous run. It has no effect without a seed.
+func Restore(snapshot map[string][]byte) error {
+	if JrSeed == -1 {
+		return nil
+	}
+	streamsLock.Lock()
+	defer streamsLock.Unlock()
+
+	if p, ok := snapshot[""]; ok {
+		if b, ok := base.Load().Source.(*lockedRandom); ok {
+			if err := b.UnmarshalBinary(p); err != nil {
+				return err
+			}
+		}
+	}
+	for name, s := range streams {
+		if p, ok := snapshot[name]; ok {
+			if err := s.UnmarshalBinary(p); err != nil {
+				return fmt.Errorf("stream %s: %w", name, err)
+			}
+		}
+	}
+	positions = snapshot
+	return nil
+}
+
+// lockedRandom serializes the access to a seeded generator, which is shared with uuid.
+// The generated values are reproducible only if the calls happen in the same order.
+type lockedRandom struct {
+	lock   sync.Mutex
+	source *rand.ChaCha8
+	rand   *rand.Rand
+}
+
+func newLockedRandom(source *rand.ChaCha8) *lockedRandom {
+	//nolint no need for a secure random generator
+	return &lockedRandom{source: source, rand: rand.New(source)}
+}
+
+func (r *lockedRandom) IntN(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.IntN(n)
+}
+func (r *lockedRandom) Int64N(n int64) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Int64N(n)
+}
+func (r *lockedRandom) Float64() float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Float64()
+}
+func (r *lockedRandom) Float32() float32 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Float32()
+}
+func (r *lockedRandom) Uint64() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rand.Uint64()
+}
+func (r *lockedRandom) Shuffle(n int, swap func(i, j int)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.rand.Shuffle(n, swap)
+}
+func (r *lockedRandom) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.source.Read(p)
+}
+func (r *lockedRandom) MarshalBinary() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.source.MarshalBinary()
+}
+func (r *lockedRandom) UnmarshalBinary(data []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.source.UnmarshalBinary(data)
 }
 
 func CreateByteSeed(seed uint64) [32]byte {
@@ -0,0 +1,88 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package random_test
+
+import (
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/stretchr/testify/assert"
+)
+
+// draw returns n values drawn from s
+func draw(s random.Source, n int) []uint64 {
+	values := make([]uint64, n)
+	for i := range values {
+		values[i] = s.Uint64()
+	}
+	return values
+}
+
+// seed sets the seed for the test, and removes it at the end
+func seed(t *testing.T, seed int64) {
+	t.Helper()
+	random.SetRandom(seed)
+	t.Cleanup(func() { random.SetRandom(-1) })
+}
+
+func TestNewStream(t *testing.T) {
+	assert.Nil(t, random.NewStream("orders"))
+
+	seed(t, 42)
+	orders := draw(random.NewStream("orders"), 10)
+	// the streams with the same name draw the same values, independent from the other streams
+	assert.Equal(t, orders, draw(random.NewStream("orders"), 10))
+	assert.NotEqual(t, orders, draw(random.NewStream("payments"), 10))
+
+	// they change with the seed
+	random.SetRandom(43)
+	assert.NotEqual(t, orders, draw(random.NewStream("orders"), 10))
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	snapshot, err := random.Snapshot()
+	assert.NoError(t, err)
+	assert.Nil(t, snapshot)
+
+	seed(t, 42)
+	orders := random.NewStream("orders")
+	draw(orders, 5)
+	draw(random.Random, 5)
+	snapshot, err = random.Snapshot()
+	assert.NoError(t, err)
+	assert.Contains(t, snapshot, "")
+	assert.Contains(t, snapshot, "orders")
+	next := draw(orders, 5)
+	nextBase := draw(random.Random, 5)
+
+	// the existing streams continue from the snapshot
+	assert.NoError(t, random.Restore(snapshot))
+	assert.Equal(t, next, draw(orders, 5))
+	assert.Equal(t, nextBase, draw(random.Random, 5))
+
+	// and so do the ones created after restoring it, like the streams of a resumed run
+	random.SetRandom(42)
+	assert.NoError(t, random.Restore(snapshot))
+	assert.Equal(t, next, draw(random.NewStream("orders"), 5))
+	assert.Equal(t, nextBase, draw(random.Random, 5))
+	// the streams not in the snapshot start from the beginning
+	assert.Equal(t, draw(random.NewStream("payments"), 5), draw(random.NewStream("payments"), 5))
+}
@@ -0,0 +1,164 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package random
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// zipfTable is the key of the cumulative distributions of ZipfIndex
+type zipfTable struct {
+	n int
+	s float64
+}
+
+const (
+	// maxZipfTable is the largest number of indexes drawn by ZipfIndex with a table,
+	// above it they are drawn by rejection-inversion
+	maxZipfTable = 1 << 16
+	// maxZipfTables is the number of tables cached by ZipfIndex, which drops them all when it is full
+	maxZipfTables = 64
+)
+
+var (
+	zipfLock sync.Mutex
+	// zipfTables caches the cumulative distributions of ZipfIndex by number of indexes and exponent
+	zipfTables = make(map[zipfTable][]float64)
+)
+
+// ZipfIndex draws an index in [0, n) with the Zipf distribution of exponent s > 0, where the
+// probability of the index i is proportional to 1/(i+1)^s
+func ZipfIndex(r Source, n int, s float64) int {
+	if n <= 1 {
+		return 0
+	}
+	if n > maxZipfTable {
+		return zipfRejection(r, n, s)
+	}
+	cdf := zipfCDF(n, s)
+	u := r.Float64() * cdf[n-1]
+	return min(sort.SearchFloat64s(cdf, u), n-1)
+}
+
+// zipfCDF returns the unnormalized cumulative distribution of ZipfIndex
+func zipfCDF(n int, s float64) []float64 {
+	key := zipfTable{n: n, s: s}
+	zipfLock.Lock()
+	cdf, ok := zipfTables[key]
+	zipfLock.Unlock()
+	if ok {
+		return cdf
+	}
+	cdf = make([]float64, n)
+	sum := 0.0
+	for i := range cdf {
+		sum += math.Pow(float64(i+1), -s)
+		cdf[i] = sum
+	}
+	zipfLock.Lock()
+	defer zipfLock.Unlock()
+	if len(zipfTables) >= maxZipfTables {
+		clear(zipfTables)
+	}
+	zipfTables[key] = cdf
+	return cdf
+}
+
+// zipfRejection draws the index of ZipfIndex without a table, with the rejection-inversion method
+// of Hörmann and Derflinger, which takes a constant number of draws on average
+func zipfRejection(r Source, n int, s float64) int {
+	// h is the unnormalized probability of x, hIntegral its integral and hIntegralInverse the inverse of hIntegral
+	h := func(x float64) float64 {
+		return math.Exp(-s * math.Log(x))
+	}
+	hIntegral := func(x float64) float64 {
+		logX := math.Log(x)
+		return expm1Ratio((1-s)*logX) * logX
+	}
+	hIntegralInverse := func(x float64) float64 {
+		return math.Exp(log1pRatio(max(x*(1-s), -1)) * x)
+	}
+
+	hIntegralX1 := hIntegral(1.5) - 1
+	hIntegralN := hIntegral(float64(n) + 0.5)
+	threshold := 2 - hIntegralInverse(hIntegral(2.5)-h(2))
+	for {
+		u := hIntegralN + r.Float64()*(hIntegralX1-hIntegralN)
+		x := hIntegralInverse(u)
+		k := min(max(int(x+0.5), 1), n)
+		if float64(k)-x <= threshold || u >= hIntegral(float64(k)+0.5)-h(float64(k)) {
+			return k - 1
+		}
+	}
+}
+
+// log1pRatio returns log(1+x)/x, continuous in 0
+func log1pRatio(x float64) float64 {
+	if math.Abs(x) > 1e-8 {
+		return math.Log1p(x) / x
+	}
+	return 1 - x*(0.5-x*(1.0/3-0.25*x))
+}
+
+// expm1Ratio returns (exp(x)-1)/x, continuous in 0
+func expm1Ratio(x float64) float64 {
+	if math.Abs(x) > 1e-8 {
+		return math.Expm1(x) / x
+	}
+	return 1 + x*0.5*(1+x/3*(1+0.25*x))
+}
+
+// PowerLawIndex draws an index in [0, n) from a power law of exponent alpha > 0, bounded to [1, n+1).
+// Unlike ZipfIndex it needs no table, so it suits any number of indexes.
+func PowerLawIndex(r Source, n int, alpha float64) int {
+	if n <= 1 {
+		return 0
+	}
+	u := r.Float64()
+	upper := float64(n + 1)
+	var x float64
+	if alpha == 1 {
+		x = math.Pow(upper, u)
+	} else {
+		e := 1 - alpha
+		x = math.Pow(1-u*(1-math.Pow(upper, e)), 1/e)
+	}
+	return min(max(int(x)-1, 0), n-1)
+}
+
+// HotSetIndex draws one of the first hot indexes in [0, n) with probability p, and one of the
+// others otherwise, uniformly
+func HotSetIndex(r Source, n int, hot int, p float64) int {
+	if n <= 1 {
+		return 0
+	}
+	hot = min(max(hot, 0), n)
+	switch {
+	case hot == 0 || hot == n:
+		return r.IntN(n)
+	case r.Float64() < p:
+		return r.IntN(hot)
+	default:
+		return hot + r.IntN(n-hot)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+)
+
+// Checkpoint is a snapshot of the SharedState, to resume a run where a previous one stopped
+// without generating again the same counters and losing the lists.
+type Checkpoint struct {
+	Time      time.Time                           `json:"time"`
+	Seed      int64                               `json:"seed"`
+	Iteration int                                 `json:"iteration"`
+	Global    ScopeSnapshot                       `json:"global"`
+	Groups    map[string]ScopeSnapshot            `json:"groups,omitempty"`
+	Emitters  map[string]map[string]ScopeSnapshot `json:"emitters,omitempty"`
+	Random    map[string][]byte                   `json:"random,omitempty"`
+}
+
+// ScopeSnapshot is the content of a Scope. The values are restored with their JSON types,
+// so the numbers set in the lists or in the context become float64.
+type ScopeSnapshot struct {
+	Counters map[string]int   `json:"counters,omitempty"`
+	Lists    map[string][]any `json:"lists,omitempty"`
+	Values   map[string]any   `json:"values,omitempty"`
+}
+
+func (st *Scope) snapshot() ScopeSnapshot {
+	s := ScopeSnapshot{
+		Counters: make(map[string]int),
+		Lists:    make(map[string][]any),
+		Values:   make(map[string]any),
+	}
+	st.countersLock.RLock()
+	st.Counters.Range(func(k, v any) bool {
+		s.Counters[k.(string)] = v.(int)
+		return true
+	})
+	st.countersLock.RUnlock()
+
+	st.listLock.RLock()
+	st.List.Range(func(k, v any) bool {
+		s.Lists[k.(string)] = append([]any(nil), v.([]any)...)
+		return true
+	})
+	st.listLock.RUnlock()
+
+	st.Ctx.Range(func(k, v any) bool {
+		s.Values[k.(string)] = v
+		return true
+	})
+	return s
+}
+
+func (st *Scope) restore(s ScopeSnapshot) {
+	st.countersLock.Lock()
+	for k, v := range s.Counters {
+		st.Counters.Store(k, v)
+	}
+	st.countersLock.Unlock()
+
+	st.listLock.Lock()
+	for k, v := range s.Lists {
+		st.List.Store(k, v)
+	}
+	st.listLock.Unlock()
+
+	for k, v := range s.Values {
+		st.Ctx.Store(k, v)
+	}
+}
+
+// Checkpoint returns a snapshot of the scopes, of the position in the CSV and of the random streams
+func (st *SharedState) Checkpoint() (*Checkpoint, error) {
+	positions, err := random.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{
+		Time:      st.Execution.Now(),
+		Seed:      random.JrSeed,
+		Iteration: st.Execution.IterationLoopIndex(),
+		Global:    st.Scope.snapshot(),
+		Groups:    make(map[string]ScopeSnapshot),
+		Emitters:  make(map[string]map[string]ScopeSnapshot),
+		Random:    positions,
+	}
+
+	st.scopesLock.Lock()
+	defer st.scopesLock.Unlock()
+	for group, s := range st.groups {
+		c.Groups[group] = s.snapshot()
+	}
+	for key, s := range st.emitters {
+		if c.Emitters[key.group] == nil {
+			c.Emitters[key.group] = make(map[string]ScopeSnapshot)
+		}
+		c.Emitters[key.group][key.name] = s.snapshot()
+	}
+	return c, nil
+}
+
+// Restore sets the state saved in c. The run continues with the seed of c, from the positions of its
+// random streams: it must be called before creating the emitters.
+func (st *SharedState) Restore(c *Checkpoint) error {
+	if c.Seed != -1 {
+		random.SetRandom(c.Seed)
+		if err := random.Restore(c.Random); err != nil {
+			return fmt.Errorf("error in restoring random streams: %w", err)
+		}
+	}
+
+	st.Execution.lock.Lock()
+	st.Execution.CurrentIterationLoopIndex = c.Iteration
+	st.Execution.lock.Unlock()
+
+	st.Scope.restore(c.Global)
+	for group, s := range c.Groups {
+		st.GroupScope(group).restore(s)
+	}
+	for group, emitters := range c.Emitters {
+		for name, s := range emitters {
+			st.EmitterScope(group, name).restore(s)
+		}
+	}
+	return nil
+}
+
+// WriteCheckpoint writes a Checkpoint of the state as JSON to the file at path, replacing it atomically
+func (st *SharedState) WriteCheckpoint(path string) error {
+	c, err := st.Checkpoint()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadCheckpoint reads the Checkpoint written by WriteCheckpoint to the file at path
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jrnd-io/jrv2/pkg/random"
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	defer random.SetRandom(0)
+	random.SetRandom(7)
+	stream := random.NewStream("checkpoint")
+
+	s := state.GetSharedState()
+	group := s.GroupScope("checkpoint")
+	emitter := s.EmitterScope("checkpoint", "first")
+	group.Counter("id", 1, 1)
+	group.Counter("id", 1, 1)
+	emitter.AddValueToList("ids", "a")
+	s.Ctx.Store("checkpointValue", "v")
+	stream.Uint64()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := s.WriteCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	next := stream.Uint64()
+
+	// changing the state after the checkpoint
+	group.Counter("id", 1, 1)
+	emitter.AddValueToList("ids", "b")
+	s.Ctx.Store("checkpointValue", "w")
+
+	c, err := state.ReadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(7), c.Seed)
+	if err := s.Restore(c); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, group.Counter("id", 1, 1))
+	assert.Equal(t, "a", emitter.GetValueFromListAtIndex("ids", 0))
+	assert.Equal(t, "", emitter.GetValueFromListAtIndex("ids", 1))
+	assert.Equal(t, "v", s.String("checkpointValue"))
+
+	// the streams created after the restore continue from the checkpoint
+	assert.Equal(t, next, random.NewStream("checkpoint").Uint64())
+}
+
+func TestReadCheckpoint(t *testing.T) {
+	_, err := state.ReadCheckpoint(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
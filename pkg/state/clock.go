@@ -0,0 +1,203 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Clock is the time seen by the templates and by the tickers. A nil Clock is the real time.
+// A simulated Clock starts at a given time and flows Speed times faster than the real time.
+// With a Speed of 0 the Clock is stepped: it doesn't flow by itself, but jumps from tick to tick
+// of the emitters as fast as they generate their objects, to backfill the time until End.
+type Clock struct {
+	start time.Time
+	end   time.Time
+	speed float64
+	// real is when the simulated clock started
+	real time.Time
+
+	// lock guards the stepped clock: now is the time of the earliest of the tickers
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	tickers map[any]time.Time
+}
+
+// NewClock returns a simulated Clock starting at start and ending at end, which can be zero.
+// A speed of 0 returns a stepped clock.
+func NewClock(start time.Time, end time.Time, speed float64) (*Clock, error) {
+	if start.IsZero() {
+		return nil, errors.New("the start of the clock is required")
+	}
+	if !end.IsZero() && !end.After(start) {
+		return nil, errors.New("the end of the clock must be after its start")
+	}
+	if speed < 0 {
+		return nil, errors.New("the speed of the clock must not be negative")
+	}
+	c := &Clock{
+		start:   start,
+		end:     end,
+		speed:   speed,
+		real:    time.Now(),
+		now:     start,
+		tickers: make(map[any]time.Time),
+	}
+	c.cond = sync.NewCond(&c.lock)
+	return c, nil
+}
+
+// ParseClock returns the Clock starting at from and ending at to, parsed with ParseClockTime.
+// Without from and to it returns nil, the real time.
+func ParseClock(from string, to string, speed float64) (*Clock, error) {
+	if from == "" {
+		if to != "" {
+			return nil, errors.New("the end of the clock requires its start")
+		}
+		return nil, nil
+	}
+	start, err := ParseClockTime(from)
+	if err != nil {
+		return nil, err
+	}
+	var end time.Time
+	if to != "" {
+		if end, err = ParseClockTime(to); err != nil {
+			return nil, err
+		}
+	}
+	return NewClock(start, end, speed)
+}
+
+// ParseClockTime parses the start or the end of a Clock, as a RFC 3339 time, a local date time or a date
+func ParseClockTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time " + s + ", expected a date like 2006-01-02 or a time like 2006-01-02T15:04:05Z")
+}
+
+// Now returns the current time of the clock
+func (c *Clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	if c.speed > 0 {
+		return c.start.Add(c.Simulated(time.Since(c.real)))
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Start returns the start of a simulated clock, or the current time
+func (c *Clock) Start() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.start
+}
+
+// End returns the end of the clock, or the zero time if it has no end
+func (c *Clock) End() time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	return c.end
+}
+
+// IsStepped returns true if the clock jumps from tick to tick instead of flowing
+func (c *Clock) IsStepped() bool {
+	return c != nil && c.speed == 0
+}
+
+// Real returns the real duration in which d elapses on the clock
+func (c *Clock) Real(d time.Duration) time.Duration {
+	if c == nil || c.speed == 0 {
+		return d
+	}
+	return time.Duration(float64(d) / c.speed)
+}
+
+// Simulated returns the duration elapsed on the clock in the real duration d
+func (c *Clock) Simulated(d time.Duration) time.Duration {
+	if c == nil || c.speed == 0 {
+		return d
+	}
+	return time.Duration(float64(d) * c.speed)
+}
+
+// Join adds a ticker to a stepped clock at t: the clock doesn't go past the time of any of its tickers
+func (c *Clock) Join(ticker any, t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tickers[ticker] = t
+}
+
+// Leave removes a ticker from a stepped clock
+func (c *Clock) Leave(ticker any) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.tickers, ticker)
+	c.cond.Broadcast()
+}
+
+// Advance moves a ticker of a stepped clock to t, then blocks until all the other tickers are at t or later
+// and moves the clock to t. It returns false if ctx is done before.
+func (c *Clock) Advance(ctx context.Context, ticker any, t time.Time) bool {
+	stop := context.AfterFunc(ctx, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.cond.Broadcast()
+	})
+	defer stop()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tickers[ticker] = t
+	c.cond.Broadcast()
+	for c.earliest().Before(t) {
+		if ctx.Err() != nil {
+			return false
+		}
+		c.cond.Wait()
+	}
+	if t.After(c.now) {
+		c.now = t
+	}
+	return ctx.Err() == nil
+}
+
+func (c *Clock) earliest() time.Time {
+	var earliest time.Time
+	for _, t := range c.tickers {
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest
+}
@@ -0,0 +1,96 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClock(t *testing.T) {
+	clock, err := state.ParseClock("", "", 0)
+	assert.NoError(t, err)
+	assert.Nil(t, clock)
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+
+	_, err = state.ParseClock("", "2026-10-01", 0)
+	assert.Error(t, err)
+	_, err = state.ParseClock("2026-10-01", "2026-09-01", 0)
+	assert.Error(t, err)
+	_, err = state.ParseClock("yesterday", "", 0)
+	assert.Error(t, err)
+	_, err = state.ParseClock("2026-09-01", "", -1)
+	assert.Error(t, err)
+
+	clock, err = state.ParseClock("2026-09-01T10:00:00Z", "2026-10-01", 0)
+	assert.NoError(t, err)
+	assert.True(t, clock.IsStepped())
+	assert.Equal(t, time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC), clock.Now().UTC())
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local), clock.End())
+}
+
+func TestClockSpeed(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, time.Time{}, 60)
+	assert.NoError(t, err)
+	assert.False(t, clock.IsStepped())
+	assert.Equal(t, time.Second, clock.Real(time.Minute))
+	assert.Equal(t, time.Minute, clock.Simulated(time.Second))
+
+	time.Sleep(50 * time.Millisecond)
+	now := clock.Now()
+	assert.True(t, now.After(start.Add(2*time.Second)), now)
+	assert.True(t, now.Before(start.Add(time.Hour)), now)
+}
+
+func TestClockAdvance(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	clock, err := state.NewClock(start, time.Time{}, 0)
+	assert.NoError(t, err)
+	clock.Join("slow", start)
+	clock.Join("fast", start)
+
+	advanced := make(chan bool)
+	go func() {
+		advanced <- clock.Advance(context.Background(), "fast", start.Add(time.Hour))
+	}()
+	select {
+	case <-advanced:
+		t.Fatal("advanced past the slow ticker")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, start, clock.Now())
+
+	assert.True(t, clock.Advance(context.Background(), "slow", start.Add(time.Minute)))
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+	clock.Leave("slow")
+	assert.True(t, <-advanced)
+	assert.Equal(t, start.Add(time.Hour), clock.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	clock.Join("late", start.Add(time.Hour))
+	go cancel()
+	assert.False(t, clock.Advance(ctx, "fast", start.Add(2*time.Hour)))
+}
@@ -0,0 +1,236 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/biter777/countries"
+	"github.com/jrnd-io/jrv2/pkg/random"
+)
+
+// Names of the scopes, which prefix the names of the values to address a scope explicitly,
+// i.e. counter "global:id" 0 1. Without a prefix the values are in the scope of the group.
+const (
+	EmitterScope = "emitter"
+	GroupScope   = "group"
+	GlobalScope  = "global"
+)
+
+// Scope is a namespace of the state of the templates: the counters, the lists and the values set by
+// the templates, and the indexes correlating the values generated by the functions, like a city and its zip.
+// Every emitter has its own scope, and can address the ones of its group and the global one.
+type Scope struct {
+	Name         string
+	Counters     sync.Map
+	countersLock sync.RWMutex
+	Ctx          sync.Map
+
+	List     sync.Map
+	listLock sync.RWMutex
+
+	LastIndex    int
+	CountryIndex int
+	CityIndex    int
+
+	group  *Scope
+	global *Scope
+	source random.Source
+}
+
+// usIndex is the index of the default country
+var usIndex = func() int {
+	index := 0
+	for i, c := range countries.All() {
+		if c.Alpha2() == "US" {
+			index = i
+		}
+	}
+	return index
+}()
+
+// newScope returns an empty scope in group and global, which are the scope itself if nil
+func newScope(name string, group *Scope, global *Scope) *Scope {
+	s := &Scope{
+		Name:         name,
+		LastIndex:    -1,
+		CountryIndex: usIndex, // int(countries.UnitedStatesOfAmerica),
+		CityIndex:    -1,
+		group:        group,
+		global:       global,
+	}
+	if s.global == nil {
+		s.global = s
+	}
+	if s.group == nil {
+		s.group = s
+	}
+	return s
+}
+
+// Resolve returns the scope addressed by the prefix of name, the group one without a prefix,
+// and the name without the prefix
+func (st *Scope) Resolve(name string) (*Scope, string) {
+	prefix, rest, ok := strings.Cut(name, ":")
+	if ok {
+		switch prefix {
+		case EmitterScope:
+			return st, rest
+		case GroupScope:
+			return st.group, rest
+		case GlobalScope:
+			return st.global, rest
+		}
+	}
+	return st.group, name
+}
+
+// String returns the value set in the scope with key, or "" if it is not a string
+func (st *Scope) String(key string) string {
+	s, _ := st.Value(key).(string)
+	return s
+}
+
+func (st *Scope) AddValueToList(key string, value any) {
+	st.listLock.Lock()
+	defer st.listLock.Unlock()
+	list, ok := st.List.Load(key)
+	if !ok {
+		list = []any{}
+	}
+	list = append(list.([]any), value)
+	st.List.Store(key, list)
+}
+
+// SetRandom sets the source of the random values of the templates rendered in the scope
+func (st *Scope) SetRandom(r random.Source) {
+	st.source = r
+}
+
+// Random returns the source of the random values of the templates rendered in the scope,
+// random.Random if none was set
+func (st *Scope) Random() random.Source {
+	if st.source == nil {
+		return random.Random
+	}
+	return st.source
+}
+
+// RandomValueFromList returns a random value drawn from r from list s
+func (st *Scope) RandomValueFromList(r random.Source, s string) any {
+	st.listLock.Lock()
+	defer st.listLock.Unlock()
+	list, _ := st.List.Load(s)
+	if list == nil {
+		return ""
+	}
+	l := len(list.([]any))
+	if l != 0 {
+		return list.([]any)[r.IntN(l)]
+	}
+	return ""
+}
+
+func (st *Scope) GetValueFromListAtIndex(s string, index int) any {
+
+	st.listLock.Lock()
+	defer st.listLock.Unlock()
+	list, _ := st.List.Load(s)
+	if list == nil {
+		return ""
+	}
+	l := len(list.([]any))
+	if l != 0 && index < l {
+		return list.([]any)[index]
+	}
+
+	return ""
+}
+
+// RandomNValuesFromList returns n different random values drawn from r from list s
+func (st *Scope) RandomNValuesFromList(r random.Source, s string, n int) []any {
+	st.listLock.Lock()
+	defer st.listLock.Unlock()
+	list, _ := st.List.Load(s)
+	if list == nil {
+		return []any{""}
+
+	}
+	l := len(list.([]any))
+	if l != 0 {
+		ints := findNDifferentInts(r, n, l)
+		results := make([]any, len(ints))
+		for i := range ints {
+			results[i] = list.([]any)[i]
+		}
+		return results
+	}
+
+	return []any{""}
+}
+
+// Helper function to check if an int is in a slice of ints
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *Scope) Counter(c string, start int, step int) int {
+	st.countersLock.Lock()
+	defer st.countersLock.Unlock()
+
+	val, exists := st.Counters.Load(c)
+	if exists {
+		st.Counters.Store(c, val.(int)+step)
+		return val.(int) + step
+	}
+	st.Counters.Store(c, start)
+	return start
+}
+
+// Helper function to generate n different integers from 0 to length
+func findNDifferentInts(r random.Source, n, max int) []int {
+
+	n = int(math.Min(float64(n), float64(max)))
+	ints := make([]int, n)
+
+	// Generate n different random indices of maximum length
+	for i := 0; i < n; {
+		index := r.IntN(max)
+		if !contains(ints, index) {
+			ints[i] = index
+			i++
+		}
+	}
+
+	return ints
+}
+
+func (st *Scope) Value(key string) any {
+	value, _ := st.Ctx.Load(key)
+	return value
+}
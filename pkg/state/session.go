@@ -0,0 +1,72 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state
+
+import "time"
+
+// Session is a sequence of related events, i.e. the page views of a user visiting a website, read by
+// the templates as .Session: {{.Session.ID}}, {{.Session.Seq}} or {{.Session.Elapsed.Milliseconds}}.
+type Session struct {
+	ID string
+	// Seq is the sequence number of the current event, from 1 to Events
+	Seq int
+	// Events is the number of events of the session
+	Events int
+	// Start is the time of the first event, and Time the one of the current event
+	Start time.Time
+	Time  time.Time
+}
+
+// NewSession returns a session of events starting at start with its first event
+func NewSession(id string, start time.Time, events int) *Session {
+	return &Session{
+		ID:     id,
+		Seq:    1,
+		Events: max(events, 1),
+		Start:  start,
+		Time:   start,
+	}
+}
+
+// Next moves the session to its next event at now, returning false if the session ended
+func (s *Session) Next(now time.Time) bool {
+	if s.Last() {
+		return false
+	}
+	s.Seq++
+	s.Time = now
+	return true
+}
+
+// Elapsed returns the time from the start of the session to the current event
+func (s *Session) Elapsed() time.Duration {
+	return s.Time.Sub(s.Start)
+}
+
+// First returns true for the first event of the session
+func (s *Session) First() bool {
+	return s.Seq == 1
+}
+
+// Last returns true for the last event of the session
+func (s *Session) Last() bool {
+	return s.Seq >= s.Events
+}
@@ -0,0 +1,54 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrnd-io/jrv2/pkg/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession(t *testing.T) {
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	s := state.NewSession("s1", start, 3)
+	assert.Equal(t, 1, s.Seq)
+	assert.True(t, s.First())
+	assert.False(t, s.Last())
+	assert.Equal(t, time.Duration(0), s.Elapsed())
+
+	assert.True(t, s.Next(start.Add(time.Minute)))
+	assert.Equal(t, 2, s.Seq)
+	assert.False(t, s.First())
+	assert.Equal(t, time.Minute, s.Elapsed())
+
+	assert.True(t, s.Next(start.Add(90*time.Second)))
+	assert.True(t, s.Last())
+	assert.Equal(t, 90*time.Second, s.Elapsed())
+
+	assert.False(t, s.Next(start.Add(time.Hour)))
+	assert.Equal(t, 3, s.Seq)
+	assert.Equal(t, 90*time.Second, s.Elapsed())
+
+	// a session has at least one event
+	assert.True(t, state.NewSession("s2", start, 0).Last())
+}
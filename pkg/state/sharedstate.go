@@ -21,13 +21,12 @@
 package state
 
 import (
-	"math"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/biter777/countries"
-	"github.com/jrnd-io/jrv2/pkg/random"
 )
 
 var _state *SharedState
@@ -35,164 +34,129 @@ var _state *SharedState
 type CSV map[string]string
 type CSVMap map[int]CSV
 
+// Execution tracks the progress of the run. The counters are updated concurrently
+// by the emitters, so they must be accessed with the methods.
 type Execution struct {
 	Start                     time.Time
 	GeneratedObjects          uint64
 	GeneratedBytes            uint64
 	ExpectedObjects           int64
 	CurrentIterationLoopIndex int
+	lock                      sync.Mutex
+	clock                     atomic.Pointer[Clock]
 }
 
-// SharedState is the object passed on the templates which contains all the needed details.
-type SharedState struct {
-	Execution    *Execution
-	Locale       string
-	Counters     sync.Map
-	countersLock sync.RWMutex
-	Ctx          sync.Map
-
-	List     sync.Map
-	listLock sync.RWMutex
+// SetClock sets the clock of the run, nil for the real time
+func (e *Execution) SetClock(c *Clock) {
+	e.clock.Store(c)
+}
 
-	CSVMap  CSVMap
-	csvLock sync.RWMutex
+// Clock returns the clock of the run, nil for the real time
+func (e *Execution) Clock() *Clock {
+	return e.clock.Load()
+}
 
-	LastIndex    int
-	CountryIndex int
-	CityIndex    int
+// Now returns the current time of the clock of the run
+func (e *Execution) Now() time.Time {
+	return e.clock.Load().Now()
 }
 
-func GetSharedState() *SharedState {
+// AddGenerated counts a generated object of the given bytes
+func (e *Execution) AddGenerated(bytes uint64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.GeneratedObjects++
+	e.GeneratedBytes += bytes
+}
 
-	cIndex := 0
-	for i, c := range countries.All() {
-		if c.Alpha2() == "US" {
-			cIndex = i
-		}
-	}
-	if _state == nil {
-		_state = &SharedState{
-			Execution: &Execution{
-				Start: time.Now(),
-			},
-			Locale:       strings.ToLower(countries.UnitedStatesOfAmerica.Alpha2()),
-			Counters:     sync.Map{},
-			countersLock: sync.RWMutex{},
-			Ctx:          sync.Map{},
-			listLock:     sync.RWMutex{},
-			List:         sync.Map{},
-			CSVMap:       make(CSVMap),
-			csvLock:      sync.RWMutex{},
-			LastIndex:    -1,
-			CountryIndex: cIndex, // int(countries.UnitedStatesOfAmerica),
-			CityIndex:    -1,
-		}
-	}
-	return _state
+// Generated returns the generated objects and bytes
+func (e *Execution) Generated() (uint64, uint64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.GeneratedObjects, e.GeneratedBytes
 }
 
-func (st *SharedState) AddValueToList(key string, value any) {
-	st.listLock.Lock()
-	defer st.listLock.Unlock()
-	list, ok := st.List.Load(key)
-	if !ok {
-		list = []any{}
-	}
-	list = append(list.([]any), value)
-	st.List.Store(key, list)
+// NextIteration increments the loop index
+func (e *Execution) NextIteration() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.CurrentIterationLoopIndex++
 }
 
-func (st *SharedState) RandomValueFromList(s string) any {
-	st.listLock.Lock()
-	defer st.listLock.Unlock()
-	list, _ := st.List.Load(s)
-	if list == nil {
-		return ""
-	}
-	l := len(list.([]any))
-	if l != 0 {
-		return list.([]any)[random.Random.IntN(l)]
-	}
-	return ""
+// IterationLoopIndex returns the current loop index
+func (e *Execution) IterationLoopIndex() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.CurrentIterationLoopIndex
 }
 
-func (st *SharedState) GetValueFromListAtIndex(s string, index int) any {
+// SharedState is the object passed on the templates which contains all the needed details.
+// The embedded Scope is the global one, see GroupScope and EmitterScope for the others.
+type SharedState struct {
+	*Scope
+	Execution *Execution
+	Locale    string
 
-	st.listLock.Lock()
-	defer st.listLock.Unlock()
-	list, _ := st.List.Load(s)
-	if list == nil {
-		return ""
-	}
-	l := len(list.([]any))
-	if l != 0 && index < l {
-		return list.([]any)[index]
-	}
+	CSVMap  CSVMap
+	csvLock sync.RWMutex
 
-	return ""
+	// scopes of the groups and of the emitters, by name
+	groups     map[string]*Scope
+	emitters   map[emitterKey]*Scope
+	scopesLock sync.Mutex
 }
 
-// RandomNValuesFromList returns a random value from Context list l
-func (st *SharedState) RandomNValuesFromList(s string, n int) []any {
-	st.listLock.Lock()
-	defer st.listLock.Unlock()
-	list, _ := st.List.Load(s)
-	if list == nil {
-		return []any{""}
-
-	}
-	l := len(list.([]any))
-	if l != 0 {
-		ints := st.findNDifferentInts(n, l)
-		results := make([]any, len(ints))
-		for i := range ints {
-			results[i] = list.([]any)[i]
-		}
-		return results
-	}
-
-	return []any{""}
+// emitterKey identifies an emitter in its group
+type emitterKey struct {
+	group string
+	name  string
 }
 
-// Helper function to check if an int is in a slice of ints
-func contains(values []int, value int) bool {
-	for _, v := range values {
-		if v == value {
-			return true
+func GetSharedState() *SharedState {
+
+	if _state == nil {
+		_state = &SharedState{
+			Scope: newScope(GlobalScope, nil, nil),
+			Execution: &Execution{
+				Start: time.Now(),
+			},
+			Locale:   strings.ToLower(countries.UnitedStatesOfAmerica.Alpha2()),
+			CSVMap:   make(CSVMap),
+			csvLock:  sync.RWMutex{},
+			groups:   make(map[string]*Scope),
+			emitters: make(map[emitterKey]*Scope),
 		}
 	}
-	return false
+	return _state
 }
 
-func (st *SharedState) Counter(c string, start int, step int) int {
-	st.countersLock.Lock()
-	defer st.countersLock.Unlock()
+// GroupScope returns the scope shared by the emitters of group, creating it the first time
+func (st *SharedState) GroupScope(group string) *Scope {
+	st.scopesLock.Lock()
+	defer st.scopesLock.Unlock()
+	return st.groupScope(group)
+}
 
-	val, exists := st.Counters.Load(c)
-	if exists {
-		st.Counters.Store(c, val.(int)+step)
-		return val.(int) + step
+func (st *SharedState) groupScope(group string) *Scope {
+	s, ok := st.groups[group]
+	if !ok {
+		s = newScope(GroupScope+":"+group, nil, st.Scope)
+		st.groups[group] = s
 	}
-	st.Counters.Store(c, start)
-	return start
+	return s
 }
 
-// Helper function to generate n different integers from 0 to length
-func (st *SharedState) findNDifferentInts(n, max int) []int {
-
-	n = int(math.Min(float64(n), float64(max)))
-	ints := make([]int, n)
-
-	// Generate n different random indices of maximum length
-	for i := 0; i < n; {
-		index := random.Random.IntN(max)
-		if !contains(ints, index) {
-			ints[i] = index
-			i++
-		}
+// EmitterScope returns the scope of the emitter name of group, creating it the first time
+func (st *SharedState) EmitterScope(group string, name string) *Scope {
+	st.scopesLock.Lock()
+	defer st.scopesLock.Unlock()
+	key := emitterKey{group: group, name: name}
+	s, ok := st.emitters[key]
+	if !ok {
+		s = newScope(EmitterScope+":"+group+"/"+name, st.groupScope(group), st.Scope)
+		st.emitters[key] = s
 	}
-
-	return ints
+	return s
 }
 
 func (st *SharedState) SetCSV(csv CSVMap) {
@@ -200,17 +164,12 @@ func (st *SharedState) SetCSV(csv CSVMap) {
 
 }
 
-func (st *SharedState) Value(key string) any {
-	value, _ := GetSharedState().Ctx.Load(key)
-	return value
-}
-
 func (st *SharedState) FromCSV(c string) string {
 	st.csvLock.Lock()
 	defer st.csvLock.Unlock()
 
 	if len(st.CSVMap) > 0 {
-		return st.CSVMap[st.Execution.CurrentIterationLoopIndex%len(st.CSVMap)][c]
+		return st.CSVMap[st.Execution.IterationLoopIndex()%len(st.CSVMap)][c]
 	}
 	return ""
 
@@ -19,7 +19,7 @@ func TestAddValueToList(t *testing.T) {
 	s.AddValueToList("testList", "value1")
 	s.AddValueToList("testList", "value2")
 
-	value := s.RandomValueFromList("testList")
+	value := s.RandomValueFromList(random.Random, "testList")
 	assert.Contains(t, []string{"value1", "value2"}, value)
 }
 
@@ -40,7 +40,7 @@ func TestRandomNValuesFromList(t *testing.T) {
 	s.AddValueToList("testList", "value2")
 	s.AddValueToList("testList", "value3")
 
-	results := s.RandomNValuesFromList("testList", 2)
+	results := s.RandomNValuesFromList(random.Random, "testList", 2)
 	assert.Len(t, results, 2)
 	assert.Subset(t, []string{"value1", "value2", "value3"}, results)
 }
@@ -65,6 +65,43 @@ func TestValue(t *testing.T) {
 	assert.Equal(t, "testValue", state.Value("testKey"))
 }
 
+func TestScopes(t *testing.T) {
+	s := state.GetSharedState()
+	group := s.GroupScope("scopes")
+	first := s.EmitterScope("scopes", "first")
+	second := s.EmitterScope("scopes", "second")
+	assert.Same(t, first, s.EmitterScope("scopes", "first"))
+	assert.NotSame(t, first, second)
+
+	scope, name := first.Resolve("id")
+	assert.Same(t, group, scope)
+	assert.Equal(t, "id", name)
+	scope, name = first.Resolve("emitter:id")
+	assert.Same(t, first, scope)
+	assert.Equal(t, "id", name)
+	scope, _ = first.Resolve("global:id")
+	assert.Same(t, s.Scope, scope)
+
+	// the group counters are shared by its emitters, not by the other groups
+	assert.Equal(t, 1, group.Counter("scopeCounter", 1, 1))
+	scope, name = second.Resolve("scopeCounter")
+	assert.Equal(t, 2, scope.Counter(name, 1, 1))
+	assert.Equal(t, 1, s.GroupScope("other").Counter("scopeCounter", 1, 1))
+	assert.Equal(t, 1, first.Counter("scopeCounter", 1, 1))
+}
+
 func init() {
 	random.SetRandom(0)
 }
+
+func TestScopeRandom(t *testing.T) {
+	s := state.GetSharedState().EmitterScope("random", "emitter")
+	assert.Equal(t, random.Random, s.Random())
+
+	random.SetRandom(42)
+	defer random.SetRandom(-1)
+	stream := random.NewStream("emitter")
+	s.SetRandom(stream)
+	defer s.SetRandom(nil)
+	assert.Same(t, stream, s.Random())
+}
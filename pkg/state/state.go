@@ -22,6 +22,10 @@ package state
 type State struct {
 	Key    string
 	Header map[string]string
+	// Entity holds the fields of the entity of a scenario, in the templates of its states
+	Entity map[string]any
+	// Session is the session of the event, for the emitters generating sessions
+	Session *Session
 }
 
 func NewState() *State {
@@ -0,0 +1,111 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tpl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Error is an error in parsing or executing a template, with its location and the function which
+// failed, when text/template reports them
+type Error struct {
+	// Template is the name of the template, or of the one it includes where the error is
+	Template string
+	Line     int
+	// Column is the byte offset of the error in the line, from 0 as in the errors of text/template,
+	// or -1 if it is not known
+	Column int
+	// Function is the name of the function which failed or is not defined, if any
+	Function string
+	Message  string
+	err      error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Template)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+	}
+	if e.Column >= 0 {
+		fmt.Fprintf(&b, ":%d", e.Column)
+	}
+	if e.Function != "" {
+		fmt.Fprintf(&b, ": %s", e.Function)
+	}
+	fmt.Fprintf(&b, ": %s", e.Message)
+	return b.String()
+}
+
+// Unwrap returns the error of text/template
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+var (
+	// i.e. template: value:2:3: executing "value" at <get_v "x">: error calling get_v: no value for key "x"
+	execError = regexp.MustCompile(`(?s)^template: (.+?):(\d+):(\d+): executing "[^"]*" at <(.*?)>: (.*)$`)
+	// i.e. template: value:1: function "nofn" not defined
+	parseError        = regexp.MustCompile(`(?s)^template: (.+?):(\d+):(?:(\d+):)? (.*)$`)
+	callError         = regexp.MustCompile(`(?s)^error calling (\w+): (.*)$`)
+	undefinedFunction = regexp.MustCompile(`^function "(\w+)" not defined$`)
+	identifier        = regexp.MustCompile(`^[A-Za-z_]\w*`)
+)
+
+// NewError returns the error of parsing or executing the template name as an *Error, with the location
+// and the function found in the error of text/template. It returns nil if err is nil, and err itself
+// if it is already an *Error.
+func NewError(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	e = &Error{Template: name, Column: -1, Message: err.Error(), err: err}
+	if m := execError.FindStringSubmatch(err.Error()); m != nil {
+		e.Template, e.Message = m[1], m[5]
+		e.Line, _ = strconv.Atoi(m[2])
+		e.Column, _ = strconv.Atoi(m[3])
+		// the node is the call of the function which failed, or one of its arguments
+		e.Function = identifier.FindString(m[4])
+		if c := callError.FindStringSubmatch(e.Message); c != nil {
+			e.Function, e.Message = c[1], c[2]
+		}
+		return e
+	}
+	if m := parseError.FindStringSubmatch(err.Error()); m != nil {
+		e.Template, e.Message = m[1], m[4]
+		e.Line, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			e.Column, _ = strconv.Atoi(m[3])
+		}
+		if f := undefinedFunction.FindStringSubmatch(e.Message); f != nil {
+			e.Function = f[1]
+		}
+	}
+	return e
+}
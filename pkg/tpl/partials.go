@@ -0,0 +1,207 @@
+// Copyright © 2024 JR team
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tpl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/jrnd-io/jrv2/pkg/function"
+)
+
+// PartialsDir is the dir of the partials in the templates dirs. Every partial.tpl in it is added to
+// the templates, which include it with {{template "partial" .}}.
+const PartialsDir = "partials"
+
+// maxExpandDepth bounds the partials included by the partials, which may include themselves
+const maxExpandDepth = 32
+
+// cache keeps the partials read from the partials dirs, until they change
+var cache struct {
+	lock     sync.Mutex
+	dirs     []string
+	partials map[string]string
+}
+
+// PartialDirs returns the user and system partials dirs, in order of precedence
+func PartialDirs() []string {
+	var dirs []string
+	for _, d := range Dirs() {
+		dirs = append(dirs, filepath.Join(d, PartialsDir))
+	}
+	return dirs
+}
+
+// Partials returns the text of the partials by name, the user ones replacing the system ones
+func Partials() (map[string]string, error) {
+	partials := make(map[string]string)
+	dirs := PartialDirs()
+	slices.Reverse(dirs)
+	for _, d := range dirs {
+		entries, err := os.ReadDir(d)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), ".tpl")
+			if !ok || e.IsDir() {
+				continue
+			}
+			text, err := os.ReadFile(filepath.Join(d, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			partials[name] = string(text)
+		}
+	}
+	return partials, nil
+}
+
+// cachedPartials returns the partials, reading them only the first time or when the partials dirs
+// changed since, so that the templates compiled together don't read them again
+func cachedPartials() (map[string]string, error) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	dirs := PartialDirs()
+	if cache.partials != nil && slices.Equal(cache.dirs, dirs) {
+		return cache.partials, nil
+	}
+	partials, err := Partials()
+	if err != nil {
+		return nil, err
+	}
+	cache.dirs, cache.partials = dirs, partials
+	return partials, nil
+}
+
+// InvalidatePartials makes the next templates read the partials again, when they are changed
+func InvalidatePartials() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.partials = nil
+}
+
+// addPartials parses the partials into the set of t, but the ones with the name of a template it defines
+func addPartials(t *template.Template) error {
+	partials, err := cachedPartials()
+	if err != nil {
+		return fmt.Errorf("cannot read partials: %w", err)
+	}
+	for name, text := range partials {
+		if t.Lookup(name) != nil {
+			continue
+		}
+		if _, err := t.New(name).Parse(text); err != nil {
+			return NewError(name, err)
+		}
+	}
+	return nil
+}
+
+// Expand returns the text t of the template name with the partials it includes replaced by their text,
+// recursively. The partials included with a pipeline other than dot are wrapped in a with action.
+func Expand(name string, t string) (string, error) {
+	partials, err := Partials()
+	if err != nil {
+		return "", fmt.Errorf("cannot read partials: %w", err)
+	}
+	return expand(name, t, partials, 0)
+}
+
+func expand(name string, text string, partials map[string]string, depth int) (string, error) {
+	if depth > maxExpandDepth {
+		return "", fmt.Errorf("partial %s: more than %d nested partials", name, maxExpandDepth)
+	}
+	t, err := template.New(name).Funcs(function.Map()).Parse(text)
+	if err != nil {
+		return "", NewError(name, err)
+	}
+	if t.Tree == nil {
+		return text, nil
+	}
+
+	nodes := templateNodes(t.Tree.Root, nil)
+	slices.SortFunc(nodes, func(a, b *parse.TemplateNode) int { return int(a.Position() - b.Position()) })
+
+	var b strings.Builder
+	last := 0
+	for _, n := range nodes {
+		partial, ok := partials[n.Name]
+		// the templates defined by the template itself are not expanded, nor the template itself
+		if d := t.Lookup(n.Name); !ok || d != nil && d.Tree != nil {
+			continue
+		}
+		pos := int(n.Position())
+		start := strings.LastIndex(text[:pos], "{{")
+		end := strings.Index(text[pos:], "}}")
+		if start < last || end < 0 {
+			continue
+		}
+
+		expanded, err := expand(n.Name, partial, partials, depth+1)
+		if err != nil {
+			return "", err
+		}
+		expanded = strings.TrimSuffix(expanded, "\n")
+		b.WriteString(text[last:start])
+		if n.Pipe != nil && n.Pipe.String() != "." {
+			fmt.Fprintf(&b, "{{with %s}}%s{{end}}", n.Pipe, expanded)
+		} else {
+			b.WriteString(expanded)
+		}
+		last = pos + end + len("}}")
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// templateNodes returns the template actions of the tree of n
+func templateNodes(n parse.Node, nodes []*parse.TemplateNode) []*parse.TemplateNode {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nodes
+		}
+		for _, c := range n.Nodes {
+			nodes = templateNodes(c, nodes)
+		}
+	case *parse.IfNode:
+		nodes = templateNodes(n.ElseList, templateNodes(n.List, nodes))
+	case *parse.RangeNode:
+		nodes = templateNodes(n.ElseList, templateNodes(n.List, nodes))
+	case *parse.WithNode:
+		nodes = templateNodes(n.ElseList, templateNodes(n.List, nodes))
+	case *parse.TemplateNode:
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
@@ -22,7 +22,6 @@ package tpl
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -57,6 +56,9 @@ func New(name string, t string, fmap map[string]interface{}) (*Tpl, error) {
 		Msg("creating new template wrapper")
 	tp, err := template.New(name).Funcs(fmap).Parse(t)
 	if err != nil {
+		return nil, NewError(name, err)
+	}
+	if err := addPartials(tp); err != nil {
 		return nil, err
 	}
 
@@ -66,21 +68,23 @@ func New(name string, t string, fmap map[string]interface{}) (*Tpl, error) {
 	return tpl, nil
 }
 
-func (t *Tpl) Execute() string {
+// Execute executes the template without data, see ExecuteWith
+func (t *Tpl) Execute() (string, error) {
 	return t.ExecuteWith(nil)
 }
 
-func (t *Tpl) ExecuteWith(data any) string {
+// ExecuteWith executes the template with data, returning an *Error with the location of the
+// execution error, if any
+func (t *Tpl) ExecuteWith(data any) (string, error) {
 	log.Debug().
 		Str("name", t.Template.Name()).
 		Interface("data", data).
 		Msg("execute template")
 	var buffer bytes.Buffer
-	err := t.Template.Execute(&buffer, data)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error executing template")
+	if err := t.Template.Execute(&buffer, data); err != nil {
+		return "", NewError(t.Template.Name(), err)
 	}
-	return buffer.String()
+	return buffer.String(), nil
 }
 
 func GetRawTemplate(name string) (string, error) {
@@ -93,27 +97,30 @@ func GetRawValidatedTemplate(name string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	valid, _, err := IsValidTemplate(t)
-
-	if !valid || err != nil {
-		return "", errors.New("invalid template")
+	if _, _, err := IsValidTemplate(name, t); err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
 	}
 	return t, nil
 }
 
-func IsValidTemplate(t string) (bool, *template.Template, error) {
+// IsValidTemplate parses and executes the template t named name, returning an *Error with the
+// location of the error if it is not valid
+func IsValidTemplate(name string, t string) (bool, *template.Template, error) {
 
-	tt, err := template.New("test").Funcs(function.Map()).Parse(t)
+	tt, err := template.New(name).Funcs(function.Map()).Parse(t)
 	if err != nil {
+		return false, nil, NewError(name, err)
+	}
+	if err = addPartials(tt); err != nil {
 		return false, nil, err
 	}
 
 	var buf bytes.Buffer
 	if err = tt.Execute(&buf, nil); err != nil {
-		return false, nil, err
+		return false, nil, NewError(name, err)
 	}
 
-	return true, tt, err
+	return true, tt, nil
 
 }
 
@@ -122,7 +129,7 @@ func ExecuteTemplate(stringTemplate string, data any) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return tt.ExecuteWith(data), nil
+	return tt.ExecuteWith(data)
 }
 
 func ExecuteTemplateByName(name string, ctx any) (string, error) {
@@ -143,15 +150,40 @@ func UserTemplateList() *orderedmap.OrderedMap[string, *TemplateInfo] {
 	return templateList(templateDir)
 }
 
+// GetRawTemplateOrText returns t itself if it has an action, as the text of an inline template,
+// otherwise the template named t in the templates dirs, failing if there is no such template
+func GetRawTemplateOrText(t string) (string, error) {
+	if strings.Contains(t, "{{") {
+		return t, nil
+	}
+	return getTemplate(t)
+}
+
+// Dirs returns the user and system templates dirs, in order of precedence
+func Dirs() []string {
+	return []string{
+		os.ExpandEnv(fmt.Sprintf("%s/%s", config.JrUserDir, "templates")),
+		os.ExpandEnv(fmt.Sprintf("%s/%s", config.JrSystemDir, "templates")),
+	}
+}
+
+// templatePaths returns the user and system paths of the template name, in order of precedence
+func templatePaths(name string) []string {
+	dirs := Dirs()
+	return []string{
+		fmt.Sprintf("%s/%s.tpl", dirs[0], name),
+		fmt.Sprintf("%s/%s.tpl", dirs[1], name),
+	}
+}
+
 func getTemplate(name string) (string, error) {
-	systemTemplateDir := os.ExpandEnv(fmt.Sprintf("%s/%s", config.JrSystemDir, "templates"))
-	userTemplateDir := os.ExpandEnv(fmt.Sprintf("%s/%s", config.JrUserDir, "templates"))
+	paths := templatePaths(name)
 
-	userTemplate := fmt.Sprintf("%s/%s.tpl", userTemplateDir, name)
+	userTemplate := paths[0]
 	templateScript, err := os.ReadFile(userTemplate)
 	if err != nil {
 		log.Debug().Err(err).Str("template", userTemplate).Msg("Error reading template")
-		systemTemplate := fmt.Sprintf("%s/%s.tpl", systemTemplateDir, name)
+		systemTemplate := paths[1]
 		templateScript, err = os.ReadFile(systemTemplate)
 		if err != nil {
 			log.Error().Err(err).Str("name", name).Msg("Error reading template")
@@ -171,11 +203,15 @@ func templateList(templateDir string) *orderedmap.OrderedMap[string, *TemplateIn
 	}
 
 	_ = filepath.WalkDir(templateDir, func(path string, f fs.DirEntry, _ error) error {
+		// the partials are not templates on their own
+		if f != nil && f.IsDir() && path == filepath.Join(templateDir, PartialsDir) {
+			return filepath.SkipDir
+		}
 		if strings.HasSuffix(path, "tpl") {
 
 			t, _ := os.ReadFile(path)
-			valid, tt, err := IsValidTemplate(string(t))
 			name, _ := strings.CutSuffix(f.Name(), ".tpl")
+			valid, tt, err := IsValidTemplate(name, string(t))
 			templateInfo := TemplateInfo{
 				Name:     name,
 				IsValid:  valid,
@@ -1,9 +1,14 @@
 package tpl_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/jrnd-io/jrv2/pkg/config"
 	"github.com/jrnd-io/jrv2/pkg/tpl"
+	"github.com/stretchr/testify/assert"
 )
 
 const (
@@ -52,7 +57,10 @@ func TestExecute(t *testing.T) {
 		t.Fatalf("Failed to create template: %v", err)
 	}
 
-	result := templ.ExecuteWith(ctx)
+	result, err := templ.ExecuteWith(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
 	expected := "Hello, World!"
 
 	if result != expected {
@@ -71,10 +79,200 @@ func TestExecuteWith(t *testing.T) {
 	}
 
 	newCtx := struct{ Name string }{"Go"}
-	result := templ.ExecuteWith(newCtx)
+	result, err := templ.ExecuteWith(newCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
 	expected := "Hello, Go!"
 
 	if result != expected {
 		t.Fatalf("Expected %q, got %q", expected, result)
 	}
 }
+
+func TestGetRawTemplateOrText(t *testing.T) {
+	inline := `{{"not a template name"}}`
+	got, err := tpl.GetRawTemplateOrText(inline)
+	if err != nil || got != inline {
+		t.Fatalf("Expected %q, got %q, %v", inline, got, err)
+	}
+	if _, err := tpl.GetRawTemplateOrText("not a template name"); err == nil {
+		t.Fatal("Expected an error for a missing template without actions")
+	}
+}
+
+func TestExecuteError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		expected tpl.Error
+	}{
+		{
+			name:     "missing value",
+			template: "a\n {{get_v \"missing\"}}",
+			expected: tpl.Error{Template: "test", Line: 2, Column: 3, Function: "get_v", Message: `no value for key "missing"`},
+		},
+		{
+			name:     "missing value at column 0",
+			template: "{{\nget_v \"missing\"}}",
+			expected: tpl.Error{Template: "test", Line: 2, Column: 0, Function: "get_v", Message: `no value for key "missing"`},
+		},
+		{
+			name:     "wrong arguments",
+			template: `{{key "KEY" "ten"}}`,
+			expected: tpl.Error{Template: "test", Line: 1, Column: 12, Message: `expected integer; found "ten"`},
+		},
+		{
+			name:     "undefined function",
+			template: `{{nofn 1}}`,
+			expected: tpl.Error{Template: "test", Line: 1, Column: -1, Function: "nofn", Message: `function "nofn" not defined`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tpl.ExecuteTemplate(tc.template, nil)
+			var tplErr *tpl.Error
+			if !errors.As(err, &tplErr) {
+				t.Fatalf("Expected a template error, got %v", err)
+			}
+			assert.Equal(t, tc.expected.Template, tplErr.Template)
+			assert.Equal(t, tc.expected.Line, tplErr.Line)
+			assert.Equal(t, tc.expected.Column, tplErr.Column)
+			assert.Equal(t, tc.expected.Function, tplErr.Function)
+			assert.Equal(t, tc.expected.Message, tplErr.Message)
+			assert.NotNil(t, errors.Unwrap(tplErr))
+		})
+	}
+
+	_, err := tpl.ExecuteTemplate(`{{set_v "present" "v"}}{{get_v "present"}}`, nil)
+	assert.NoError(t, err)
+}
+
+func TestErrorString(t *testing.T) {
+	err := tpl.NewError("value", errors.New(`template: order.value:3:14: executing "order.value" at <get_v "id">: error calling get_v: no value for key "id"`))
+	assert.EqualError(t, err, `order.value:3:14: get_v: no value for key "id"`)
+	assert.EqualError(t, tpl.NewError("value", errors.New(`template: value:1:0: executing "value" at <get_v "id">: error calling get_v: no value for key "id"`)), `value:1:0: get_v: no value for key "id"`)
+	assert.Same(t, err, tpl.NewError("other", err))
+	assert.EqualError(t, tpl.NewError("value", errors.New("broken")), "value: broken")
+	assert.NoError(t, tpl.NewError("value", nil))
+}
+
+func TestIsValidTemplate(t *testing.T) {
+	valid, tt, err := tpl.IsValidTemplate("hello", `{{"hello"}}`)
+	assert.True(t, valid)
+	assert.NotNil(t, tt)
+	assert.NoError(t, err)
+
+	valid, tt, err = tpl.IsValidTemplate("broken", "{{\n .X }")
+	assert.False(t, valid)
+	assert.Nil(t, tt)
+	assert.EqualError(t, err, `broken:2: unexpected "}" in operand`)
+}
+
+// setPartials sets temporary user and system dirs with the given templates and partials by path
+func setPartials(t *testing.T, files map[string]string) {
+	t.Helper()
+	systemDir, userDir := config.JrSystemDir, config.JrUserDir
+	t.Cleanup(func() { config.JrSystemDir, config.JrUserDir = systemDir, userDir })
+	dir := t.TempDir()
+	config.JrSystemDir = filepath.Join(dir, "system")
+	config.JrUserDir = filepath.Join(dir, "user")
+	for path, text := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPartials(t *testing.T) {
+	setPartials(t, map[string]string{
+		"system/templates/partials/address.tpl": "system address",
+		"system/templates/partials/contact.tpl": `{{.Phone}} {{template "address" .Address}}`,
+		"user/templates/partials/address.tpl":   `{{.City}}, {{.Zip}}`,
+		"user/templates/customer.tpl":           `{"contact": "{{template "contact" .}}"}`,
+	})
+
+	data := map[string]any{"Phone": "555", "Address": map[string]string{"City": "Rome", "Zip": "00100"}}
+	// the user partials replace the system ones
+	result, err := tpl.ExecuteTemplateByName("customer", data)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"contact": "555 Rome, 00100"}`, result)
+
+	// the key, header and output templates include the partials too
+	key, err := tpl.New("key", `{{template "address" .Address}}`, map[string]any{})
+	assert.NoError(t, err)
+	result, err = key.ExecuteWith(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Rome, 00100", result)
+
+	// the templates defined by a template are not replaced
+	result, err = tpl.ExecuteTemplate(`{{define "address"}}own{{end}}{{template "address"}}`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "own", result)
+
+	// the partials are not listed as templates
+	templates := tpl.UserTemplateList()
+	assert.Equal(t, 1, templates.Len())
+	assert.NotNil(t, templates.Value("customer"))
+}
+
+func TestCachedPartials(t *testing.T) {
+	setPartials(t, map[string]string{
+		"user/templates/partials/greeting.tpl": "p1",
+	})
+	execute := func() string {
+		t.Helper()
+		tp, err := tpl.New("value", `{{template "greeting"}}`, map[string]any{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := tp.Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	assert.Equal(t, "p1", execute())
+
+	// the partials are read again only once invalidated
+	path := filepath.Join(config.JrUserDir, "templates", tpl.PartialsDir, "greeting.tpl")
+	if err := os.WriteFile(path, []byte("p2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "p1", execute())
+	tpl.InvalidatePartials()
+	assert.Equal(t, "p2", execute())
+}
+
+func TestInvalidPartial(t *testing.T) {
+	setPartials(t, map[string]string{
+		"user/templates/partials/broken.tpl": "{{.X",
+	})
+	_, err := tpl.New("value", "v", map[string]any{})
+	var tplErr *tpl.Error
+	if !errors.As(err, &tplErr) {
+		t.Fatalf("Expected a template error, got %v", err)
+	}
+	assert.Equal(t, "broken", tplErr.Template)
+}
+
+func TestExpand(t *testing.T) {
+	setPartials(t, map[string]string{
+		"system/templates/partials/address.tpl": "{{.City}}, {{zip}}\n",
+		"system/templates/partials/contact.tpl": `{{phone}} {{template "address" .Address}}`,
+	})
+
+	expanded, err := tpl.Expand("customer", `{"contact": "{{template "contact" .}}"{{if .Home}}, "home": "{{template "address" .Home}}"{{end}}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"contact": "{{phone}} {{with .Address}}{{.City}}, {{zip}}{{end}}"{{if .Home}}, "home": "{{with .Home}}{{.City}}, {{zip}}{{end}}"{{end}}}`, expanded)
+
+	// the unknown and the defined templates are kept
+	text := `{{define "own"}}x{{end}}{{template "own"}}{{template "unknown" .}}`
+	expanded, err = tpl.Expand("customer", text)
+	assert.NoError(t, err)
+	assert.Equal(t, text, expanded)
+}
@@ -0,0 +1 @@
+{{city}}, {{street}} {{building 2}}, {{zip}}
\ No newline at end of file
@@ -1,7 +1,7 @@
-{{$storeId := atoi (random_v_from_list "storeId") }}
+{{$storeId := 0}}{{$orderId := 0}}{{$date := 0}}{{with .Entity}}{{$storeId = .store_id}}{{$orderId = .store_order_id}}{{$date = .date}}{{else}}{{$storeId = atoi (random_v_from_list "storeId")}}{{$orderId = counter (print $storeId "_store_order_id") 1001 2}}{{$date = integer 18000 19000}}{{end}}
 {
   "store_id": {{$storeId}},
-  "store_order_id": {{counter  (print $storeId "_store_order_id") 1001 2}},
-  "date":  {{integer 18000 19000}},
+  "store_order_id": {{$orderId}},
+  "date":  {{$date}},
   "status": "cancelled"
-}
\ No newline at end of file
+}
@@ -1,9 +1,9 @@
-{{$storeId := atoi (random_v_from_list "storeId") }}
+{{$storeId := 0}}{{$orderId := 0}}{{$date := 0}}{{with .Entity}}{{$storeId = .store_id}}{{$orderId = .store_order_id}}{{$date = .date}}{{else}}{{$storeId = atoi (random_v_from_list "storeId")}}{{$orderId = counter (print $storeId "_store_order_id") 1000 2}}{{$date = integer 18000 19000}}{{end}}
 {
     "store_id": {{$storeId}},
-    "store_order_id": {{counter  (print $storeId "_store_order_id") 1000 2}},
-    "date":  {{integer 18000 19000}},
+    "store_order_id": {{$orderId}},
+    "date":  {{$date}},
     "status" : "completed",
     "rack_time_secs" : {{integer 130 230}},
     "order_delivery_time_secs" :  {{integer 1100 2000}}
-}
\ No newline at end of file
+}
@@ -0,0 +1,9 @@
+{{$userId := ""}}{{$ip := ""}}{{with .Entity}}{{$userId = .user_id}}{{$ip = .ip}}{{else}}{{$userId = random_v_from_list "customers_id_list"}}{{$ip = ip "10.1.0.0/16"}}{{end}}
+{
+  "product_id": "{{random_v_from_list "shoes_id_list"}}",
+  "user_id": "{{$userId}}",
+  "view_time": {{integer 10 120}},
+  "page_url": "https://www.acme.com/product/{{random_string 4 5}}",
+  "ip": "{{$ip}}",
+  "ts": {{with .Session}}{{.Time.UnixMilli}}{{else}}{{counter "ts" 1609459200000 10000 }}{{end}}
+}
\ No newline at end of file
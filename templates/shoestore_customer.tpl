@@ -4,7 +4,7 @@
   "last_name": "{{surname}}",
   "email": "{{email}}",
   "phone_number": "{{phone}}",
-  "street_address": "{{city}}, {{street}} {{building 2}}, {{zip}}",
+  "street_address": "{{template "street_address" .}}",
   "state": "{{state}}",
   "zip_code": "{{zip}}",
   "country": "United States",
@@ -12,7 +12,7 @@
   "email": "{{email}}",
   "about": "{{lorem 20}}",
   "country": "{{country}}",
-  "address": "{{city}}, {{street}} {{building 2}}, {{zip}}",
+  "address": "{{template "street_address" .}}",
   "phone_number": "{{phone}}",
   "mobile": "{{mobile_phone}}",
   "latitude": {{latitude}},